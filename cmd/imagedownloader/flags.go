@@ -0,0 +1,698 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/urfave/cli/v2"
+
+	"fachr.in/image-downloader/internal/app"
+	imageDownloaderPkg "fachr.in/image-downloader/pkg/imagedownloader"
+)
+
+const (
+	envPrefix = "IMAGEDL_"
+)
+
+func flags(defaults app.Config) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "config",
+			Usage:   "path to a yaml config file, flags take precedence over its values",
+			EnvVars: []string{envPrefix + "CONFIG"},
+		},
+		&cli.StringFlag{
+			Name:    "profile",
+			Usage:   "name of the config file profile applied on top of its base values",
+			EnvVars: []string{envPrefix + "PROFILE"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "fixture",
+			Usage:   "fixture listing image urls, repeat it to read several: a file, a glob pattern, a directory or - for stdin, .gz and .zst files are decompressed",
+			EnvVars: []string{envPrefix + "FIXTURE"},
+			Value:   cli.NewStringSlice(defaults.Fixture.Path),
+		},
+		&cli.StringFlag{
+			Name:    "fixture-format",
+			Usage:   "format of the fixture, either text, csv or jsonl, empty picks it by the file extension",
+			EnvVars: []string{envPrefix + "FIXTURE_FORMAT"},
+			Value:   defaults.Fixture.Format,
+		},
+		&cli.StringSliceFlag{
+			Name:    "fixture-column",
+			Usage:   "csv header naming a record field, e.g. url=Image URL, fields are id, url, filename, category and sha256",
+			EnvVars: []string{envPrefix + "FIXTURE_COLUMNS"},
+		},
+		&cli.BoolFlag{
+			Name:    "fixture-pages",
+			Usage:   "read the fixture urls as html pages or image sitemaps and download the images found on them",
+			EnvVars: []string{envPrefix + "FIXTURE_PAGES"},
+			Value:   defaults.Fixture.Pages,
+		},
+		&cli.IntFlag{
+			Name:    "batch-size",
+			Usage:   "number of urls read from the fixture at once",
+			EnvVars: []string{envPrefix + "BATCH_SIZE"},
+			Value:   defaults.Fixture.BatchSize,
+		},
+		&cli.IntFlag{
+			Name:    "workers",
+			Usage:   "number of download workers, workers × batch-size images are downloaded at once unless max-concurrent-downloads is set",
+			EnvVars: []string{envPrefix + "WORKERS"},
+			Value:   defaults.Workers,
+		},
+		&cli.IntFlag{
+			Name:    "max-concurrent-downloads",
+			Usage:   "number of images downloaded at once across the service whatever the batch size, 0 keeps workers × batch-size",
+			EnvVars: []string{envPrefix + "MAX_CONCURRENT_DOWNLOADS"},
+			Value:   defaults.MaxConcurrentDownloads,
+		},
+		&cli.BoolFlag{
+			Name:    "adaptive",
+			Usage:   "grow the concurrency limit and the in-flight cap of every host while downloads stay healthy, back off on timeouts, 429s and 5xx",
+			EnvVars: []string{envPrefix + "ADAPTIVE"},
+			Value:   defaults.Adaptive.Enabled,
+		},
+		&cli.IntFlag{
+			Name:    "adaptive-max",
+			Usage:   "highest adaptive concurrency limit",
+			EnvVars: []string{envPrefix + "ADAPTIVE_MAX"},
+			Value:   defaults.Adaptive.Max,
+		},
+		&cli.IntFlag{
+			Name:    "adaptive-host-initial",
+			Usage:   "in-flight cap every host starts with when adaptive",
+			EnvVars: []string{envPrefix + "ADAPTIVE_HOST_INITIAL"},
+			Value:   defaults.Adaptive.HostInitial,
+		},
+		&cli.IntFlag{
+			Name:    "adaptive-host-max",
+			Usage:   "highest adaptive in-flight cap of a host",
+			EnvVars: []string{envPrefix + "ADAPTIVE_HOST_MAX"},
+			Value:   defaults.Adaptive.HostMax,
+		},
+		&cli.DurationFlag{
+			Name:    "adaptive-latency-target",
+			Usage:   "response time above which adaptive limits stop growing, 0 ignores latency",
+			EnvVars: []string{envPrefix + "ADAPTIVE_LATENCY_TARGET"},
+			Value:   defaults.Adaptive.LatencyTarget,
+		},
+		&cli.BoolFlag{
+			Name:    "breaker",
+			Usage:   "fail the urls of a host fast once too many of its requests fail instead of retrying each of them",
+			EnvVars: []string{envPrefix + "BREAKER"},
+			Value:   defaults.Breaker.Enabled,
+		},
+		&cli.Float64Flag{
+			Name:    "breaker-failure-ratio",
+			Usage:   "share of failed requests to a host that opens its circuit",
+			EnvVars: []string{envPrefix + "BREAKER_FAILURE_RATIO"},
+			Value:   defaults.Breaker.FailureRatio,
+		},
+		&cli.IntFlag{
+			Name:    "breaker-min-requests",
+			Usage:   "number of requests to a host before its failure ratio is judged",
+			EnvVars: []string{envPrefix + "BREAKER_MIN_REQUESTS"},
+			Value:   defaults.Breaker.MinRequests,
+		},
+		&cli.DurationFlag{
+			Name:    "breaker-window",
+			Usage:   "how long failures of a host are counted for before counting starts over, 0 never starts over",
+			EnvVars: []string{envPrefix + "BREAKER_WINDOW"},
+			Value:   defaults.Breaker.Window,
+		},
+		&cli.DurationFlag{
+			Name:    "breaker-open-timeout",
+			Usage:   "how long an open circuit fails fast before probing its host again",
+			EnvVars: []string{envPrefix + "BREAKER_OPEN_TIMEOUT"},
+			Value:   defaults.Breaker.OpenTimeout,
+		},
+		&cli.IntFlag{
+			Name:    "breaker-probes",
+			Usage:   "number of probes that must succeed to close a circuit",
+			EnvVars: []string{envPrefix + "BREAKER_PROBES"},
+			Value:   defaults.Breaker.Probes,
+		},
+		&cli.StringFlag{
+			Name:    "admin-addr",
+			Usage:   "address of the admin api adjusting a running job, e.g. 127.0.0.1:8080, empty disables it",
+			EnvVars: []string{envPrefix + "ADMIN_ADDR"},
+			Value:   defaults.Admin.Addr,
+		},
+		&cli.StringFlag{
+			Name:    "storage-backend",
+			Usage:   "where images are stored, either local or s3",
+			EnvVars: []string{envPrefix + "STORAGE_BACKEND"},
+			Value:   defaults.Storage.Backend,
+		},
+		&cli.StringFlag{
+			Name:    "storage-root",
+			Usage:   "directory where downloaded images are stored",
+			EnvVars: []string{envPrefix + "STORAGE_ROOT"},
+			Value:   defaults.Storage.RootPath,
+		},
+		&cli.StringFlag{
+			Name:    "storage-mode",
+			Usage:   "how images are named on disk, either named or content-addressed",
+			EnvVars: []string{envPrefix + "STORAGE_MODE"},
+			Value:   defaults.Storage.Mode,
+		},
+		&cli.BoolFlag{
+			Name:    "storage-sync",
+			Usage:   "flush every local image to the disk before renaming it into place",
+			EnvVars: []string{envPrefix + "STORAGE_SYNC"},
+			Value:   defaults.Storage.Sync,
+		},
+		&cli.StringFlag{
+			Name:    "s3-endpoint",
+			Usage:   "endpoint of the s3 compatible storage, e.g. http://localhost:9000",
+			EnvVars: []string{envPrefix + "S3_ENDPOINT"},
+			Value:   defaults.Storage.S3.Endpoint,
+		},
+		&cli.StringFlag{
+			Name:    "s3-bucket",
+			Usage:   "bucket where images are stored",
+			EnvVars: []string{envPrefix + "S3_BUCKET"},
+			Value:   defaults.Storage.S3.Bucket,
+		},
+		&cli.StringFlag{
+			Name:    "s3-region",
+			Usage:   "region of the bucket",
+			EnvVars: []string{envPrefix + "S3_REGION", "AWS_REGION"},
+			Value:   defaults.Storage.S3.Region,
+		},
+		&cli.StringFlag{
+			Name:    "s3-access-key-id",
+			Usage:   "access key id used to sign s3 requests",
+			EnvVars: []string{envPrefix + "S3_ACCESS_KEY_ID", "AWS_ACCESS_KEY_ID"},
+			Value:   defaults.Storage.S3.AccessKeyID,
+		},
+		&cli.StringFlag{
+			Name:    "s3-secret-access-key",
+			Usage:   "secret access key used to sign s3 requests",
+			EnvVars: []string{envPrefix + "S3_SECRET_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY"},
+			Value:   defaults.Storage.S3.SecretAccessKey,
+		},
+		&cli.IntFlag{
+			Name:    "max-idle-conns",
+			Usage:   "maximum idle http connections across all hosts, 0 means unlimited",
+			EnvVars: []string{envPrefix + "MAX_IDLE_CONNS"},
+			Value:   defaults.Transport.MaxIdleConns,
+		},
+		&cli.IntFlag{
+			Name:    "max-idle-conns-per-host",
+			Usage:   "maximum idle http connections per host",
+			EnvVars: []string{envPrefix + "MAX_IDLE_CONNS_PER_HOST"},
+			Value:   defaults.Transport.MaxIdleConnsPerHost,
+		},
+		&cli.IntFlag{
+			Name:    "max-conns-per-host",
+			Usage:   "maximum http connections per host, 0 means unlimited",
+			EnvVars: []string{envPrefix + "MAX_CONNS_PER_HOST"},
+			Value:   defaults.Transport.MaxConnsPerHost,
+		},
+		&cli.DurationFlag{
+			Name:    "idle-conn-timeout",
+			Usage:   "how long an idle http connection is kept, 0 means forever",
+			EnvVars: []string{envPrefix + "IDLE_CONN_TIMEOUT"},
+			Value:   defaults.Transport.IdleConnTimeout,
+		},
+		&cli.DurationFlag{
+			Name:    "http-timeout",
+			Usage:   "time limit of a single http request, 0 means no timeout",
+			EnvVars: []string{envPrefix + "HTTP_TIMEOUT"},
+			Value:   defaults.Transport.Timeout,
+		},
+		&cli.DurationFlag{
+			Name:    "retry-base-delay",
+			Usage:   "base delay of the exponential retry backoff",
+			EnvVars: []string{envPrefix + "RETRY_BASE_DELAY"},
+			Value:   defaults.Retry.BaseDelay,
+		},
+		&cli.DurationFlag{
+			Name:    "retry-max-delay",
+			Usage:   "maximum delay between two retries",
+			EnvVars: []string{envPrefix + "RETRY_MAX_DELAY"},
+			Value:   defaults.Retry.MaxDelay,
+		},
+		&cli.IntFlag{
+			Name:    "retry-max-attempts",
+			Usage:   "maximum number of retries of a failed request",
+			EnvVars: []string{envPrefix + "RETRY_MAX_ATTEMPTS"},
+			Value:   defaults.Retry.MaxAttempts,
+		},
+		&cli.IntSliceFlag{
+			Name:    "retry-status-codes",
+			Usage:   "http response status codes worth another attempt, the Retry-After header is honored",
+			EnvVars: []string{envPrefix + "RETRY_STATUS_CODES"},
+			Value:   cli.NewIntSlice(defaults.Retry.StatusCodes...),
+		},
+		&cli.StringSliceFlag{
+			Name:    "content-type",
+			Usage:   "accept an image media type stored under an extension, e.g. image/avif=.avif, or image/*=.img as a fallback",
+			EnvVars: []string{envPrefix + "CONTENT_TYPES"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "content-type-alias",
+			Usage:   "treat a media type as the one it stands for, e.g. image/jpg=image/jpeg",
+			EnvVars: []string{envPrefix + "CONTENT_TYPE_ALIASES"},
+		},
+		&cli.StringFlag{
+			Name:    "sniff-policy",
+			Usage:   "how the image format detected from the body is reconciled with the content type header, either header, detect or strict",
+			EnvVars: []string{envPrefix + "SNIFF_POLICY"},
+			Value:   defaults.SniffPolicy,
+		},
+		&cli.Int64Flag{
+			Name:    "max-size",
+			Usage:   "reject images larger than this many bytes, aborting their download, 0 means unlimited",
+			EnvVars: []string{envPrefix + "MAX_SIZE"},
+			Value:   defaults.Size.Max,
+		},
+		&cli.Int64Flag{
+			Name:    "min-size",
+			Usage:   "reject images smaller than this many bytes, e.g. tracking pixels",
+			EnvVars: []string{envPrefix + "MIN_SIZE"},
+			Value:   defaults.Size.Min,
+		},
+		&cli.BoolFlag{
+			Name:    "validate",
+			Usage:   "decode the header of every image before storing it, rejecting corrupt images",
+			EnvVars: []string{envPrefix + "VALIDATE"},
+			Value:   defaults.Validation.Enabled,
+		},
+		&cli.BoolFlag{
+			Name:    "validate-fully",
+			Usage:   "decode every image in full before storing it, also catching truncated images",
+			EnvVars: []string{envPrefix + "VALIDATE_FULLY"},
+			Value:   defaults.Validation.DecodeFully,
+		},
+		&cli.StringFlag{
+			Name:    "quarantine",
+			Usage:   "storage key prefix corrupt images are kept under, they are dropped when empty",
+			EnvVars: []string{envPrefix + "QUARANTINE"},
+			Value:   defaults.Validation.Quarantine,
+		},
+		&cli.IntFlag{
+			Name:    "min-width",
+			Usage:   "reject images narrower than this many pixels",
+			EnvVars: []string{envPrefix + "MIN_WIDTH"},
+			Value:   defaults.Validation.MinWidth,
+		},
+		&cli.IntFlag{
+			Name:    "min-height",
+			Usage:   "reject images shorter than this many pixels",
+			EnvVars: []string{envPrefix + "MIN_HEIGHT"},
+			Value:   defaults.Validation.MinHeight,
+		},
+		&cli.IntFlag{
+			Name:    "max-width",
+			Usage:   "reject images wider than this many pixels, 0 means unlimited",
+			EnvVars: []string{envPrefix + "MAX_WIDTH"},
+			Value:   defaults.Validation.MaxWidth,
+		},
+		&cli.IntFlag{
+			Name:    "max-height",
+			Usage:   "reject images taller than this many pixels, 0 means unlimited",
+			EnvVars: []string{envPrefix + "MAX_HEIGHT"},
+			Value:   defaults.Validation.MaxHeight,
+		},
+		&cli.StringFlag{
+			Name:    "report-format",
+			Usage:   "how results are printed, either json once all images are done or ndjson streamed per image",
+			EnvVars: []string{envPrefix + "REPORT_FORMAT"},
+			Value:   defaults.Report.Format,
+		},
+		&cli.Float64Flag{
+			Name:    "host-rate",
+			Usage:   "requests per second each host receives, 0 means unlimited",
+			EnvVars: []string{envPrefix + "HOST_RATE"},
+			Value:   defaults.HostLimits.Rate,
+		},
+		&cli.IntFlag{
+			Name:    "host-burst",
+			Usage:   "requests each host may receive at once before the host rate kicks in",
+			EnvVars: []string{envPrefix + "HOST_BURST"},
+			Value:   defaults.HostLimits.Burst,
+		},
+		&cli.IntFlag{
+			Name:    "host-max-in-flight",
+			Usage:   "maximum concurrent downloads from each host, 0 means unlimited",
+			EnvVars: []string{envPrefix + "HOST_MAX_IN_FLIGHT"},
+			Value:   defaults.HostLimits.MaxInFlight,
+		},
+		&cli.StringSliceFlag{
+			Name:    "host-limit",
+			Usage:   "limits of a single host given as host=rate[/burst[/max_in_flight]], e.g. www.imfdb.org=2/4/8",
+			EnvVars: []string{envPrefix + "HOST_LIMITS"},
+		},
+		&cli.StringFlag{
+			Name:    "journal",
+			Usage:   "path to the download journal recording each url's final state",
+			EnvVars: []string{envPrefix + "JOURNAL"},
+			Value:   defaults.Journal.Path,
+		},
+		&cli.BoolFlag{
+			Name:    "resume",
+			Usage:   "resume an interrupted run from the journal, skipping completed urls",
+			EnvVars: []string{envPrefix + "RESUME"},
+			Value:   defaults.Journal.Resume,
+		},
+		&cli.StringFlag{
+			Name:    "cache",
+			Usage:   "path to the http cache file, images whose etag or last modified date did not change are not downloaded again",
+			EnvVars: []string{envPrefix + "CACHE"},
+			Value:   defaults.Cache.Path,
+		},
+		&cli.DurationFlag{
+			Name:    "deadline",
+			Usage:   "maximum duration of the whole run, downloads still in flight once it is over are cancelled, 0 means unlimited",
+			EnvVars: []string{envPrefix + "DEADLINE"},
+			Value:   defaults.Deadline,
+		},
+		&cli.DurationFlag{
+			Name:    "grace-period",
+			Usage:   "how long in-flight downloads may finish after the first interrupt, 0 waits for them until a second interrupt",
+			EnvVars: []string{envPrefix + "GRACE_PERIOD"},
+			Value:   defaults.Shutdown.GracePeriod,
+		},
+	}
+}
+
+// crawlFlags are the flags of the crawl command on top of the common ones
+func crawlFlags(defaults app.Config) []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:    "crawl-max-depth",
+			Usage:   "number of links a crawled page may be away from a seed, 0 only visits the seeds",
+			EnvVars: []string{envPrefix + "CRAWL_MAX_DEPTH"},
+			Value:   defaults.Crawl.MaxDepth,
+		},
+		&cli.IntFlag{
+			Name:    "crawl-max-pages",
+			Usage:   "number of pages crawled at most, pages visited before a resume included",
+			EnvVars: []string{envPrefix + "CRAWL_MAX_PAGES"},
+			Value:   defaults.Crawl.MaxPages,
+		},
+		&cli.DurationFlag{
+			Name:    "crawl-delay",
+			Usage:   "least time between two page requests to the same host, a longer robots.txt crawl-delay wins",
+			EnvVars: []string{envPrefix + "CRAWL_DELAY"},
+			Value:   defaults.Crawl.Delay,
+		},
+		&cli.StringFlag{
+			Name:    "crawl-user-agent",
+			Usage:   "user agent sent with page requests, it picks the robots.txt rules applying to the crawl",
+			EnvVars: []string{envPrefix + "CRAWL_USER_AGENT"},
+			Value:   defaults.Crawl.UserAgent,
+		},
+		&cli.StringFlag{
+			Name:    "crawl-frontier",
+			Usage:   "path to the file persisting the pages to crawl, empty keeps them in memory",
+			EnvVars: []string{envPrefix + "CRAWL_FRONTIER"},
+			Value:   defaults.Crawl.Frontier,
+		},
+		&cli.BoolFlag{
+			Name:    "crawl-resume",
+			Usage:   "continue the crawl of an existing frontier instead of starting over",
+			EnvVars: []string{envPrefix + "CRAWL_RESUME"},
+			Value:   defaults.Crawl.Resume,
+		},
+	}
+}
+
+// applyCrawlFlags overrides crawl config values with the seed arguments and the crawl flags explicitly set
+func applyCrawlFlags(ctx *cli.Context, cfg *app.Config) {
+	if ctx.Args().Present() {
+		cfg.Crawl.Seeds = ctx.Args().Slice()
+	}
+	if ctx.IsSet("crawl-max-depth") {
+		cfg.Crawl.MaxDepth = ctx.Int("crawl-max-depth")
+	}
+	if ctx.IsSet("crawl-max-pages") {
+		cfg.Crawl.MaxPages = ctx.Int("crawl-max-pages")
+	}
+	if ctx.IsSet("crawl-delay") {
+		cfg.Crawl.Delay = ctx.Duration("crawl-delay")
+	}
+	if ctx.IsSet("crawl-user-agent") {
+		cfg.Crawl.UserAgent = ctx.String("crawl-user-agent")
+	}
+	if ctx.IsSet("crawl-frontier") {
+		cfg.Crawl.Frontier = ctx.String("crawl-frontier")
+	}
+	if ctx.IsSet("crawl-resume") {
+		cfg.Crawl.Resume = ctx.Bool("crawl-resume")
+	}
+}
+
+// loadConfig layers the config file, its selected profile and explicitly set flags on top of the defaults
+func loadConfig(ctx *cli.Context, defaults app.Config) (app.Config, error) {
+	cfg := defaults
+
+	if path := ctx.String("config"); path != "" {
+		var err error
+		if cfg, err = app.LoadConfigFile(path, ctx.String("profile")); err != nil {
+			return app.Config{}, err
+		}
+	} else if ctx.String("profile") != "" {
+		return app.Config{}, errors.New("a profile can only be used along with a config file")
+	}
+
+	if err := applyFlags(ctx, &cfg); err != nil {
+		return app.Config{}, err
+	}
+
+	return cfg, nil
+}
+
+// applyFlags overrides config values with flags explicitly set from the command line or environment
+func applyFlags(ctx *cli.Context, cfg *app.Config) error {
+	if ctx.IsSet("fixture") {
+		paths := ctx.StringSlice("fixture")
+		cfg.Fixture.Path = paths[0]
+		cfg.Fixture.Paths = paths[1:]
+	}
+	if ctx.IsSet("fixture-format") {
+		cfg.Fixture.Format = ctx.String("fixture-format")
+	}
+	if ctx.IsSet("fixture-pages") {
+		cfg.Fixture.Pages = ctx.Bool("fixture-pages")
+	}
+	if ctx.IsSet("fixture-column") {
+		columns, err := applyMappings(cfg.Fixture.Columns, nil, ctx.StringSlice("fixture-column"))
+		if err != nil {
+			return err
+		}
+		cfg.Fixture.Columns = columns
+	}
+	if ctx.IsSet("batch-size") {
+		cfg.Fixture.BatchSize = ctx.Int("batch-size")
+	}
+	if ctx.IsSet("workers") {
+		cfg.Workers = ctx.Int("workers")
+	}
+	if ctx.IsSet("max-concurrent-downloads") {
+		cfg.MaxConcurrentDownloads = ctx.Int("max-concurrent-downloads")
+	}
+	if ctx.IsSet("adaptive") {
+		cfg.Adaptive.Enabled = ctx.Bool("adaptive")
+	}
+	if ctx.IsSet("adaptive-max") {
+		cfg.Adaptive.Max = ctx.Int("adaptive-max")
+	}
+	if ctx.IsSet("adaptive-host-initial") {
+		cfg.Adaptive.HostInitial = ctx.Int("adaptive-host-initial")
+	}
+	if ctx.IsSet("adaptive-host-max") {
+		cfg.Adaptive.HostMax = ctx.Int("adaptive-host-max")
+	}
+	if ctx.IsSet("adaptive-latency-target") {
+		cfg.Adaptive.LatencyTarget = ctx.Duration("adaptive-latency-target")
+	}
+	if ctx.IsSet("breaker") {
+		cfg.Breaker.Enabled = ctx.Bool("breaker")
+	}
+	if ctx.IsSet("breaker-failure-ratio") {
+		cfg.Breaker.FailureRatio = ctx.Float64("breaker-failure-ratio")
+	}
+	if ctx.IsSet("breaker-min-requests") {
+		cfg.Breaker.MinRequests = ctx.Int("breaker-min-requests")
+	}
+	if ctx.IsSet("breaker-window") {
+		cfg.Breaker.Window = ctx.Duration("breaker-window")
+	}
+	if ctx.IsSet("breaker-open-timeout") {
+		cfg.Breaker.OpenTimeout = ctx.Duration("breaker-open-timeout")
+	}
+	if ctx.IsSet("breaker-probes") {
+		cfg.Breaker.Probes = ctx.Int("breaker-probes")
+	}
+	if ctx.IsSet("admin-addr") {
+		cfg.Admin.Addr = ctx.String("admin-addr")
+	}
+	if ctx.IsSet("storage-backend") {
+		cfg.Storage.Backend = ctx.String("storage-backend")
+	}
+	if ctx.IsSet("storage-root") {
+		cfg.Storage.RootPath = ctx.String("storage-root")
+	}
+	if ctx.IsSet("storage-mode") {
+		cfg.Storage.Mode = ctx.String("storage-mode")
+	}
+	if ctx.IsSet("storage-sync") {
+		cfg.Storage.Sync = ctx.Bool("storage-sync")
+	}
+	if ctx.IsSet("s3-endpoint") {
+		cfg.Storage.S3.Endpoint = ctx.String("s3-endpoint")
+	}
+	if ctx.IsSet("s3-bucket") {
+		cfg.Storage.S3.Bucket = ctx.String("s3-bucket")
+	}
+	if ctx.IsSet("s3-region") {
+		cfg.Storage.S3.Region = ctx.String("s3-region")
+	}
+	if ctx.IsSet("s3-access-key-id") {
+		cfg.Storage.S3.AccessKeyID = ctx.String("s3-access-key-id")
+	}
+	if ctx.IsSet("s3-secret-access-key") {
+		cfg.Storage.S3.SecretAccessKey = ctx.String("s3-secret-access-key")
+	}
+	if ctx.IsSet("max-idle-conns") {
+		cfg.Transport.MaxIdleConns = ctx.Int("max-idle-conns")
+	}
+	if ctx.IsSet("max-idle-conns-per-host") {
+		cfg.Transport.MaxIdleConnsPerHost = ctx.Int("max-idle-conns-per-host")
+	}
+	if ctx.IsSet("max-conns-per-host") {
+		cfg.Transport.MaxConnsPerHost = ctx.Int("max-conns-per-host")
+	}
+	if ctx.IsSet("idle-conn-timeout") {
+		cfg.Transport.IdleConnTimeout = ctx.Duration("idle-conn-timeout")
+	}
+	if ctx.IsSet("http-timeout") {
+		cfg.Transport.Timeout = ctx.Duration("http-timeout")
+	}
+	if ctx.IsSet("retry-base-delay") {
+		cfg.Retry.BaseDelay = ctx.Duration("retry-base-delay")
+	}
+	if ctx.IsSet("retry-max-delay") {
+		cfg.Retry.MaxDelay = ctx.Duration("retry-max-delay")
+	}
+	if ctx.IsSet("retry-max-attempts") {
+		cfg.Retry.MaxAttempts = ctx.Int("retry-max-attempts")
+	}
+	if ctx.IsSet("retry-status-codes") {
+		cfg.Retry.StatusCodes = ctx.IntSlice("retry-status-codes")
+	}
+	if ctx.IsSet("journal") {
+		cfg.Journal.Path = ctx.String("journal")
+	}
+	if ctx.IsSet("resume") {
+		cfg.Journal.Resume = ctx.Bool("resume")
+	}
+	if ctx.IsSet("cache") {
+		cfg.Cache.Path = ctx.String("cache")
+	}
+	if ctx.IsSet("deadline") {
+		cfg.Deadline = ctx.Duration("deadline")
+	}
+	if ctx.IsSet("grace-period") {
+		cfg.Shutdown.GracePeriod = ctx.Duration("grace-period")
+	}
+	if ctx.IsSet("content-type") {
+		contentTypes, err := applyMappings(cfg.ContentTypes, imageDownloaderPkg.CommonImageContentTypeExtensions, ctx.StringSlice("content-type"))
+		if err != nil {
+			return err
+		}
+		cfg.ContentTypes = contentTypes
+	}
+	if ctx.IsSet("content-type-alias") {
+		aliases, err := applyMappings(cfg.ContentTypeAliases, imageDownloaderPkg.CommonImageContentTypeAliases, ctx.StringSlice("content-type-alias"))
+		if err != nil {
+			return err
+		}
+		cfg.ContentTypeAliases = aliases
+	}
+	if ctx.IsSet("sniff-policy") {
+		cfg.SniffPolicy = ctx.String("sniff-policy")
+	}
+	if ctx.IsSet("max-size") {
+		cfg.Size.Max = ctx.Int64("max-size")
+	}
+	if ctx.IsSet("min-size") {
+		cfg.Size.Min = ctx.Int64("min-size")
+	}
+	if ctx.IsSet("validate") {
+		cfg.Validation.Enabled = ctx.Bool("validate")
+	}
+	if ctx.IsSet("validate-fully") {
+		cfg.Validation.DecodeFully = ctx.Bool("validate-fully")
+	}
+	if ctx.IsSet("quarantine") {
+		cfg.Validation.Quarantine = ctx.String("quarantine")
+	}
+	if ctx.IsSet("min-width") {
+		cfg.Validation.MinWidth = ctx.Int("min-width")
+	}
+	if ctx.IsSet("min-height") {
+		cfg.Validation.MinHeight = ctx.Int("min-height")
+	}
+	if ctx.IsSet("max-width") {
+		cfg.Validation.MaxWidth = ctx.Int("max-width")
+	}
+	if ctx.IsSet("max-height") {
+		cfg.Validation.MaxHeight = ctx.Int("max-height")
+	}
+	if ctx.IsSet("report-format") {
+		cfg.Report.Format = ctx.String("report-format")
+	}
+	if ctx.IsSet("host-rate") {
+		cfg.HostLimits.Rate = ctx.Float64("host-rate")
+	}
+	if ctx.IsSet("host-burst") {
+		cfg.HostLimits.Burst = ctx.Int("host-burst")
+	}
+	if ctx.IsSet("host-max-in-flight") {
+		cfg.HostLimits.MaxInFlight = ctx.Int("host-max-in-flight")
+	}
+	if ctx.IsSet("host-limit") {
+		hosts := make(map[string]app.HostLimitConfig, len(cfg.HostLimits.Hosts))
+		for host, limit := range cfg.HostLimits.Hosts {
+			hosts[host] = limit
+		}
+
+		for _, value := range ctx.StringSlice("host-limit") {
+			host, limit, err := app.ParseHostLimit(value)
+			if err != nil {
+				return err
+			}
+			hosts[host] = limit
+		}
+
+		cfg.HostLimits.Hosts = hosts
+	}
+
+	return nil
+}
+
+// applyMappings adds key=value pairs on top of a copy of the configured mappings, or of the defaults when none are configured
+func applyMappings(mappings map[string]string, defaults map[string]string, values []string) (map[string]string, error) {
+	if mappings == nil {
+		mappings = defaults
+	}
+
+	result := make(map[string]string, len(mappings)+len(values))
+	for key, value := range mappings {
+		result[key] = value
+	}
+
+	for _, value := range values {
+		key, val, err := app.ParseMapping(value)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = val
+	}
+
+	return result, nil
+}
@@ -9,10 +9,44 @@ import (
 )
 
 func main() {
+	defaults := app.DefaultConfig()
+
+	start := func(ctx *cli.Context) error {
+		cfg, err := loadConfig(ctx, defaults)
+		if err != nil {
+			return err
+		}
+
+		return app.StartImageDownloaderApp(ctx.Context, cfg)
+	}
+
 	cliApp := cli.App{
-		Name: "start",
-		Action: func(ctx *cli.Context) error {
-			return app.StartImageDownloaderApp(ctx.Context)
+		Name:   "start",
+		Flags:  flags(defaults),
+		Action: start,
+		Commands: []*cli.Command{
+			{
+				Name:   "start",
+				Usage:  "download the images listed by the fixture",
+				Flags:  flags(defaults),
+				Action: start,
+			},
+			{
+				Name:      "crawl",
+				Usage:     "download the images of the pages crawled from seed urls, following links within their sites",
+				ArgsUsage: "<seed url>...",
+				Flags:     append(flags(defaults), crawlFlags(defaults)...),
+				Action: func(ctx *cli.Context) error {
+					cfg, err := loadConfig(ctx, defaults)
+					if err != nil {
+						return err
+					}
+
+					applyCrawlFlags(ctx, &cfg)
+
+					return app.StartCrawlerApp(ctx.Context, cfg)
+				},
+			},
 		},
 	}
 
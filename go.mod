@@ -3,10 +3,16 @@ module fachr.in/image-downloader
 go 1.20
 
 require (
+	github.com/klauspost/compress v1.17.9
 	github.com/oklog/ulid/v2 v2.1.0
 	github.com/stretchr/testify v1.8.4
 	github.com/urfave/cli/v2 v2.25.7
+	go.uber.org/goleak v1.2.0
 	go.uber.org/mock v0.2.0
+	go.uber.org/zap v1.25.0
+	golang.org/x/image v0.18.0
+	golang.org/x/net v0.35.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -16,6 +22,4 @@ require (
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
 	github.com/xrash/smetrics v0.0.0-20201216005158-039620a65673 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
-	go.uber.org/zap v1.25.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"fachr.in/image-downloader/internal/imagedownloader"
+	"fachr.in/image-downloader/pkg/logger"
+)
+
+type concurrencyBody struct {
+	Limit int `json:"limit"`
+	InUse int `json:"in_use"`
+}
+
+// newAdminHandler serves the admin api of a running job:
+// GET /concurrency returns the concurrency limit and how many downloads run,
+// PUT /concurrency with {"limit": n} resizes it right away, an adaptive limit then grows or backs off from n
+func newAdminHandler(imageDownloader *imagedownloader.ImageDownloader) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/concurrency", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var body concurrencyBody
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			// an adaptive limit is told about the new limit so it doesn't overwrite it on its next change
+			if err := imageDownloader.SetConcurrency(body.Limit); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			logger.Infof("concurrency limit changed to %d", body.Limit)
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		limit, inUse := imageDownloader.ConcurrencyUsage()
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(concurrencyBody{Limit: limit, InUse: inUse})
+	})
+
+	return mux
+}
+
+// startAdminServer listens before returning so a taken address fails the run at startup
+func startAdminServer(addr string, handler http.Handler) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &http.Server{Handler: handler}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Errorf("admin api stopped, err: %v", err)
+		}
+	}()
+
+	logger.Infof("admin api listening on %v", listener.Addr())
+	return server, nil
+}
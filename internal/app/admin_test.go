@@ -0,0 +1,94 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"fachr.in/image-downloader/internal/imagedownloader"
+	imageDownloaderPkg "fachr.in/image-downloader/pkg/imagedownloader"
+)
+
+func TestAdminHandler(t *testing.T) {
+	t.Run("returns the current concurrency limit", func(t *testing.T) {
+		handler := newAdminHandler(&imagedownloader.ImageDownloader{Concurrency: imagedownloader.NewSemaphore(8)})
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/concurrency", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"limit": 8, "in_use": 0}`, rec.Body.String())
+	})
+
+	t.Run("returns the resized concurrency limit", func(t *testing.T) {
+		concurrency := imagedownloader.NewSemaphore(8)
+		handler := newAdminHandler(&imagedownloader.ImageDownloader{Concurrency: concurrency})
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/concurrency", strings.NewReader(`{"limit": 2}`)))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"limit": 2, "in_use": 0}`, rec.Body.String())
+
+		limit, _ := concurrency.Usage()
+		assert.Equal(t, 2, limit)
+	})
+
+	t.Run("returns the resized concurrency limit the adaptive limit carries on from", func(t *testing.T) {
+		concurrency := imagedownloader.NewSemaphore(8)
+		adaptive := imageDownloaderPkg.NewAdaptiveLimit(imageDownloaderPkg.AdaptiveOption{Initial: 8, Min: 1, Max: 16})
+		handler := newAdminHandler(&imagedownloader.ImageDownloader{Concurrency: concurrency, Adaptive: adaptive})
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/concurrency", strings.NewReader(`{"limit": 2}`)))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"limit": 2, "in_use": 0}`, rec.Body.String())
+		assert.Equal(t, 2, adaptive.Limit())
+
+		// a whole limit of healthy downloads grows the limit set by the operator, not the one before it
+		adaptive.Observe(time.Millisecond, false)
+		limit, changed := adaptive.Observe(time.Millisecond, false)
+		assert.True(t, changed)
+		assert.Equal(t, 3, limit)
+	})
+
+	t.Run("returns bad request on a limit out of the adaptive limit bounds", func(t *testing.T) {
+		concurrency := imagedownloader.NewSemaphore(8)
+		adaptive := imageDownloaderPkg.NewAdaptiveLimit(imageDownloaderPkg.AdaptiveOption{Initial: 8, Min: 1, Max: 16})
+		handler := newAdminHandler(&imagedownloader.ImageDownloader{Concurrency: concurrency, Adaptive: adaptive})
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/concurrency", strings.NewReader(`{"limit": 32}`)))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, 8, adaptive.Limit())
+
+		limit, _ := concurrency.Usage()
+		assert.Equal(t, 8, limit)
+	})
+
+	t.Run("returns bad request on an invalid limit", func(t *testing.T) {
+		handler := newAdminHandler(&imagedownloader.ImageDownloader{Concurrency: imagedownloader.NewSemaphore(8)})
+
+		for _, body := range []string{`{"limit": 0}`, `limit`} {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/concurrency", strings.NewReader(body)))
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		}
+	})
+
+	t.Run("returns method not allowed on other methods", func(t *testing.T) {
+		handler := newAdminHandler(&imagedownloader.ImageDownloader{Concurrency: imagedownloader.NewSemaphore(8)})
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/concurrency", nil))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	})
+}
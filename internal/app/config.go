@@ -0,0 +1,532 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"fachr.in/image-downloader/internal/fixture"
+	"fachr.in/image-downloader/pkg/imagedownloader"
+)
+
+const (
+	unlimited = 0
+)
+
+const (
+	StorageBackendLocal = "local"
+	StorageBackendS3    = "s3"
+)
+
+const (
+	ReportFormatJSON   = "json"
+	ReportFormatNDJSON = "ndjson"
+)
+
+const (
+	StorageModeNamed            = "named"
+	StorageModeContentAddressed = "content-addressed"
+)
+
+type FieldError struct {
+	Field  string
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("invalid config %s: %s", e.Field, e.Reason)
+}
+
+type Config struct {
+	Fixture   FixtureConfig   `yaml:"fixture"`
+	Storage   StorageConfig   `yaml:"storage"`
+	Workers   int             `yaml:"workers"`
+	Transport TransportConfig `yaml:"transport"`
+	Retry     RetryConfig     `yaml:"retry"`
+	Journal   JournalConfig   `yaml:"journal"`
+	Report    ReportConfig    `yaml:"report"`
+
+	// MaxConcurrentDownloads bounds the images downloaded at once across the service whatever the batch size,
+	// 0 downloads workers × batch size images at once
+	MaxConcurrentDownloads int `yaml:"max_concurrent_downloads"`
+
+	// Adaptive grows the concurrency limit and the in-flight cap of every host while downloads stay healthy
+	// and backs them off on timeouts, 429s and 5xx responses
+	Adaptive AdaptiveConfig `yaml:"adaptive"`
+
+	// Breaker fails the urls of a host that keeps failing fast instead of retrying each of them
+	Breaker BreakerConfig `yaml:"breaker"`
+
+	// Crawl harvests the images of whole sites with the crawl command instead of reading them from the fixture
+	Crawl CrawlConfig `yaml:"crawl"`
+
+	// Admin serves an http api to adjust a running job
+	Admin AdminConfig `yaml:"admin"`
+
+	// Cache remembers the etag and last modified date of downloaded images to request them conditionally
+	Cache CacheConfig `yaml:"cache"`
+
+	// Deadline bounds the whole run, downloads still in flight once it is over are cancelled, 0 means unlimited
+	Deadline time.Duration `yaml:"deadline"`
+
+	// Shutdown decides how long in-flight downloads may finish once the run is interrupted
+	Shutdown ShutdownConfig `yaml:"shutdown"`
+
+	// Size bounds the accepted image size
+	Size SizeConfig `yaml:"size"`
+
+	// Validation decodes images before they are stored, rejecting corrupt ones and the ones out of the dimension limits
+	Validation ValidationConfig `yaml:"validation"`
+
+	// HostLimits throttles the requests each host receives, zero values mean unlimited
+	HostLimits HostLimitsConfig `yaml:"host_limits"`
+
+	// SniffPolicy reconciles the image format detected from the body with the content type header
+	SniffPolicy string `yaml:"sniff_policy"`
+
+	// ContentTypes maps accepted image media types to file extensions, nil accepts the common image types,
+	// a wildcard such as image/* gives the fallback extension of every other subtype
+	ContentTypes map[string]string `yaml:"content_types"`
+	// ContentTypeAliases maps media types to the one they stand for, nil uses the common image aliases
+	ContentTypeAliases map[string]string `yaml:"content_type_aliases"`
+}
+
+type FixtureConfig struct {
+	// Path and Paths are read in order, each is a file, a glob pattern, a directory or - for stdin
+	Path      string   `yaml:"path"`
+	Paths     []string `yaml:"paths"`
+	BatchSize int      `yaml:"batch_size"`
+	// Format is either text, csv or jsonl, empty picks it by the file extension
+	Format string `yaml:"format"`
+	// Columns maps record fields to the csv header naming them, e.g. url: Image URL
+	Columns map[string]string `yaml:"columns"`
+	// Pages reads the fixture urls as html pages or image sitemaps and downloads the images found on them
+	Pages bool `yaml:"pages"`
+}
+
+type StorageConfig struct {
+	Backend  string   `yaml:"backend"`
+	RootPath string   `yaml:"root"`
+	Mode     string   `yaml:"mode"`
+	Sync     bool     `yaml:"sync"`
+	S3       S3Config `yaml:"s3"`
+}
+
+type S3Config struct {
+	Endpoint        string `yaml:"endpoint"`
+	Bucket          string `yaml:"bucket"`
+	Region          string `yaml:"region"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+}
+
+type TransportConfig struct {
+	MaxIdleConns        int           `yaml:"max_idle_conns"`
+	MaxIdleConnsPerHost int           `yaml:"max_idle_conns_per_host"`
+	MaxConnsPerHost     int           `yaml:"max_conns_per_host"`
+	IdleConnTimeout     time.Duration `yaml:"idle_conn_timeout"`
+	Timeout             time.Duration `yaml:"timeout"`
+}
+
+type RetryConfig struct {
+	BaseDelay   time.Duration `yaml:"base_delay"`
+	MaxDelay    time.Duration `yaml:"max_delay"`
+	MaxAttempts int           `yaml:"max_attempts"`
+	StatusCodes []int         `yaml:"status_codes"`
+}
+
+type JournalConfig struct {
+	Path   string `yaml:"path"`
+	Resume bool   `yaml:"resume"`
+}
+
+type CrawlConfig struct {
+	// Seeds are the pages the crawl starts from, only pages of their sites are followed
+	Seeds []string `yaml:"seeds"`
+	// MaxDepth is how many links away from a seed a page may be, 0 only visits the seeds
+	MaxDepth int `yaml:"max_depth"`
+	// MaxPages is the page budget of the crawl, pages visited before a resume included
+	MaxPages int `yaml:"max_pages"`
+	// Delay is the least time between two requests to the same host, a longer robots.txt crawl-delay wins
+	Delay time.Duration `yaml:"delay"`
+	// UserAgent is sent with every page request and picks the robots.txt rules applying to the crawl
+	UserAgent string `yaml:"user_agent"`
+	// Frontier is the file persisting the pages to crawl, empty keeps them in memory
+	Frontier string `yaml:"frontier"`
+	// Resume continues the crawl of an existing frontier instead of starting over
+	Resume bool `yaml:"resume"`
+}
+
+type CacheConfig struct {
+	// Path is the cache file, empty downloads every image in full
+	Path string `yaml:"path"`
+}
+
+type AdaptiveConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Min and Max bound the concurrency limit, which starts at max_concurrent_downloads
+	Min int `yaml:"min"`
+	Max int `yaml:"max"`
+	// HostInitial and HostMax bound the in-flight cap of every host, the max_in_flight of a host caps it further
+	HostInitial int `yaml:"host_initial"`
+	HostMax     int `yaml:"host_max"`
+	// LatencyTarget is the response time above which limits stop growing, 0 ignores latency
+	LatencyTarget time.Duration `yaml:"latency_target"`
+}
+
+type BreakerConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// FailureRatio is the share of failed requests within window that opens the circuit of a host,
+	// once at least min_requests were made
+	FailureRatio float64       `yaml:"failure_ratio"`
+	MinRequests  int           `yaml:"min_requests"`
+	Window       time.Duration `yaml:"window"`
+	// OpenTimeout is how long an open circuit fails fast before probes test the host again
+	OpenTimeout time.Duration `yaml:"open_timeout"`
+	Probes      int           `yaml:"probes"`
+}
+
+type AdminConfig struct {
+	// Addr is the address the admin api listens on, empty disables it
+	Addr string `yaml:"addr"`
+}
+
+type ShutdownConfig struct {
+	// GracePeriod is how long in-flight downloads may finish after the first interrupt, 0 waits for them
+	// until a second interrupt
+	GracePeriod time.Duration `yaml:"grace_period"`
+}
+
+type ReportConfig struct {
+	// Format is either json, one document printed at the end, or ndjson, one line streamed per image
+	Format string `yaml:"format"`
+}
+
+type SizeConfig struct {
+	// Max and Min are given in bytes, 0 means unlimited
+	Max int64 `yaml:"max"`
+	Min int64 `yaml:"min"`
+}
+
+type ValidationConfig struct {
+	Enabled     bool `yaml:"enabled"`
+	DecodeFully bool `yaml:"decode_fully"`
+	// Quarantine is the storage key prefix corrupt images are kept under, empty drops them
+	Quarantine string `yaml:"quarantine"`
+	MinWidth   int    `yaml:"min_width"`
+	MinHeight  int    `yaml:"min_height"`
+	MaxWidth   int    `yaml:"max_width"`
+	MaxHeight  int    `yaml:"max_height"`
+}
+
+type HostLimitsConfig struct {
+	HostLimitConfig `yaml:",inline"`
+
+	// Hosts overrides the limits of single hosts, an override replaces every default limit
+	Hosts map[string]HostLimitConfig `yaml:"hosts"`
+}
+
+type HostLimitConfig struct {
+	Rate        float64 `yaml:"rate"`
+	Burst       int     `yaml:"burst"`
+	MaxInFlight int     `yaml:"max_in_flight"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Fixture: FixtureConfig{
+			Path:      "/fixtures/images.txt",
+			BatchSize: 25,
+		},
+		Storage: StorageConfig{
+			Backend:  StorageBackendLocal,
+			RootPath: "/downloads",
+			Mode:     StorageModeNamed,
+			S3: S3Config{
+				Region: "us-east-1",
+			},
+		},
+		Workers: 10,
+		Transport: TransportConfig{
+			MaxIdleConns:        250,
+			MaxIdleConnsPerHost: 25,
+			MaxConnsPerHost:     unlimited,
+			IdleConnTimeout:     unlimited,
+			Timeout:             time.Duration(60) * time.Second,
+		},
+		Retry: RetryConfig{
+			BaseDelay:   time.Duration(50) * time.Millisecond,
+			MaxDelay:    time.Duration(3) * time.Second,
+			MaxAttempts: 3,
+			StatusCodes: imagedownloader.DefaultRetryableStatusCodes,
+		},
+		Report: ReportConfig{
+			Format: ReportFormatJSON,
+		},
+		Adaptive: AdaptiveConfig{
+			Min:           1,
+			Max:           1000,
+			HostInitial:   4,
+			HostMax:       64,
+			LatencyTarget: time.Duration(2) * time.Second,
+		},
+		Breaker: BreakerConfig{
+			FailureRatio: 0.5,
+			MinRequests:  20,
+			Window:       time.Duration(1) * time.Minute,
+			OpenTimeout:  time.Duration(30) * time.Second,
+			Probes:       3,
+		},
+		Crawl: CrawlConfig{
+			MaxDepth:  2,
+			MaxPages:  1000,
+			Delay:     time.Duration(1) * time.Second,
+			UserAgent: "imagedownloader",
+		},
+		Shutdown: ShutdownConfig{
+			GracePeriod: time.Duration(30) * time.Second,
+		},
+		SniffPolicy: imagedownloader.SniffPolicyDetect,
+	}
+}
+
+func (c Config) Validate() error {
+	switch {
+	case c.Fixture.Path == "" && len(c.Fixture.Paths) == 0:
+		return &FieldError{Field: "fixture.path", Reason: "must not be empty unless fixture.paths is set"}
+	case c.Fixture.BatchSize <= 0:
+		return &FieldError{Field: "fixture.batch_size", Reason: "must be greater than 0"}
+	case c.Fixture.Format != "" && c.Fixture.Format != fixture.FormatText && c.Fixture.Format != fixture.FormatCSV && c.Fixture.Format != fixture.FormatJSONL:
+		return &FieldError{Field: "fixture.format", Reason: fmt.Sprintf("must be either %s, %s or %s", fixture.FormatText, fixture.FormatCSV, fixture.FormatJSONL)}
+	case c.Storage.Backend != StorageBackendLocal && c.Storage.Backend != StorageBackendS3:
+		return &FieldError{Field: "storage.backend", Reason: fmt.Sprintf("must be either %s or %s", StorageBackendLocal, StorageBackendS3)}
+	case c.Storage.Backend == StorageBackendLocal && c.Storage.RootPath == "":
+		return &FieldError{Field: "storage.root", Reason: "must not be empty"}
+	case c.Storage.Backend == StorageBackendS3 && c.Storage.S3.Endpoint == "":
+		return &FieldError{Field: "storage.s3.endpoint", Reason: "must not be empty"}
+	case c.Storage.Backend == StorageBackendS3 && c.Storage.S3.Bucket == "":
+		return &FieldError{Field: "storage.s3.bucket", Reason: "must not be empty"}
+	case c.Storage.Backend == StorageBackendS3 && c.Storage.S3.Region == "":
+		return &FieldError{Field: "storage.s3.region", Reason: "must not be empty"}
+	case c.Storage.Mode != StorageModeNamed && c.Storage.Mode != StorageModeContentAddressed:
+		return &FieldError{Field: "storage.mode", Reason: fmt.Sprintf("must be either %s or %s", StorageModeNamed, StorageModeContentAddressed)}
+	case c.Workers <= 0:
+		return &FieldError{Field: "workers", Reason: "must be greater than 0"}
+	case c.MaxConcurrentDownloads < 0:
+		return &FieldError{Field: "max_concurrent_downloads", Reason: "must not be negative"}
+	case c.Adaptive.Min <= 0:
+		return &FieldError{Field: "adaptive.min", Reason: "must be greater than 0"}
+	case c.Adaptive.Max < c.Adaptive.Min:
+		return &FieldError{Field: "adaptive.max", Reason: "must not be less than adaptive.min"}
+	case c.Adaptive.HostInitial <= 0:
+		return &FieldError{Field: "adaptive.host_initial", Reason: "must be greater than 0"}
+	case c.Adaptive.HostMax < c.Adaptive.HostInitial:
+		return &FieldError{Field: "adaptive.host_max", Reason: "must not be less than adaptive.host_initial"}
+	case c.Adaptive.LatencyTarget < 0:
+		return &FieldError{Field: "adaptive.latency_target", Reason: "must not be negative"}
+	case c.Breaker.FailureRatio <= 0 || c.Breaker.FailureRatio > 1:
+		return &FieldError{Field: "breaker.failure_ratio", Reason: "must be greater than 0 and at most 1"}
+	case c.Breaker.MinRequests <= 0:
+		return &FieldError{Field: "breaker.min_requests", Reason: "must be greater than 0"}
+	case c.Breaker.Window < 0:
+		return &FieldError{Field: "breaker.window", Reason: "must not be negative"}
+	case c.Breaker.OpenTimeout <= 0:
+		return &FieldError{Field: "breaker.open_timeout", Reason: "must be greater than 0"}
+	case c.Breaker.Probes <= 0:
+		return &FieldError{Field: "breaker.probes", Reason: "must be greater than 0"}
+	case c.Transport.MaxIdleConns < 0:
+		return &FieldError{Field: "transport.max_idle_conns", Reason: "must not be negative"}
+	case c.Transport.MaxIdleConnsPerHost < 0:
+		return &FieldError{Field: "transport.max_idle_conns_per_host", Reason: "must not be negative"}
+	case c.Transport.MaxConnsPerHost < 0:
+		return &FieldError{Field: "transport.max_conns_per_host", Reason: "must not be negative"}
+	case c.Transport.IdleConnTimeout < 0:
+		return &FieldError{Field: "transport.idle_conn_timeout", Reason: "must not be negative"}
+	case c.Transport.Timeout < 0:
+		return &FieldError{Field: "transport.timeout", Reason: "must not be negative"}
+	case c.Retry.BaseDelay < 0:
+		return &FieldError{Field: "retry.base_delay", Reason: "must not be negative"}
+	case c.Retry.MaxDelay < c.Retry.BaseDelay:
+		return &FieldError{Field: "retry.max_delay", Reason: "must not be less than retry.base_delay"}
+	case c.Retry.MaxAttempts < 0:
+		return &FieldError{Field: "retry.max_attempts", Reason: "must not be negative"}
+	case !validStatusCodes(c.Retry.StatusCodes):
+		return &FieldError{Field: "retry.status_codes", Reason: "must only contain http status codes"}
+	case c.Journal.Resume && c.Journal.Path == "":
+		return &FieldError{Field: "journal.path", Reason: "must not be empty when resuming"}
+	case c.Crawl.MaxDepth < 0:
+		return &FieldError{Field: "crawl.max_depth", Reason: "must not be negative"}
+	case c.Crawl.MaxPages <= 0:
+		return &FieldError{Field: "crawl.max_pages", Reason: "must be greater than 0"}
+	case c.Crawl.Delay < 0:
+		return &FieldError{Field: "crawl.delay", Reason: "must not be negative"}
+	case c.Crawl.UserAgent == "":
+		return &FieldError{Field: "crawl.user_agent", Reason: "must not be empty"}
+	case c.Crawl.Resume && c.Crawl.Frontier == "":
+		return &FieldError{Field: "crawl.frontier", Reason: "must not be empty when resuming"}
+	case c.Deadline < 0:
+		return &FieldError{Field: "deadline", Reason: "must not be negative"}
+	case c.Shutdown.GracePeriod < 0:
+		return &FieldError{Field: "shutdown.grace_period", Reason: "must not be negative"}
+	case c.SniffPolicy != imagedownloader.SniffPolicyHeader && c.SniffPolicy != imagedownloader.SniffPolicyDetect && c.SniffPolicy != imagedownloader.SniffPolicyStrict:
+		return &FieldError{Field: "sniff_policy", Reason: fmt.Sprintf("must be either %s, %s or %s", imagedownloader.SniffPolicyHeader, imagedownloader.SniffPolicyDetect, imagedownloader.SniffPolicyStrict)}
+	case c.Size.Min < 0:
+		return &FieldError{Field: "size.min", Reason: "must not be negative"}
+	case c.Size.Max != unlimited && c.Size.Max < c.Size.Min:
+		return &FieldError{Field: "size.max", Reason: "must not be less than size.min"}
+	case c.Validation.MinWidth < 0:
+		return &FieldError{Field: "validation.min_width", Reason: "must not be negative"}
+	case c.Validation.MinHeight < 0:
+		return &FieldError{Field: "validation.min_height", Reason: "must not be negative"}
+	case c.Validation.MaxWidth != unlimited && c.Validation.MaxWidth < c.Validation.MinWidth:
+		return &FieldError{Field: "validation.max_width", Reason: "must not be less than validation.min_width"}
+	case c.Validation.MaxHeight != unlimited && c.Validation.MaxHeight < c.Validation.MinHeight:
+		return &FieldError{Field: "validation.max_height", Reason: "must not be less than validation.min_height"}
+	case c.Report.Format != ReportFormatJSON && c.Report.Format != ReportFormatNDJSON:
+		return &FieldError{Field: "report.format", Reason: fmt.Sprintf("must be either %s or %s", ReportFormatJSON, ReportFormatNDJSON)}
+	}
+
+	fields := make([]string, 0, len(c.Fixture.Columns))
+	for field := range c.Fixture.Columns {
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		if !fixture.ValidField(field) {
+			return &FieldError{Field: "fixture.columns." + field, Reason: "must be a record field, either id, url, filename, category or sha256"}
+		}
+	}
+
+	if err := c.HostLimits.HostLimitConfig.validate("host_limits."); err != nil {
+		return err
+	}
+
+	hosts := make([]string, 0, len(c.HostLimits.Hosts))
+	for host := range c.HostLimits.Hosts {
+		hosts = append(hosts, host)
+	}
+
+	sort.Strings(hosts)
+
+	for _, host := range hosts {
+		if host == "" {
+			return &FieldError{Field: "host_limits.hosts", Reason: "host must not be empty"}
+		}
+
+		if err := c.HostLimits.Hosts[host].validate("host_limits.hosts." + host + "."); err != nil {
+			return err
+		}
+	}
+
+	contentTypes := make([]string, 0, len(c.ContentTypes))
+	for contentType := range c.ContentTypes {
+		contentTypes = append(contentTypes, contentType)
+	}
+
+	// validate in a stable order so the reported field is deterministic
+	sort.Strings(contentTypes)
+
+	for _, contentType := range contentTypes {
+		if contentType == "" {
+			return &FieldError{Field: "content_types", Reason: "content type must not be empty"}
+		}
+
+		if imagedownloader.ParseMediaType(contentType) == "" {
+			return &FieldError{Field: "content_types." + contentType, Reason: "must be a media type such as image/png or image/*"}
+		}
+
+		if ext := c.ContentTypes[contentType]; !strings.HasPrefix(ext, ".") {
+			return &FieldError{Field: "content_types." + contentType, Reason: "extension must start with a dot"}
+		}
+	}
+
+	aliases := make([]string, 0, len(c.ContentTypeAliases))
+	for alias := range c.ContentTypeAliases {
+		aliases = append(aliases, alias)
+	}
+
+	sort.Strings(aliases)
+
+	for _, alias := range aliases {
+		if imagedownloader.ParseMediaType(alias) == "" {
+			return &FieldError{Field: "content_type_aliases", Reason: fmt.Sprintf("%q must be a media type", alias)}
+		}
+
+		if imagedownloader.ParseMediaType(c.ContentTypeAliases[alias]) == "" {
+			return &FieldError{Field: "content_type_aliases." + alias, Reason: "must be a media type"}
+		}
+	}
+
+	return nil
+}
+
+// ParseMapping reads a key=value pair given on the command line, e.g. image/jpg=image/jpeg
+func ParseMapping(value string) (string, string, error) {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" || val == "" {
+		return "", "", fmt.Errorf("invalid mapping %q: must be key=value", value)
+	}
+
+	return key, val, nil
+}
+
+func (h HostLimitConfig) validate(prefix string) error {
+	switch {
+	case h.Rate < 0:
+		return &FieldError{Field: prefix + "rate", Reason: "must not be negative"}
+	case h.Burst < 0:
+		return &FieldError{Field: prefix + "burst", Reason: "must not be negative"}
+	case h.MaxInFlight < 0:
+		return &FieldError{Field: prefix + "max_in_flight", Reason: "must not be negative"}
+	}
+
+	return nil
+}
+
+// ParseHostLimit reads a host override given as host=rate[/burst[/max_in_flight]], e.g. www.imfdb.org=2/4/8
+func ParseHostLimit(value string) (string, HostLimitConfig, error) {
+	host, limits, ok := strings.Cut(value, "=")
+	if !ok || host == "" {
+		return "", HostLimitConfig{}, fmt.Errorf("invalid host limit %q: must be host=rate[/burst[/max_in_flight]]", value)
+	}
+
+	var limit HostLimitConfig
+	var err error
+
+	parts := strings.Split(limits, "/")
+	if len(parts) > 3 {
+		return "", HostLimitConfig{}, fmt.Errorf("invalid host limit %q: must be host=rate[/burst[/max_in_flight]]", value)
+	}
+
+	if limit.Rate, err = strconv.ParseFloat(parts[0], 64); err != nil {
+		return "", HostLimitConfig{}, fmt.Errorf("invalid host limit %q rate: %w", value, err)
+	}
+
+	if len(parts) > 1 {
+		if limit.Burst, err = strconv.Atoi(parts[1]); err != nil {
+			return "", HostLimitConfig{}, fmt.Errorf("invalid host limit %q burst: %w", value, err)
+		}
+	}
+
+	if len(parts) > 2 {
+		if limit.MaxInFlight, err = strconv.Atoi(parts[2]); err != nil {
+			return "", HostLimitConfig{}, fmt.Errorf("invalid host limit %q max in flight: %w", value, err)
+		}
+	}
+
+	return strings.ToLower(host), limit, nil
+}
+
+func validStatusCodes(statusCodes []int) bool {
+	for _, statusCode := range statusCodes {
+		if statusCode < 100 || statusCode > 599 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,128 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	t.Run("returns no error on default config", func(t *testing.T) {
+		assert.NoError(t, DefaultConfig().Validate())
+	})
+
+	t.Run("returns no error on fixture paths without a path", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Fixture.Path = ""
+		cfg.Fixture.Paths = []string{"-", "/fixtures/*.csv.gz"}
+
+		assert.NoError(t, cfg.Validate())
+	})
+
+	t.Run("returns field error on invalid values", func(t *testing.T) {
+		testCases := map[string]func(cfg *Config){
+			"fixture.path":       func(cfg *Config) { cfg.Fixture.Path = "" },
+			"fixture.batch_size": func(cfg *Config) { cfg.Fixture.BatchSize = 0 },
+			"fixture.format":     func(cfg *Config) { cfg.Fixture.Format = "xml" },
+			"fixture.columns.link": func(cfg *Config) {
+				cfg.Fixture.Columns = map[string]string{"url": "Image URL", "link": "Link"}
+			},
+			"storage.root":    func(cfg *Config) { cfg.Storage.RootPath = "" },
+			"storage.backend": func(cfg *Config) { cfg.Storage.Backend = "ftp" },
+			"storage.s3.bucket": func(cfg *Config) {
+				cfg.Storage.Backend, cfg.Storage.S3.Endpoint = StorageBackendS3, "http://localhost:9000"
+			},
+			"storage.mode":                 func(cfg *Config) { cfg.Storage.Mode = "s3" },
+			"workers":                      func(cfg *Config) { cfg.Workers = -1 },
+			"max_concurrent_downloads":     func(cfg *Config) { cfg.MaxConcurrentDownloads = -1 },
+			"adaptive.min":                 func(cfg *Config) { cfg.Adaptive.Min = 0 },
+			"adaptive.max":                 func(cfg *Config) { cfg.Adaptive.Max = 0 },
+			"adaptive.host_max":            func(cfg *Config) { cfg.Adaptive.HostMax = 1 },
+			"adaptive.latency_target":      func(cfg *Config) { cfg.Adaptive.LatencyTarget = -time.Second },
+			"breaker.failure_ratio":        func(cfg *Config) { cfg.Breaker.FailureRatio = 1.5 },
+			"breaker.min_requests":         func(cfg *Config) { cfg.Breaker.MinRequests = 0 },
+			"breaker.open_timeout":         func(cfg *Config) { cfg.Breaker.OpenTimeout = 0 },
+			"breaker.probes":               func(cfg *Config) { cfg.Breaker.Probes = 0 },
+			"crawl.max_depth":              func(cfg *Config) { cfg.Crawl.MaxDepth = -1 },
+			"crawl.max_pages":              func(cfg *Config) { cfg.Crawl.MaxPages = 0 },
+			"crawl.delay":                  func(cfg *Config) { cfg.Crawl.Delay = -time.Second },
+			"crawl.user_agent":             func(cfg *Config) { cfg.Crawl.UserAgent = "" },
+			"crawl.frontier":               func(cfg *Config) { cfg.Crawl.Resume = true },
+			"transport.max_idle_conns":     func(cfg *Config) { cfg.Transport.MaxIdleConns = -1 },
+			"transport.timeout":            func(cfg *Config) { cfg.Transport.Timeout = -time.Second },
+			"retry.max_delay":              func(cfg *Config) { cfg.Retry.MaxDelay = time.Millisecond },
+			"retry.status_codes":           func(cfg *Config) { cfg.Retry.StatusCodes = []int{503, 1000} },
+			"retry.max_attempts":           func(cfg *Config) { cfg.Retry.MaxAttempts = -1 },
+			"transport.max_conns_per_host": func(cfg *Config) { cfg.Transport.MaxConnsPerHost = -1 },
+			"journal.path":                 func(cfg *Config) { cfg.Journal.Resume = true },
+			"shutdown.grace_period":        func(cfg *Config) { cfg.Shutdown.GracePeriod = -time.Second },
+			"deadline":                     func(cfg *Config) { cfg.Deadline = -time.Second },
+			"content_types.image/x-foo":    func(cfg *Config) { cfg.ContentTypes = map[string]string{"image/x-foo": "foo"} },
+			"content_types.image":          func(cfg *Config) { cfg.ContentTypes = map[string]string{"image": ".img"} },
+			"content_type_aliases.image/jpg": func(cfg *Config) {
+				cfg.ContentTypeAliases = map[string]string{"image/jpg": "jpeg"}
+			},
+			"sniff_policy":         func(cfg *Config) { cfg.SniffPolicy = "guess" },
+			"size.min":             func(cfg *Config) { cfg.Size.Min = -1 },
+			"size.max":             func(cfg *Config) { cfg.Size.Min, cfg.Size.Max = 100, 10 },
+			"validation.min_width": func(cfg *Config) { cfg.Validation.MinWidth = -1 },
+			"validation.max_height": func(cfg *Config) {
+				cfg.Validation.MinHeight, cfg.Validation.MaxHeight = 100, 10
+			},
+			"report.format":    func(cfg *Config) { cfg.Report.Format = "xml" },
+			"host_limits.rate": func(cfg *Config) { cfg.HostLimits.Rate = -1 },
+			"host_limits.hosts.a.com.max_in_flight": func(cfg *Config) {
+				cfg.HostLimits.Hosts = map[string]HostLimitConfig{"a.com": {MaxInFlight: -1}}
+			},
+		}
+
+		for field, mutate := range testCases {
+			cfg := DefaultConfig()
+			mutate(&cfg)
+
+			var fieldErr *FieldError
+			assert.ErrorAs(t, cfg.Validate(), &fieldErr)
+			assert.Equal(t, field, fieldErr.Field)
+		}
+	})
+}
+
+func TestParseHostLimit(t *testing.T) {
+	t.Run("returns host and its limits", func(t *testing.T) {
+		host, limit, err := ParseHostLimit("WWW.imfdb.org=2.5/4/8")
+		assert.NoError(t, err)
+		assert.Equal(t, "www.imfdb.org", host)
+		assert.Equal(t, HostLimitConfig{Rate: 2.5, Burst: 4, MaxInFlight: 8}, limit)
+	})
+
+	t.Run("returns host with only its rate", func(t *testing.T) {
+		host, limit, err := ParseHostLimit("a.com=10")
+		assert.NoError(t, err)
+		assert.Equal(t, "a.com", host)
+		assert.Equal(t, HostLimitConfig{Rate: 10}, limit)
+	})
+
+	t.Run("returns error on malformed values", func(t *testing.T) {
+		for _, value := range []string{"a.com", "=1", "a.com=x", "a.com=1/x", "a.com=1/2/x", "a.com=1/2/3/4"} {
+			_, _, err := ParseHostLimit(value)
+			assert.Error(t, err, value)
+		}
+	})
+}
+
+func TestParseMapping(t *testing.T) {
+	t.Run("returns key and value", func(t *testing.T) {
+		key, value, err := ParseMapping("image/*=.img")
+		assert.NoError(t, err)
+		assert.Equal(t, "image/*", key)
+		assert.Equal(t, ".img", value)
+	})
+
+	t.Run("returns error on malformed values", func(t *testing.T) {
+		for _, value := range []string{"image/png", "=.png", "image/png="} {
+			_, _, err := ParseMapping(value)
+			assert.Error(t, err, value)
+		}
+	})
+}
@@ -0,0 +1,166 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	errorLinePattern = regexp.MustCompile(`^line (\d+): (.*)$`)
+)
+
+type configFile struct {
+	Config   `yaml:",inline"`
+	Profiles map[string]yaml.Node `yaml:"profiles"`
+}
+
+// LoadConfigFile reads a yaml config file on top of the default config and applies the named profile, if any
+func LoadConfigFile(path string, profile string) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(b, &root); err != nil {
+		return Config{}, err
+	}
+
+	// the default fixture path is only filled in once neither the file nor the profile lists a fixture,
+	// otherwise it would be read ahead of the fixture paths the file lists
+	file := configFile{Config: DefaultConfig()}
+	file.Config.Fixture.Path = ""
+
+	if err := decodeStrict(b, &file, fieldPaths(&root, "")); err != nil {
+		return Config{}, err
+	}
+
+	// a profile might fix an invalid base value, so the config is only validated once the profile is applied
+	if profile == "" {
+		file.Config = withDefaultFixture(file.Config)
+
+		if err := file.Config.Validate(); err != nil {
+			return Config{}, err
+		}
+
+		return file.Config, nil
+	}
+
+	node, ok := file.Profiles[profile]
+	if !ok {
+		return Config{}, &FieldError{Field: "profiles." + profile, Reason: "profile is not defined"}
+	}
+
+	b, err = yaml.Marshal(&node)
+	if err != nil {
+		return Config{}, err
+	}
+
+	// re-parse the profile so its field paths line up with the marshaled lines
+	var profileRoot yaml.Node
+	if err := yaml.Unmarshal(b, &profileRoot); err != nil {
+		return Config{}, err
+	}
+
+	// the profile is decoded into the base config so only the fields it lists are overridden
+	prefix := "profiles." + profile + "."
+	profilePaths := fieldPaths(&profileRoot, prefix)
+	cfg := file.Config
+
+	if err := decodeStrict(b, &cfg, profilePaths); err != nil {
+		return Config{}, err
+	}
+
+	cfg = withDefaultFixture(cfg)
+
+	if err := cfg.Validate(); err != nil {
+		// an invalid value is blamed on the profile when the profile sets it
+		var fieldErr *FieldError
+		if errors.As(err, &fieldErr) && hasPath(profilePaths, prefix+fieldErr.Field) {
+			return Config{}, &FieldError{Field: prefix + fieldErr.Field, Reason: fieldErr.Reason}
+		}
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+func decodeStrict(b []byte, out interface{}, paths map[int]string) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	decoder.KnownFields(true)
+
+	err := decoder.Decode(out)
+
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) || len(typeErr.Errors) == 0 {
+		return err
+	}
+
+	// yaml only reports line numbers, translate the first one into the field path defined at that line
+	match := errorLinePattern.FindStringSubmatch(typeErr.Errors[0])
+	if match == nil {
+		return err
+	}
+
+	line, _ := strconv.Atoi(match[1])
+	if path, ok := paths[line]; ok {
+		return &FieldError{Field: path, Reason: match[2]}
+	}
+
+	return fmt.Errorf("invalid config at line %d: %s", line, match[2])
+}
+
+func withDefaultFixture(cfg Config) Config {
+	if cfg.Fixture.Path == "" && len(cfg.Fixture.Paths) == 0 {
+		cfg.Fixture.Path = DefaultConfig().Fixture.Path
+	}
+
+	return cfg
+}
+
+// hasPath tells whether path is one of the field paths of a config file
+func hasPath(paths map[int]string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fieldPaths indexes the dotted field path of every mapping key by the line it is defined at
+func fieldPaths(node *yaml.Node, prefix string) map[int]string {
+	paths := make(map[int]string)
+
+	var walk func(node *yaml.Node, prefix string)
+	walk = func(node *yaml.Node, prefix string) {
+		switch node.Kind {
+		case yaml.DocumentNode:
+			for _, child := range node.Content {
+				walk(child, prefix)
+			}
+		case yaml.MappingNode:
+			for idx := 0; idx+1 < len(node.Content); idx += 2 {
+				key, value := node.Content[idx], node.Content[idx+1]
+				path := prefix + key.Value
+
+				paths[key.Line] = path
+				if value.Line != key.Line {
+					paths[value.Line] = path
+				}
+
+				walk(value, path+".")
+			}
+		}
+	}
+
+	walk(node, prefix)
+	return paths
+}
@@ -0,0 +1,101 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	t.Run("returns error on a non existing file", func(t *testing.T) {
+		_, err := LoadConfigFile("./testdata/non_existing.yaml", "")
+		assert.Error(t, err)
+	})
+
+	t.Run("returns base config layered on top of the defaults", func(t *testing.T) {
+		cfg, err := LoadConfigFile("./testdata/config.yaml", "")
+		assert.NoError(t, err)
+		assert.Equal(t, "./fixtures/images.txt", cfg.Fixture.Path)
+		assert.Equal(t, 50, cfg.Fixture.BatchSize)
+		assert.Equal(t, 4, cfg.Workers)
+		assert.Equal(t, time.Duration(100)*time.Millisecond, cfg.Retry.BaseDelay)
+		assert.Equal(t, 5, cfg.Retry.MaxAttempts)
+		assert.Equal(t, DefaultConfig().Transport, cfg.Transport)
+		assert.Equal(t, map[string]string{"image/jpeg": ".jpg", "image/png": ".png"}, cfg.ContentTypes)
+		assert.Equal(t, HostLimitsConfig{
+			HostLimitConfig: HostLimitConfig{MaxInFlight: 25},
+			Hosts:           map[string]HostLimitConfig{"www.imfdb.org": {Rate: 2, Burst: 4, MaxInFlight: 8}},
+		}, cfg.HostLimits)
+	})
+
+	t.Run("returns profile config layered on top of the base config", func(t *testing.T) {
+		cfg, err := LoadConfigFile("./testdata/config.yaml", "cdn-fast")
+		assert.NoError(t, err)
+		assert.Equal(t, 50, cfg.Fixture.BatchSize)
+		assert.Equal(t, 40, cfg.Workers)
+		assert.Equal(t, 100, cfg.Transport.MaxIdleConnsPerHost)
+		assert.Equal(t, DefaultConfig().Transport.MaxIdleConns, cfg.Transport.MaxIdleConns)
+		assert.Equal(t, time.Duration(100)*time.Millisecond, cfg.Retry.BaseDelay)
+		assert.Equal(t, 1, cfg.Retry.MaxAttempts)
+	})
+
+	t.Run("returns fixture paths without the default fixture path", func(t *testing.T) {
+		cfg, err := LoadConfigFile("./testdata/fixture_paths.yaml", "")
+		assert.NoError(t, err)
+		assert.Equal(t, "", cfg.Fixture.Path)
+		assert.Equal(t, []string{"./fixtures/a.txt", "./fixtures/b.txt"}, cfg.Fixture.Paths)
+
+		cfg, err = LoadConfigFile("./testdata/fixture_paths.yaml", "single")
+		assert.NoError(t, err)
+		assert.Equal(t, "./fixtures/c.txt", cfg.Fixture.Path)
+		assert.Equal(t, []string{"./fixtures/a.txt", "./fixtures/b.txt"}, cfg.Fixture.Paths)
+	})
+
+	t.Run("returns the default fixture path when the file lists no fixture", func(t *testing.T) {
+		cfg, err := LoadConfigFile("./testdata/no_fixture.yaml", "")
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultConfig().Fixture.Path, cfg.Fixture.Path)
+		assert.Empty(t, cfg.Fixture.Paths)
+	})
+
+	t.Run("returns field error on an undefined profile", func(t *testing.T) {
+		_, err := LoadConfigFile("./testdata/config.yaml", "cdn-slow")
+		assert.EqualError(t, err, "invalid config profiles.cdn-slow: profile is not defined")
+	})
+
+	t.Run("returns field error on an invalid profile value", func(t *testing.T) {
+		_, err := LoadConfigFile("./testdata/config.yaml", "broken")
+		assert.EqualError(t, err, "invalid config profiles.broken.retry.max_attempts: must not be negative")
+	})
+
+	t.Run("returns profile config fixing an invalid base value", func(t *testing.T) {
+		cfg, err := LoadConfigFile("./testdata/invalid_base.yaml", "fixed")
+		assert.NoError(t, err)
+		assert.Equal(t, 8, cfg.Workers)
+	})
+
+	t.Run("returns field error on an invalid base value a profile leaves as is", func(t *testing.T) {
+		_, err := LoadConfigFile("./testdata/invalid_base.yaml", "unfixed")
+		assert.EqualError(t, err, "invalid config workers: must be greater than 0")
+
+		_, err = LoadConfigFile("./testdata/invalid_base.yaml", "")
+		assert.EqualError(t, err, "invalid config workers: must be greater than 0")
+	})
+
+	t.Run("returns field error on a mistyped value", func(t *testing.T) {
+		_, err := LoadConfigFile("./testdata/invalid_type.yaml", "")
+
+		var fieldErr *FieldError
+		assert.ErrorAs(t, err, &fieldErr)
+		assert.Equal(t, "retry.max_attempts", fieldErr.Field)
+	})
+
+	t.Run("returns field error on an unknown field", func(t *testing.T) {
+		_, err := LoadConfigFile("./testdata/unknown_field.yaml", "")
+
+		var fieldErr *FieldError
+		assert.ErrorAs(t, err, &fieldErr)
+		assert.Equal(t, "transport.max_idle_connections", fieldErr.Field)
+	})
+}
@@ -2,63 +2,352 @@ package app
 
 import (
 	"context"
-	"io"
 	"net/http"
 	"os"
-	"time"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/oklog/ulid/v2"
 
+	"fachr.in/image-downloader/internal/crawler"
 	"fachr.in/image-downloader/internal/fixture"
 	"fachr.in/image-downloader/internal/imagedownloader"
-	"fachr.in/image-downloader/internal/util"
+	"fachr.in/image-downloader/internal/journal"
 	imageDownloaderPkg "fachr.in/image-downloader/pkg/imagedownloader"
 	"fachr.in/image-downloader/pkg/logger"
 )
 
-const (
-	unlimited = 0
-)
+// loaderFn builds the loader of the urls to download, stop is closed once no download must start anymore
+type loaderFn func(httpClient *imageDownloaderPkg.HTTPClient, stop <-chan struct{}) fixture.Loader
 
-func StartImageDownloaderApp(ctx context.Context) error {
+func StartImageDownloaderApp(ctx context.Context, cfg Config) error {
 	logger.Init()
 
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	return startApp(ctx, cfg, func(httpClient *imageDownloaderPkg.HTTPClient, stop <-chan struct{}) fixture.Loader {
+		return newFixtureLoader(cfg, httpClient, stop)
+	})
+}
+
+// StartCrawlerApp downloads the images of the pages crawled from the seeds instead of those of the fixture
+func StartCrawlerApp(ctx context.Context, cfg Config) error {
+	logger.Init()
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	if len(cfg.Crawl.Seeds) == 0 {
+		return &FieldError{Field: "crawl.seeds", Reason: "must not be empty"}
+	}
+
+	frontier := crawler.NewFrontier()
+
+	if cfg.Crawl.Frontier != "" {
+		var err error
+		if frontier, err = crawler.OpenFrontier(cfg.Crawl.Frontier, cfg.Crawl.Resume); err != nil {
+			return err
+		}
+	}
+
+	defer frontier.Close()
+
+	return startApp(ctx, cfg, func(httpClient *imageDownloaderPkg.HTTPClient, stop <-chan struct{}) fixture.Loader {
+		return &crawler.Crawler{
+			Seeds:     cfg.Crawl.Seeds,
+			MaxDepth:  cfg.Crawl.MaxDepth,
+			MaxPages:  cfg.Crawl.MaxPages,
+			Delay:     cfg.Crawl.Delay,
+			UserAgent: cfg.Crawl.UserAgent,
+			// pages are fetched with the same retries and host breaker as the images found on them
+			Client:    httpClient,
+			Frontier:  frontier,
+			BatchSize: cfg.Fixture.BatchSize,
+			Stop:      stop,
+		}
+	})
+}
+
+func startApp(ctx context.Context, cfg Config, newLoader loaderFn) error {
+	var cache imageDownloaderPkg.CacheStore
+
+	if cfg.Cache.Path != "" {
+		fileCache, err := imageDownloaderPkg.OpenFileCacheStore(cfg.Cache.Path)
+		if err != nil {
+			return err
+		}
+
+		defer fileCache.Close()
+		cache = fileCache
+	}
+
+	if cfg.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Deadline)
+		defer cancel()
+	}
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	// the report of an interrupted run still covers every url, the unprocessed ones as cancelled
+	stop, ctx, abort := shutdownOnSignals(ctx, signals, cfg.Shutdown.GracePeriod)
+	defer abort()
+
+	imageDownloader := newImageDownloader(cfg, cache, func(httpClient *imageDownloaderPkg.HTTPClient) fixture.Loader {
+		return newLoader(httpClient, stop)
+	})
+
+	imageDownloader.Stop = stop
+
+	if cfg.Journal.Path != "" {
+		downloadJournal, err := journal.Open(cfg.Journal.Path, cfg.Journal.Resume)
+		if err != nil {
+			return err
+		}
+
+		defer downloadJournal.Close()
+		imageDownloader.Journal = downloadJournal
+	}
+
+	if cfg.Admin.Addr != "" {
+		adminServer, err := startAdminServer(cfg.Admin.Addr, newAdminHandler(imageDownloader))
+		if err != nil {
+			return err
+		}
+
+		defer adminServer.Close()
+	}
+
+	_, err := imageDownloader.DownloadAllImages(ctx)
+	return err
+}
+
+func NewImageDownloader(cfg Config, cache imageDownloaderPkg.CacheStore) *imagedownloader.ImageDownloader {
+	return newImageDownloader(cfg, cache, func(httpClient *imageDownloaderPkg.HTTPClient) fixture.Loader {
+		return newFixtureLoader(cfg, httpClient, nil)
+	})
+}
+
+func newImageDownloader(cfg Config, cache imageDownloaderPkg.CacheStore, newLoader func(httpClient *imageDownloaderPkg.HTTPClient) fixture.Loader) *imagedownloader.ImageDownloader {
+	contentTypes := newContentTypeRegistry(cfg)
+	concurrency := maxConcurrentDownloads(cfg)
+
+	httpClient := &imageDownloaderPkg.HTTPClient{
+		BaseClient: newHTTPClient(cfg),
+		RetryOption: imageDownloaderPkg.RetryOption{
+			BaseDelay:            cfg.Retry.BaseDelay,
+			MaxDelay:             cfg.Retry.MaxDelay,
+			MaxAttempts:          cfg.Retry.MaxAttempts,
+			RetryableStatusCodes: cfg.Retry.StatusCodes,
+		},
+		ContentTypes: contentTypes,
+		SniffPolicy:  cfg.SniffPolicy,
+	}
+
+	hostLimiter := newHostLimiter(cfg)
+
+	client := &imageDownloaderPkg.Client{
+		HTTPClient:       httpClient,
+		Storage:          newStorage(cfg),
+		CreateTempFileFn: os.CreateTemp,
+		ContentAddressed: cfg.Storage.Mode == StorageModeContentAddressed,
+		HostLimiter:      hostLimiter,
+		QuarantinePrefix: cfg.Validation.Quarantine,
+		MaxSize:          cfg.Size.Max,
+		MinSize:          cfg.Size.Min,
+		Cache:            cache,
+	}
+
+	// a nil validator must stay a nil interface so images are stored without validation
+	if validator := newValidator(cfg); validator != nil {
+		client.Validator = validator
+	}
+
+	var adaptive *imageDownloaderPkg.AdaptiveLimit
+
+	if cfg.Adaptive.Enabled {
+		adaptive = imageDownloaderPkg.NewAdaptiveLimit(imageDownloaderPkg.AdaptiveOption{
+			Initial:       concurrency,
+			Min:           cfg.Adaptive.Min,
+			Max:           cfg.Adaptive.Max,
+			LatencyTarget: cfg.Adaptive.LatencyTarget,
+		})
+
+		// the limit starts within its bounds
+		concurrency = adaptive.Limit()
+	}
+
 	imageDownloader := &imagedownloader.ImageDownloader{
-		FixtureLoader: &fixture.Fixture{
-			Path:      "/fixtures/images.txt",
-			BatchSize: 25,
+		FixtureLoader:    newLoader(httpClient),
+		DownloaderClient: client,
+		Reporter:         newReporter(cfg),
+		UlidMakerFn:      ulid.Make,
+		// the queue holds as many urls as may be downloaded at once so every host gets its fair share
+		QueueSize:    concurrency,
+		Concurrency:  imagedownloader.NewSemaphore(concurrency),
+		Adaptive:     adaptive,
+		ContentTypes: contentTypes,
+		// hosts are skipped by the scheduler once out of slots rather than hold a concurrency slot in the client
+		HostLimiter: hostLimiter,
+	}
+
+	// a nil breaker must stay a nil interface so requests are always sent
+	if breaker := newBreaker(cfg); breaker != nil {
+		httpClient.Breaker = breaker
+		imageDownloader.Breaker = breaker
+	}
+
+	return imageDownloader
+}
+
+func maxConcurrentDownloads(cfg Config) int {
+	if cfg.MaxConcurrentDownloads > 0 {
+		return cfg.MaxConcurrentDownloads
+	}
+
+	// every worker used to download a batch of images at once
+	return cfg.Workers * cfg.Fixture.BatchSize
+}
+
+func newContentTypeRegistry(cfg Config) *imageDownloaderPkg.ContentTypeRegistry {
+	extensions := cfg.ContentTypes
+	if extensions == nil {
+		extensions = imageDownloaderPkg.CommonImageContentTypeExtensions
+	}
+
+	aliases := cfg.ContentTypeAliases
+	if aliases == nil {
+		aliases = imageDownloaderPkg.CommonImageContentTypeAliases
+	}
+
+	return imageDownloaderPkg.NewContentTypeRegistry(extensions, aliases)
+}
+
+func newReporter(cfg Config) imagedownloader.Reporter {
+	if cfg.Report.Format == ReportFormatNDJSON {
+		return imagedownloader.NewNDJSONReporter(os.Stdout)
+	}
+
+	return imagedownloader.NewOutputReporter(os.Stdout)
+}
+
+func newHTTPClient(cfg Config) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			MaxIdleConns:        cfg.Transport.MaxIdleConns,
+			MaxIdleConnsPerHost: cfg.Transport.MaxIdleConnsPerHost,
+			MaxConnsPerHost:     cfg.Transport.MaxConnsPerHost,
+			IdleConnTimeout:     cfg.Transport.IdleConnTimeout,
 		},
-		DownloaderClient: &imageDownloaderPkg.Client{
-			HTTPClient: &imageDownloaderPkg.HTTPClient{
-				BaseClient: &http.Client{
-					Transport: &http.Transport{
-						MaxIdleConns:        250,
-						MaxIdleConnsPerHost: 25,
-						MaxConnsPerHost:     unlimited,
-						IdleConnTimeout:     unlimited,
-					},
-					Timeout: time.Duration(60) * time.Second,
-				},
-				RetryOption: imageDownloaderPkg.RetryOption{
-					BaseDelay:   time.Duration(50) * time.Millisecond,
-					MaxDelay:    time.Duration(3) * time.Second,
-					MaxAttempts: 3,
-				},
-				AcceptedImageContentTypeExtensions: imageDownloaderPkg.CommonImageContentTypeExtensions,
-			},
-			CreateFileFn: os.Create,
-			CopyFileFn:   io.Copy,
+		Timeout: cfg.Transport.Timeout,
+	}
+}
+
+func newValidator(cfg Config) *imageDownloaderPkg.ImageValidator {
+	v := cfg.Validation
+
+	// a dimension limit is pointless without validation, so setting one enables it
+	if !v.Enabled && !v.DecodeFully && v.MinWidth == 0 && v.MinHeight == 0 && v.MaxWidth == 0 && v.MaxHeight == 0 {
+		return nil
+	}
+
+	return &imageDownloaderPkg.ImageValidator{
+		DecodeFully: v.DecodeFully,
+		MinWidth:    v.MinWidth,
+		MinHeight:   v.MinHeight,
+		MaxWidth:    v.MaxWidth,
+		MaxHeight:   v.MaxHeight,
+	}
+}
+
+func newFixtureLoader(cfg Config, httpClient *imageDownloaderPkg.HTTPClient, stop <-chan struct{}) fixture.Loader {
+	loader := &fixture.Fixture{
+		Path:      cfg.Fixture.Path,
+		Paths:     cfg.Fixture.Paths,
+		BatchSize: cfg.Fixture.BatchSize,
+		Format:    cfg.Fixture.Format,
+		Columns:   cfg.Fixture.Columns,
+	}
+
+	if !cfg.Fixture.Pages {
+		return loader
+	}
+
+	// pages are fetched with the same retries and host breaker as the images found on them
+	return &fixture.PageLoader{
+		Pages:     loader,
+		Client:    httpClient,
+		BatchSize: cfg.Fixture.BatchSize,
+		Stop:      stop,
+	}
+}
+
+func newBreaker(cfg Config) *imageDownloaderPkg.HostBreaker {
+	if !cfg.Breaker.Enabled {
+		return nil
+	}
+
+	return &imageDownloaderPkg.HostBreaker{
+		Option: imageDownloaderPkg.BreakerOption{
+			FailureRatio:   cfg.Breaker.FailureRatio,
+			MinRequests:    cfg.Breaker.MinRequests,
+			Window:         cfg.Breaker.Window,
+			OpenTimeout:    cfg.Breaker.OpenTimeout,
+			HalfOpenProbes: cfg.Breaker.Probes,
 		},
-		UlidMakerFn:                      ulid.Make,
-		Workers:                          10,
-		StorageRootPath:                  "/downloads",
-		CommonImageContentTypeExtensions: imageDownloaderPkg.CommonImageContentTypeExtensions,
+	}
+}
+
+func newHostLimiter(cfg Config) *imageDownloaderPkg.HostLimiter {
+	overrides := make(map[string]imageDownloaderPkg.HostLimit, len(cfg.HostLimits.Hosts))
+	for host, limit := range cfg.HostLimits.Hosts {
+		overrides[strings.ToLower(host)] = hostLimit(limit)
 	}
 
-	out, err := imageDownloader.DownloadAllImages(ctx)
-	if err != nil {
-		return err
+	limiter := &imageDownloaderPkg.HostLimiter{
+		Default:   hostLimit(cfg.HostLimits.HostLimitConfig),
+		Overrides: overrides,
 	}
 
-	return util.JsonStdout(out)
+	if cfg.Adaptive.Enabled {
+		limiter.Adaptive = &imageDownloaderPkg.AdaptiveOption{
+			Initial:       cfg.Adaptive.HostInitial,
+			Max:           cfg.Adaptive.HostMax,
+			LatencyTarget: cfg.Adaptive.LatencyTarget,
+		}
+	}
+
+	return limiter
+}
+
+func hostLimit(limit HostLimitConfig) imageDownloaderPkg.HostLimit {
+	return imageDownloaderPkg.HostLimit{
+		Rate:        limit.Rate,
+		Burst:       limit.Burst,
+		MaxInFlight: limit.MaxInFlight,
+	}
+}
+
+func newStorage(cfg Config) imageDownloaderPkg.Storage {
+	if cfg.Storage.Backend == StorageBackendS3 {
+		return &imageDownloaderPkg.S3Storage{
+			HTTPClient:      newHTTPClient(cfg),
+			Endpoint:        cfg.Storage.S3.Endpoint,
+			Bucket:          cfg.Storage.S3.Bucket,
+			Region:          cfg.Storage.S3.Region,
+			AccessKeyID:     cfg.Storage.S3.AccessKeyID,
+			SecretAccessKey: cfg.Storage.S3.SecretAccessKey,
+		}
+	}
+
+	return &imageDownloaderPkg.LocalStorage{
+		RootPath: cfg.Storage.RootPath,
+		Sync:     cfg.Storage.Sync,
+	}
 }
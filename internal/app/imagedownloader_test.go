@@ -0,0 +1,111 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"fachr.in/image-downloader/internal/fixture"
+	imageDownloaderPkg "fachr.in/image-downloader/pkg/imagedownloader"
+)
+
+func TestNewImageDownloader(t *testing.T) {
+	t.Run("returns client without validator by default", func(t *testing.T) {
+		imageDownloader := NewImageDownloader(DefaultConfig(), nil)
+
+		client := imageDownloader.DownloaderClient.(*imageDownloaderPkg.Client)
+		assert.Nil(t, client.Validator)
+	})
+
+	t.Run("returns client with validator once a dimension limit is set", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Validation.MinWidth = 16
+
+		imageDownloader := NewImageDownloader(cfg, nil)
+
+		client := imageDownloader.DownloaderClient.(*imageDownloaderPkg.Client)
+		assert.Equal(t, &imageDownloaderPkg.ImageValidator{MinWidth: 16}, client.Validator)
+	})
+
+	t.Run("returns http client without breaker by default", func(t *testing.T) {
+		imageDownloader := NewImageDownloader(DefaultConfig(), nil)
+
+		client := imageDownloader.DownloaderClient.(*imageDownloaderPkg.Client)
+		assert.Nil(t, client.HTTPClient.(*imageDownloaderPkg.HTTPClient).Breaker)
+		assert.Nil(t, imageDownloader.Breaker)
+	})
+
+	t.Run("returns http client sharing its breaker with the summary once enabled", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Breaker.Enabled = true
+
+		imageDownloader := NewImageDownloader(cfg, nil)
+
+		client := imageDownloader.DownloaderClient.(*imageDownloaderPkg.Client)
+		assert.NotNil(t, imageDownloader.Breaker)
+		assert.Equal(t, imageDownloader.Breaker, client.HTTPClient.(*imageDownloaderPkg.HTTPClient).Breaker)
+	})
+
+	t.Run("returns fixture loader reading image urls by default", func(t *testing.T) {
+		imageDownloader := NewImageDownloader(DefaultConfig(), nil)
+
+		assert.IsType(t, &fixture.Fixture{}, imageDownloader.FixtureLoader)
+	})
+
+	t.Run("returns page loader fetching pages through the http client once enabled", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Fixture.Pages = true
+
+		imageDownloader := NewImageDownloader(cfg, nil)
+
+		client := imageDownloader.DownloaderClient.(*imageDownloaderPkg.Client)
+		loader := imageDownloader.FixtureLoader.(*fixture.PageLoader)
+		assert.Equal(t, client.HTTPClient, loader.Client)
+		assert.Equal(t, cfg.Fixture.Path, loader.Pages.(*fixture.Fixture).Path)
+	})
+}
+
+func TestNewImageDownloader_Concurrency(t *testing.T) {
+	t.Run("returns workers × batch size as the concurrency limit by default", func(t *testing.T) {
+		limit, _ := NewImageDownloader(DefaultConfig(), nil).Concurrency.Usage()
+		assert.Equal(t, 250, limit)
+	})
+
+	t.Run("returns max concurrent downloads as the concurrency limit whatever the batch size", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.MaxConcurrentDownloads = 16
+		cfg.Fixture.BatchSize = 1000
+
+		imageDownloader := NewImageDownloader(cfg, nil)
+
+		limit, _ := imageDownloader.Concurrency.Usage()
+		assert.Equal(t, 16, limit)
+		assert.Equal(t, 16, imageDownloader.QueueSize)
+	})
+	t.Run("returns adaptive concurrency limit starting within its bounds once enabled", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Adaptive.Enabled = true
+		cfg.Adaptive.Max = 100
+
+		imageDownloader := NewImageDownloader(cfg, nil)
+
+		limit, _ := imageDownloader.Concurrency.Usage()
+		assert.Equal(t, 100, limit)
+		assert.Equal(t, 100, imageDownloader.Adaptive.Limit())
+	})
+
+	t.Run("returns no adaptive limit by default", func(t *testing.T) {
+		assert.Nil(t, NewImageDownloader(DefaultConfig(), nil).Adaptive)
+	})
+}
+
+func TestStartCrawlerApp(t *testing.T) {
+	t.Run("returns field error on a crawl without seeds", func(t *testing.T) {
+		err := StartCrawlerApp(context.Background(), DefaultConfig())
+
+		var fieldErr *FieldError
+		assert.ErrorAs(t, err, &fieldErr)
+		assert.Equal(t, "crawl.seeds", fieldErr.Field)
+	})
+}
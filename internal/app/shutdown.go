@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"fachr.in/image-downloader/pkg/logger"
+)
+
+// shutdownOnSignals returns a stop channel closed on the first signal, once no download must start anymore,
+// and a context canceled on the second signal or once the grace period of in-flight downloads is over,
+// a zero grace period waits for the second signal
+func shutdownOnSignals(ctx context.Context, signals <-chan os.Signal, gracePeriod time.Duration) (<-chan struct{}, context.Context, context.CancelFunc) {
+	ctx, abort := context.WithCancel(ctx)
+	stop := make(chan struct{})
+
+	go func() {
+		select {
+		case sig := <-signals:
+			logger.Infof("received %v, finishing in-flight downloads, send it again to abort", sig)
+			close(stop)
+		case <-ctx.Done():
+			return
+		}
+
+		var gracePeriodOver <-chan time.Time
+
+		if gracePeriod > 0 {
+			timer := time.NewTimer(gracePeriod)
+			defer timer.Stop()
+			gracePeriodOver = timer.C
+		}
+
+		select {
+		case sig := <-signals:
+			logger.Infof("received %v again, aborting in-flight downloads", sig)
+		case <-gracePeriodOver:
+			logger.Infof("grace period of %v is over, aborting in-flight downloads", gracePeriod)
+		case <-ctx.Done():
+		}
+
+		abort()
+	}()
+
+	return stop, ctx, abort
+}
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestShutdownOnSignals(t *testing.T) {
+	t.Run("returns closed stop channel on the first signal and aborts on the second one", func(t *testing.T) {
+		signals := make(chan os.Signal, 1)
+		stop, ctx, abort := shutdownOnSignals(context.Background(), signals, 0)
+		defer abort()
+
+		signals <- os.Interrupt
+		assert.Eventually(t, func() bool { return isClosed(stop) }, time.Second, time.Millisecond)
+		assert.NoError(t, ctx.Err())
+
+		signals <- syscall.SIGTERM
+		assert.Eventually(t, func() bool { return ctx.Err() != nil }, time.Second, time.Millisecond)
+	})
+
+	t.Run("returns aborted context once the grace period is over", func(t *testing.T) {
+		signals := make(chan os.Signal, 1)
+		stop, ctx, abort := shutdownOnSignals(context.Background(), signals, 10*time.Millisecond)
+		defer abort()
+
+		signals <- os.Interrupt
+		<-ctx.Done()
+		assert.True(t, isClosed(stop))
+	})
+
+	t.Run("returns open stop channel when aborted without a signal", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+
+		stop, ctx, abort := shutdownOnSignals(context.Background(), make(chan os.Signal), time.Second)
+		abort()
+
+		<-ctx.Done()
+		assert.False(t, isClosed(stop))
+	})
+}
+
+func isClosed(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
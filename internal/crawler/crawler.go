@@ -0,0 +1,274 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"fachr.in/image-downloader/internal/fixture"
+	"fachr.in/image-downloader/pkg/logger"
+)
+
+const (
+	// maxRobotsSize is how much of a robots.txt is read at most
+	maxRobotsSize = 512 << 10
+)
+
+var (
+	ErrInvalidSeed = errors.New("seed is not a http or https url")
+)
+
+type pageClient interface {
+	Fetch(req *http.Request) (*http.Response, error)
+}
+
+// Crawler visits the pages of the sites its seeds belong to, following links up to MaxDepth, and executes
+// the image urls found on them, it is a fixture loader of its own
+type Crawler struct {
+	Seeds []string
+	// MaxDepth is how many links away from a seed a page may be, 0 only visits the seeds
+	MaxDepth int
+	// MaxPages is the page budget of the crawl, pages visited before a resume included
+	MaxPages int
+	// Delay is the least time between two requests to the same host, a longer robots.txt crawl-delay wins
+	Delay time.Duration
+	// UserAgent is sent with every page request and picks the robots.txt group applying to the crawler
+	UserAgent string
+	Client    pageClient
+	Frontier  *Frontier
+	BatchSize int
+	// Stop ends the crawl, the image urls found so far are still executed
+	Stop <-chan struct{}
+
+	robots    map[string]*Robots
+	lastFetch map[string]time.Time
+}
+
+func (c *Crawler) LoadExecute(ctx context.Context, batchExecutor func(records []fixture.Record) error) error {
+	c.robots = make(map[string]*Robots)
+	c.lastFetch = make(map[string]time.Time)
+
+	sites := make(map[string]bool)
+
+	for _, seed := range c.Seeds {
+		u, err := url.Parse(seed)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: %s", ErrInvalidSeed, seed)
+		}
+
+		sites[siteOf(u)] = true
+
+		if _, err := c.Frontier.Push(seed, 0); err != nil {
+			return err
+		}
+	}
+
+	batcher := fixture.NewBatcher(c.BatchSize, batchExecutor)
+	seenImages := make(map[string]bool)
+
+	execute := func(page Page, imageUrls []string) error {
+		for _, imageUrl := range imageUrls {
+			if seenImages[imageUrl] {
+				continue
+			}
+
+			seenImages[imageUrl] = true
+
+			if err := batcher.Add(fixture.Record{Url: imageUrl, Source: page.Url}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	// the images of pages visited before an interruption might never have been downloaded, the journal
+	// tells those downloaded already
+	for _, page := range c.Frontier.Resumed() {
+		if c.stopping() {
+			break
+		}
+
+		if err := execute(page, page.Images); err != nil {
+			return err
+		}
+	}
+
+	for !c.stopping() && c.Frontier.Visited() < c.MaxPages {
+		page, ok := c.Frontier.Pop()
+		if !ok {
+			break
+		}
+
+		extracted, state, err := c.crawl(ctx, page)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+
+			// a page failing to load doesn't stop the crawl, it still counts against the budget
+			logger.Errorf("could not crawl page: %v, err: %v", page.Url, err)
+		}
+
+		// the images are recorded along with the page so a resumed crawl executes them again
+		if err := c.Frontier.Done(page.Url, state, extracted.Images); err != nil {
+			return err
+		}
+
+		if err := execute(page, extracted.Images); err != nil {
+			return err
+		}
+
+		if page.Depth >= c.MaxDepth {
+			continue
+		}
+
+		for _, link := range extracted.Links {
+			if u, err := url.Parse(link); err == nil && sites[siteOf(u)] {
+				if _, err := c.Frontier.Push(link, page.Depth+1); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// execute remaining records
+	return batcher.Flush()
+}
+
+// crawl visits a page robots.txt allows and returns its images and links, a linked image is an image of its own
+func (c *Crawler) crawl(ctx context.Context, page Page) (fixture.Page, PageState, error) {
+	u, err := url.Parse(page.Url)
+	if err != nil {
+		return fixture.Page{}, PageVisited, err
+	}
+
+	robots, err := c.robotsOf(ctx, u)
+	if err != nil {
+		return fixture.Page{}, PageVisited, err
+	}
+
+	if !robots.Allowed(u.RequestURI()) {
+		logger.Infof("skip page disallowed by robots.txt: %v", page.Url)
+		return fixture.Page{}, PageSkipped, nil
+	}
+
+	resp, err := c.fetch(ctx, u, robots.CrawlDelay)
+	if err != nil {
+		return fixture.Page{}, PageVisited, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fixture.Page{}, PageVisited, fmt.Errorf("%w: %d", fixture.ErrPageStatus, resp.StatusCode)
+	}
+
+	base := u
+	if resp.Request != nil {
+		base = resp.Request.URL
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		return fixture.Page{Images: []string{base.String()}}, PageVisited, nil
+	case mediaType == "" || mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		extracted, err := fixture.ExtractPage(base, io.LimitReader(resp.Body, fixture.MaxPageSize))
+		return extracted, PageVisited, err
+	default:
+		return fixture.Page{}, PageVisited, nil
+	}
+}
+
+// robotsOf returns the robots.txt of the site of u, read once per site: a missing one allows everything
+// and one failing to load disallows everything
+func (c *Crawler) robotsOf(ctx context.Context, u *url.URL) (*Robots, error) {
+	origin := u.Scheme + "://" + u.Host
+
+	if robots, ok := c.robots[origin]; ok {
+		return robots, nil
+	}
+
+	robotsUrl := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+
+	var robots *Robots
+
+	resp, err := c.fetch(ctx, robotsUrl, c.Delay)
+	switch {
+	case err != nil && ctx.Err() != nil:
+		return nil, ctx.Err()
+	case err != nil:
+		logger.Errorf("could not read robots.txt, site is not crawled: %v, err: %v", origin, err)
+		robots = &Robots{disallowAll: true}
+	case resp.StatusCode >= http.StatusInternalServerError:
+		logger.Errorf("could not read robots.txt, site is not crawled: %v, status: %d", origin, resp.StatusCode)
+		robots = &Robots{disallowAll: true}
+	case resp.StatusCode >= http.StatusBadRequest:
+		robots = &Robots{}
+	default:
+		robots = ParseRobots(io.LimitReader(resp.Body, maxRobotsSize), c.UserAgent)
+	}
+
+	if resp != nil {
+		resp.Body.Close()
+	}
+
+	c.robots[origin] = robots
+	return robots, nil
+}
+
+// fetch requests u once the delay since the last request to its host is over
+func (c *Crawler) fetch(ctx context.Context, u *url.URL, crawlDelay time.Duration) (*http.Response, error) {
+	delay := c.Delay
+	if crawlDelay > delay {
+		delay = crawlDelay
+	}
+
+	if wait := time.Until(c.lastFetch[u.Host].Add(delay)); wait > 0 {
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+
+	defer func() {
+		c.lastFetch[u.Host] = time.Now()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	return c.Client.Fetch(req)
+}
+
+func (c *Crawler) stopping() bool {
+	select {
+	case <-c.Stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// siteOf tells the site of a url by its host, www. or not
+func siteOf(u *url.URL) string {
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
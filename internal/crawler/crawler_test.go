@@ -0,0 +1,296 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"fachr.in/image-downloader/internal/fixture"
+)
+
+type fetchFn func(req *http.Request) (*http.Response, error)
+
+func (f fetchFn) Fetch(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestCrawler_LoadExecute(t *testing.T) {
+	ctx := context.Background()
+
+	var mutex sync.Mutex
+	var requested []string
+	var userAgents []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "User-agent: *\nDisallow: /secret\n")
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<img src="/a.jpg"><a href="/gallery">gallery</a><a href="/secret">secret</a><a href="https://b.com/">elsewhere</a>`)
+	})
+	mux.HandleFunc("/gallery", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<img src="/a.jpg"><img src="/b.jpg"><a href="/big.png">big</a><a href="/gallery/2">next</a>`)
+	})
+	mux.HandleFunc("/gallery/2", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<img src="/c.jpg">`)
+	})
+	mux.HandleFunc("/big.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+	})
+	mux.HandleFunc("/secret", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<img src="/secret.jpg">`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := fetchFn(func(req *http.Request) (*http.Response, error) {
+		mutex.Lock()
+		requested = append(requested, req.URL.Path)
+		userAgents = append(userAgents, req.Header.Get("User-Agent"))
+		mutex.Unlock()
+
+		return http.DefaultClient.Do(req)
+	})
+
+	reset := func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		requested, userAgents = nil, nil
+	}
+
+	collect := func(crawler *Crawler) ([]fixture.Record, error) {
+		var collectedRecords []fixture.Record
+
+		err := crawler.LoadExecute(ctx, func(records []fixture.Record) error {
+			collectedRecords = append(collectedRecords, records...)
+			return nil
+		})
+
+		return collectedRecords, err
+	}
+
+	t.Run("returns images of the same site pages within the depth allowed by robots.txt", func(t *testing.T) {
+		defer reset()
+
+		crawler := &Crawler{
+			Seeds:     []string{server.URL + "/"},
+			MaxDepth:  1,
+			MaxPages:  10,
+			UserAgent: "imagedownloader",
+			Client:    client,
+			Frontier:  NewFrontier(),
+			BatchSize: 2,
+		}
+
+		records, err := collect(crawler)
+		assert.NoError(t, err)
+		assert.Equal(t, []fixture.Record{
+			{Url: server.URL + "/a.jpg", Source: server.URL + "/"},
+			{Url: server.URL + "/b.jpg", Source: server.URL + "/gallery"},
+		}, records)
+		assert.Equal(t, []string{"/robots.txt", "/", "/gallery"}, requested)
+		assert.Equal(t, []string{"imagedownloader", "imagedownloader", "imagedownloader"}, userAgents)
+		assert.Equal(t, 2, crawler.Frontier.Visited())
+	})
+
+	t.Run("returns linked images of deeper pages", func(t *testing.T) {
+		defer reset()
+
+		crawler := &Crawler{
+			Seeds:     []string{server.URL + "/"},
+			MaxDepth:  2,
+			MaxPages:  10,
+			Client:    client,
+			Frontier:  NewFrontier(),
+			BatchSize: 10,
+		}
+
+		records, err := collect(crawler)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{server.URL + "/a.jpg", server.URL + "/b.jpg", server.URL + "/big.png", server.URL + "/c.jpg"}, urlsOf(records))
+		assert.NotContains(t, requested, "/secret")
+	})
+
+	t.Run("returns images of as many pages as the budget allows", func(t *testing.T) {
+		defer reset()
+
+		crawler := &Crawler{
+			Seeds:     []string{server.URL + "/"},
+			MaxDepth:  2,
+			MaxPages:  1,
+			Client:    client,
+			Frontier:  NewFrontier(),
+			BatchSize: 10,
+		}
+
+		records, err := collect(crawler)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{server.URL + "/a.jpg"}, urlsOf(records))
+	})
+
+	t.Run("returns images of the pages left by a resumed crawl", func(t *testing.T) {
+		defer reset()
+
+		path := filepath.Join(t.TempDir(), "frontier.jsonl")
+
+		frontier, err := OpenFrontier(path, false)
+		assert.NoError(t, err)
+
+		_, err = collect(&Crawler{Seeds: []string{server.URL + "/"}, MaxDepth: 2, MaxPages: 1, Client: client, Frontier: frontier, BatchSize: 10})
+		assert.NoError(t, err)
+		assert.NoError(t, frontier.Close())
+
+		frontier, err = OpenFrontier(path, true)
+		assert.NoError(t, err)
+		defer frontier.Close()
+
+		records, err := collect(&Crawler{Seeds: []string{server.URL + "/"}, MaxDepth: 2, MaxPages: 2, Client: client, Frontier: frontier, BatchSize: 10})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{server.URL + "/a.jpg", server.URL + "/b.jpg"}, urlsOf(records))
+		assert.Equal(t, 1, countOf(requested, "/"))
+	})
+
+	t.Run("returns images of the pages visited before an interruption of a resumed crawl", func(t *testing.T) {
+		defer reset()
+
+		path := filepath.Join(t.TempDir(), "frontier.jsonl")
+
+		frontier, err := OpenFrontier(path, false)
+		assert.NoError(t, err)
+
+		// the crawl is interrupted once its pages are visited but before their images are executed
+		err = (&Crawler{Seeds: []string{server.URL + "/"}, MaxDepth: 2, MaxPages: 2, Client: client, Frontier: frontier, BatchSize: 10}).
+			LoadExecute(ctx, func(records []fixture.Record) error {
+				return errors.New("error")
+			})
+		assert.Error(t, err)
+		assert.NoError(t, frontier.Close())
+
+		frontier, err = OpenFrontier(path, true)
+		assert.NoError(t, err)
+		defer frontier.Close()
+
+		reset()
+
+		records, err := collect(&Crawler{Seeds: []string{server.URL + "/"}, MaxDepth: 2, MaxPages: 10, Client: client, Frontier: frontier, BatchSize: 10})
+		assert.NoError(t, err)
+		assert.Equal(t, []fixture.Record{
+			{Url: server.URL + "/a.jpg", Source: server.URL + "/"},
+			{Url: server.URL + "/b.jpg", Source: server.URL + "/gallery"},
+			{Url: server.URL + "/big.png", Source: server.URL + "/big.png"},
+			{Url: server.URL + "/c.jpg", Source: server.URL + "/gallery/2"},
+		}, records)
+		assert.Equal(t, 0, countOf(requested, "/"))
+		assert.Equal(t, 0, countOf(requested, "/gallery"))
+	})
+
+	t.Run("returns images once the delay between requests to a host is over", func(t *testing.T) {
+		defer reset()
+
+		crawler := &Crawler{
+			Seeds:     []string{server.URL + "/"},
+			MaxDepth:  0,
+			MaxPages:  10,
+			Delay:     50 * time.Millisecond,
+			Client:    client,
+			Frontier:  NewFrontier(),
+			BatchSize: 10,
+		}
+
+		start := time.Now()
+
+		_, err := collect(crawler)
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("returns no image once stopped", func(t *testing.T) {
+		defer reset()
+
+		stop := make(chan struct{})
+		close(stop)
+
+		crawler := &Crawler{
+			Seeds:     []string{server.URL + "/"},
+			MaxDepth:  2,
+			MaxPages:  10,
+			Client:    client,
+			Frontier:  NewFrontier(),
+			BatchSize: 10,
+			Stop:      stop,
+		}
+
+		records, err := collect(crawler)
+		assert.NoError(t, err)
+		assert.Empty(t, records)
+		assert.Empty(t, requested)
+	})
+
+	t.Run("returns error on an invalid seed", func(t *testing.T) {
+		crawler := &Crawler{Seeds: []string{"ftp://a.com/"}, MaxPages: 1, Client: client, Frontier: NewFrontier(), BatchSize: 1}
+
+		_, err := collect(crawler)
+		assert.ErrorIs(t, err, ErrInvalidSeed)
+	})
+
+	t.Run("returns error on failed batch execution", func(t *testing.T) {
+		defer reset()
+
+		crawler := &Crawler{Seeds: []string{server.URL + "/"}, MaxPages: 1, Client: client, Frontier: NewFrontier(), BatchSize: 1}
+
+		err := crawler.LoadExecute(ctx, func(records []fixture.Record) error {
+			return errors.New("error")
+		})
+
+		assert.Error(t, err)
+	})
+
+	t.Run("returns no image of a site whose robots.txt fails to load", func(t *testing.T) {
+		crawler := &Crawler{
+			Seeds:    []string{server.URL + "/"},
+			MaxPages: 1,
+			Client: fetchFn(func(req *http.Request) (*http.Response, error) {
+				return nil, errors.New("error")
+			}),
+			Frontier:  NewFrontier(),
+			BatchSize: 1,
+		}
+
+		records, err := collect(crawler)
+		assert.NoError(t, err)
+		assert.Empty(t, records)
+		assert.Equal(t, 0, crawler.Frontier.Visited())
+	})
+}
+
+func urlsOf(records []fixture.Record) []string {
+	urls := make([]string, 0, len(records))
+	for _, record := range records {
+		urls = append(urls, record.Url)
+	}
+	return urls
+}
+
+func countOf(values []string, value string) int {
+	count := 0
+	for _, v := range values {
+		if v == value {
+			count++
+		}
+	}
+	return count
+}
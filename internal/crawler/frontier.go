@@ -0,0 +1,188 @@
+package crawler
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"fachr.in/image-downloader/internal/jsonl"
+)
+
+type PageState string
+
+const (
+	PageQueued  PageState = "queued"
+	PageVisited PageState = "visited"
+	// PageSkipped is a page robots.txt doesn't allow to crawl, it doesn't count against the page budget
+	PageSkipped PageState = "skipped"
+)
+
+type Page struct {
+	Url   string    `json:"url"`
+	Depth int       `json:"depth"`
+	State PageState `json:"state"`
+	// Images are the image urls found on a visited page, kept so a resumed crawl executes them again
+	Images []string `json:"images,omitempty"`
+}
+
+// Frontier is the queue of pages to crawl, every url is queued once and pages are popped in the order
+// they were queued, an open frontier is persisted as an append-only log whose last entry of a url wins
+type Frontier struct {
+	mutex   sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	pages   map[string]Page
+	queue   []string
+	visited int
+	// resumed are the pages a resumed crawl visited already
+	resumed []Page
+}
+
+// NewFrontier creates a frontier kept in memory only
+func NewFrontier() *Frontier {
+	return &Frontier{pages: make(map[string]Page)}
+}
+
+// OpenFrontier creates a new frontier at path, or continues the existing one when resume is true so the pages
+// still queued are crawled and the visited ones are not crawled again
+func OpenFrontier(path string, resume bool) (*Frontier, error) {
+	frontier := NewFrontier()
+
+	if resume {
+		if err := frontier.load(path); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := jsonl.OpenAppend(path, resume)
+	if err != nil {
+		return nil, err
+	}
+
+	frontier.file = file
+	frontier.encoder = json.NewEncoder(file)
+
+	return frontier, nil
+}
+
+// Push queues url unless it is known already, it tells whether url was queued
+func (f *Frontier) Push(url string, depth int) (bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.pages[url]; ok {
+		return false, nil
+	}
+
+	f.queue = append(f.queue, url)
+	return true, f.record(Page{Url: url, Depth: depth, State: PageQueued})
+}
+
+// Pop returns the next queued page, false once none is left
+func (f *Frontier) Pop() (Page, bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for len(f.queue) > 0 {
+		page := f.pages[f.queue[0]]
+		f.queue = f.queue[1:]
+
+		if page.State == PageQueued {
+			return page, true
+		}
+	}
+
+	return Page{}, false
+}
+
+// Done records that the page of url was either visited or skipped along with the image urls found on it
+func (f *Frontier) Done(url string, state PageState, images []string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	page := f.pages[url]
+	page.Url = url
+	page.State = state
+	page.Images = images
+
+	return f.record(page)
+}
+
+// Resumed returns the pages a resumed crawl visited already in the order they were queued, their images
+// might not have been downloaded before the crawl was interrupted
+func (f *Frontier) Resumed() []Page {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.resumed
+}
+
+// Visited returns how many pages were visited, those of a resumed crawl included
+func (f *Frontier) Visited() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.visited
+}
+
+func (f *Frontier) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	return f.file.Close()
+}
+
+func (f *Frontier) record(page Page) error {
+	f.apply(page)
+
+	if f.encoder == nil {
+		return nil
+	}
+
+	return f.encoder.Encode(page)
+}
+
+func (f *Frontier) apply(page Page) {
+	if previous, ok := f.pages[page.Url]; ok && previous.State == PageVisited {
+		f.visited--
+	}
+
+	if page.State == PageVisited {
+		f.visited++
+	}
+
+	f.pages[page.Url] = page
+}
+
+func (f *Frontier) load(path string) error {
+	err := jsonl.Load(path, func(line []byte) {
+		var page Page
+
+		// a crash might leave the last line half written, such page is simply found again
+		if err := json.Unmarshal(line, &page); err != nil || page.Url == "" {
+			return
+		}
+
+		if _, ok := f.pages[page.Url]; !ok {
+			f.queue = append(f.queue, page.Url)
+		}
+
+		f.apply(page)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, url := range f.queue {
+		if page := f.pages[url]; page.State == PageVisited {
+			f.resumed = append(f.resumed, page)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package crawler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrontier(t *testing.T) {
+	t.Run("returns every url once in the order it was queued", func(t *testing.T) {
+		frontier := NewFrontier()
+
+		queued, err := frontier.Push("https://a.com/", 0)
+		assert.NoError(t, err)
+		assert.True(t, queued)
+
+		queued, err = frontier.Push("https://a.com/", 1)
+		assert.NoError(t, err)
+		assert.False(t, queued)
+
+		_, _ = frontier.Push("https://a.com/b", 1)
+
+		page, ok := frontier.Pop()
+		assert.True(t, ok)
+		assert.Equal(t, Page{Url: "https://a.com/", Depth: 0, State: PageQueued}, page)
+		assert.NoError(t, frontier.Done(page.Url, PageVisited, nil))
+
+		page, ok = frontier.Pop()
+		assert.True(t, ok)
+		assert.Equal(t, Page{Url: "https://a.com/b", Depth: 1, State: PageQueued}, page)
+		assert.NoError(t, frontier.Done(page.Url, PageSkipped, nil))
+
+		_, ok = frontier.Pop()
+		assert.False(t, ok)
+		assert.Equal(t, 1, frontier.Visited())
+	})
+
+	t.Run("returns queued pages of a resumed frontier without the visited ones", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "frontier.jsonl")
+
+		frontier, err := OpenFrontier(path, false)
+		assert.NoError(t, err)
+
+		_, _ = frontier.Push("https://a.com/", 0)
+		_, _ = frontier.Push("https://a.com/b", 1)
+		_, _ = frontier.Push("https://a.com/c", 1)
+
+		page, _ := frontier.Pop()
+		assert.NoError(t, frontier.Done(page.Url, PageVisited, []string{"https://a.com/a.jpg"}))
+		assert.NoError(t, frontier.Close())
+
+		// a crash leaves the last line half written
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		assert.NoError(t, err)
+		_, err = file.WriteString(`{"url": "https://a.com/b", "sta`)
+		assert.NoError(t, err)
+		assert.NoError(t, file.Close())
+
+		frontier, err = OpenFrontier(path, true)
+		assert.NoError(t, err)
+		defer frontier.Close()
+
+		queued, err := frontier.Push("https://a.com/", 0)
+		assert.NoError(t, err)
+		assert.False(t, queued)
+		assert.Equal(t, 1, frontier.Visited())
+		assert.Equal(t, []Page{{Url: "https://a.com/", Depth: 0, State: PageVisited, Images: []string{"https://a.com/a.jpg"}}}, frontier.Resumed())
+
+		var urls []string
+		for page, ok := frontier.Pop(); ok; page, ok = frontier.Pop() {
+			urls = append(urls, page.Url)
+		}
+
+		assert.Equal(t, []string{"https://a.com/b", "https://a.com/c"}, urls)
+	})
+
+	t.Run("returns a fresh frontier when not resumed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "frontier.jsonl")
+		assert.NoError(t, os.WriteFile(path, []byte(`{"url": "https://a.com/", "depth": 0, "state": "visited"}`+"\n"), 0644))
+
+		frontier, err := OpenFrontier(path, false)
+		assert.NoError(t, err)
+		defer frontier.Close()
+
+		queued, err := frontier.Push("https://a.com/", 0)
+		assert.NoError(t, err)
+		assert.True(t, queued)
+		assert.Equal(t, 0, frontier.Visited())
+		assert.Empty(t, frontier.Resumed())
+	})
+}
@@ -0,0 +1,149 @@
+package crawler
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Robots are the robots.txt rules applying to the crawler's user agent
+type Robots struct {
+	// CrawlDelay is the least time the site asks for between two requests
+	CrawlDelay time.Duration
+
+	rules []robotsRule
+	// disallowAll is set when robots.txt could not be read, the site is not crawled then
+	disallowAll bool
+}
+
+type robotsRule struct {
+	allow   bool
+	length  int
+	pattern *regexp.Regexp
+}
+
+type robotsGroup struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// ParseRobots reads the group of robots.txt naming the product token of userAgent, or the * group when none
+// names it
+func ParseRobots(reader io.Reader, userAgent string) *Robots {
+	token := strings.ToLower(userAgent)
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+
+	var (
+		matched, wildcard robotsGroup
+		hasMatched        bool
+		// agents of the group being read, a rule after user-agent lines ends the list
+		agents     []string
+		inRules    bool
+		groupOfMe  bool
+		groupOfAll bool
+	)
+
+	scanner := bufio.NewScanner(reader)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if key == "user-agent" {
+			if inRules {
+				agents, inRules = nil, false
+			}
+
+			agents = append(agents, strings.ToLower(value))
+			groupOfMe, groupOfAll = false, false
+
+			for _, agent := range agents {
+				groupOfMe = groupOfMe || agent == token
+				groupOfAll = groupOfAll || agent == "*"
+			}
+
+			hasMatched = hasMatched || groupOfMe
+			continue
+		}
+
+		inRules = true
+
+		var group *robotsGroup
+		switch {
+		case groupOfMe:
+			group = &matched
+		case groupOfAll:
+			group = &wildcard
+		default:
+			continue
+		}
+
+		switch key {
+		case "allow", "disallow":
+			// an empty disallow allows everything
+			if value != "" {
+				group.rules = append(group.rules, newRobotsRule(key == "allow", value))
+			}
+		case "crawl-delay":
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				group.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+
+	if hasMatched {
+		return &Robots{CrawlDelay: matched.crawlDelay, rules: matched.rules}
+	}
+
+	return &Robots{CrawlDelay: wildcard.crawlDelay, rules: wildcard.rules}
+}
+
+// Allowed tells whether the path of a url, its query included, may be crawled: the longest matching rule wins
+// and allow wins a tie
+func (r *Robots) Allowed(path string) bool {
+	if r.disallowAll {
+		return false
+	}
+
+	allowed, length := true, -1
+
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(path) {
+			continue
+		}
+
+		if rule.length > length || (rule.length == length && rule.allow) {
+			allowed, length = rule.allow, rule.length
+		}
+	}
+
+	return allowed
+}
+
+// newRobotsRule matches a path prefix where * stands for any characters and a trailing $ ends the path
+func newRobotsRule(allow bool, path string) robotsRule {
+	anchored := strings.HasSuffix(path, "$")
+	path = strings.TrimSuffix(path, "$")
+
+	pattern := "^" + strings.ReplaceAll(regexp.QuoteMeta(path), `\*`, ".*")
+	if anchored {
+		pattern += "$"
+	}
+
+	return robotsRule{allow: allow, length: len(path), pattern: regexp.MustCompile(pattern)}
+}
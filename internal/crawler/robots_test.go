@@ -0,0 +1,54 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRobots(t *testing.T) {
+	document := `# robots of a.com
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Crawl-delay: 2
+
+User-agent: otherbot
+User-Agent: ImageDownloader
+Disallow: /*.php$
+Disallow: /search?
+Allow: /search?page
+Crawl-delay: 0.5
+`
+
+	t.Run("returns rules of the group naming the user agent", func(t *testing.T) {
+		robots := ParseRobots(strings.NewReader(document), "imagedownloader/1.0")
+
+		assert.Equal(t, 500*time.Millisecond, robots.CrawlDelay)
+		assert.True(t, robots.Allowed("/private"))
+		assert.False(t, robots.Allowed("/index.php"))
+		assert.True(t, robots.Allowed("/index.php?id=1"))
+		assert.False(t, robots.Allowed("/search?q=cars"))
+		assert.True(t, robots.Allowed("/search?page=2"))
+	})
+
+	t.Run("returns rules of the * group when no group names the user agent", func(t *testing.T) {
+		robots := ParseRobots(strings.NewReader(document), "somebot")
+
+		assert.Equal(t, 2*time.Second, robots.CrawlDelay)
+		assert.False(t, robots.Allowed("/private/a.html"))
+		assert.True(t, robots.Allowed("/private/public/a.html"))
+		assert.True(t, robots.Allowed("/index.php"))
+	})
+
+	t.Run("returns everything allowed by an empty robots.txt or an empty disallow", func(t *testing.T) {
+		assert.True(t, ParseRobots(strings.NewReader(""), "imagedownloader").Allowed("/a"))
+		assert.True(t, ParseRobots(strings.NewReader("User-agent: *\nDisallow:\n"), "imagedownloader").Allowed("/a"))
+	})
+
+	t.Run("returns nothing allowed by a robots.txt failing to load", func(t *testing.T) {
+		assert.False(t, (&Robots{disallowAll: true}).Allowed("/"))
+	})
+}
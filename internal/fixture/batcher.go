@@ -0,0 +1,41 @@
+package fixture
+
+// Batcher fills batches of records and executes every batch once full
+type Batcher struct {
+	records       []Record
+	batchExecutor func(records []Record) error
+}
+
+func NewBatcher(size int, batchExecutor func(records []Record) error) *Batcher {
+	return &Batcher{records: make([]Record, 0, size), batchExecutor: batchExecutor}
+}
+
+// Add adds record to the batch, the batch is executed once full
+func (b *Batcher) Add(record Record) error {
+	b.records = append(b.records, record)
+
+	if len(b.records) < cap(b.records) {
+		return nil
+	}
+
+	// batchExecutor might run in a go routine; so copy record values to make it thread safe
+	var safeRecords = make([]Record, len(b.records))
+	copy(safeRecords, b.records)
+
+	// clear records after processed
+	b.records = b.records[:0]
+
+	return b.batchExecutor(safeRecords)
+}
+
+// Flush executes the records of a batch not full yet
+func (b *Batcher) Flush() error {
+	if len(b.records) == 0 {
+		return nil
+	}
+
+	records := b.records
+	b.records = make([]Record, 0, cap(records))
+
+	return b.batchExecutor(records)
+}
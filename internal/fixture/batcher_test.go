@@ -0,0 +1,35 @@
+package fixture
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatcher(t *testing.T) {
+	t.Run("returns records in full batches along with the remaining ones", func(t *testing.T) {
+		var batches [][]Record
+
+		batcher := NewBatcher(2, func(records []Record) error {
+			batches = append(batches, records)
+			return nil
+		})
+
+		for _, u := range []string{"a", "b", "c"} {
+			assert.NoError(t, batcher.Add(Record{Url: u}))
+		}
+
+		assert.NoError(t, batcher.Flush())
+		assert.NoError(t, batcher.Flush())
+		assert.Equal(t, [][]Record{{{Url: "a"}, {Url: "b"}}, {{Url: "c"}}}, batches)
+	})
+
+	t.Run("returns error on failed batch execution", func(t *testing.T) {
+		batcher := NewBatcher(1, func(records []Record) error {
+			return errors.New("error")
+		})
+
+		assert.Error(t, batcher.Add(Record{Url: "a"}))
+	})
+}
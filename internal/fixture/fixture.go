@@ -1,54 +1,150 @@
 package fixture
 
 import (
-	"bufio"
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 )
 
 type Fixture struct {
+	// Path and Paths are fixture files read in order, each is either a file, a glob pattern, a directory of
+	// fixture files or - for stdin, gzip and zstd compressed fixtures are decompressed
 	Path      string
+	Paths     []string
 	BatchSize int
+	// Format is either text, csv or jsonl, empty picks it by the file extension
+	Format string
+	// Columns maps record fields to the csv header naming them, nil uses the field names
+	Columns map[string]string
+	// NewParserFn reads a fixture format of its own, nil reads Format
+	NewParserFn NewParserFn
+	// Stdin is read for the - path, nil reads os.Stdin
+	Stdin io.Reader
 }
 
-func (f *Fixture) LoadExecute(_ context.Context, batchExecutor func(urls []string) error) error {
-	file, err := os.Open(f.Path)
+func (f *Fixture) LoadExecute(ctx context.Context, batchExecutor func(records []Record) error) error {
+	// every path is expanded up front so a missing fixture fails before any record is executed
+	var sources []string
+	for _, fixturePath := range f.paths() {
+		expanded, err := expandPath(fixturePath)
+		if err != nil {
+			return err
+		}
+
+		sources = append(sources, expanded...)
+	}
+
+	batcher := NewBatcher(f.BatchSize, batchExecutor)
+
+	for _, source := range sources {
+		if err := f.loadSource(ctx, source, batcher); err != nil {
+			return err
+		}
+	}
+
+	// execute remaining records
+	return batcher.Flush()
+}
+
+// loadSource reads the records of a single fixture file, a batch is filled across files
+func (f *Fixture) loadSource(ctx context.Context, source string, batcher *Batcher) error {
+	reader, err := f.open(source)
 	if err != nil {
 		return err
 	}
 
-	defer file.Close()
-	scanner := bufio.NewScanner(file)
-	urls := make([]string, 0, f.BatchSize)
+	defer reader.Close()
 
-	for scanner.Scan() {
-		url := scanner.Text()
+	parser, err := f.newParser(source, reader)
+	if err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
 
-		if url == "" {
-			continue
+	for {
+		record, err := parser.Next()
+		if err == io.EOF {
+			return nil
 		}
 
-		// append only non-empty url to batch urls
-		urls = append(urls, url)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+
+		// stop reading a canceled fixture, records of the current batch are not executed either
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		record.Source = source
+
+		if err := batcher.Add(record); err != nil {
+			return err
+		}
+	}
+}
 
-		if len(urls) == cap(urls) {
-			// batchExecutor might run in a go routine; so copy url values to make it thread safe
-			var safeUrls = make([]string, len(urls))
-			copy(safeUrls, urls)
+func (f *Fixture) paths() []string {
+	if f.Path == "" {
+		return f.Paths
+	}
 
-			if err := batchExecutor(safeUrls); err != nil {
-				return err
-			}
+	return append([]string{f.Path}, f.Paths...)
+}
 
-			// clear urls after processed
-			urls = urls[:0]
+func (f *Fixture) open(source string) (io.ReadCloser, error) {
+	if source == StdinPath {
+		stdin := f.Stdin
+		if stdin == nil {
+			stdin = os.Stdin
 		}
+
+		return decompress(stdin)
+	}
+
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(urls) == 0 {
-		return nil
+	reader, err := decompress(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", source, err)
 	}
 
-	// execute remaining urls
-	return batchExecutor(urls)
+	return &fileReader{ReadCloser: reader, file: file}, nil
+}
+
+func (f *Fixture) newParser(source string, reader io.Reader) (Parser, error) {
+	if f.NewParserFn != nil {
+		return f.NewParserFn(reader)
+	}
+
+	format := f.Format
+	if format == "" {
+		format = FormatOf(formatPath(source))
+	}
+
+	switch format {
+	case FormatText:
+		return NewTextParser(reader), nil
+	case FormatCSV:
+		return NewCSVParser(reader, f.Columns)
+	case FormatJSONL:
+		return NewJSONLParser(reader), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+}
+
+// fileReader closes the fixture file along with its decompressing reader
+type fileReader struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (f *fileReader) Close() error {
+	return errors.Join(f.ReadCloser.Close(), f.file.Close())
 }
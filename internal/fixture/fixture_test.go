@@ -3,6 +3,10 @@ package fixture
 import (
 	"context"
 	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -27,7 +31,7 @@ func TestFixture_LoadExecute(t *testing.T) {
 			BatchSize: 1,
 		}
 
-		batchExecutor := func(urls []string) error {
+		batchExecutor := func(records []Record) error {
 			return errors.New("error")
 		}
 
@@ -41,8 +45,8 @@ func TestFixture_LoadExecute(t *testing.T) {
 			BatchSize: 2,
 		}
 
-		batchExecutor := func(urls []string) error {
-			if len(urls) != fixture.BatchSize {
+		batchExecutor := func(records []Record) error {
+			if len(records) != fixture.BatchSize {
 				return errors.New("error")
 			}
 			return nil
@@ -52,6 +56,28 @@ func TestFixture_LoadExecute(t *testing.T) {
 		assert.Error(t, err)
 	})
 
+	t.Run("returns context error and stops reading once canceled", func(t *testing.T) {
+		fixture := &Fixture{
+			Path:      "./testdata/images.txt",
+			BatchSize: 1,
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var collectedUrls []string
+
+		batchExecutor := func(records []Record) error {
+			collectedUrls = append(collectedUrls, urlsOf(records)...)
+			cancel()
+			return nil
+		}
+
+		err := fixture.LoadExecute(ctx, batchExecutor)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, []string{"https://a.com/a.jpg"}, collectedUrls)
+	})
+
 	t.Run("returns no error on succeeded batch execution", func(t *testing.T) {
 		fixture := &Fixture{
 			Path:      "./testdata/images.txt",
@@ -66,8 +92,8 @@ func TestFixture_LoadExecute(t *testing.T) {
 			"https://c.com/c.gif",
 		}
 
-		batchExecutor := func(urls []string) error {
-			collectedUrls = append(collectedUrls, urls...)
+		batchExecutor := func(records []Record) error {
+			collectedUrls = append(collectedUrls, urlsOf(records)...)
 			return nil
 		}
 
@@ -90,8 +116,8 @@ func TestFixture_LoadExecute(t *testing.T) {
 			"https://c.com/c.gif",
 		}
 
-		batchExecutor := func(urls []string) error {
-			collectedUrls = append(collectedUrls, urls...)
+		batchExecutor := func(records []Record) error {
+			collectedUrls = append(collectedUrls, urlsOf(records)...)
 			return nil
 		}
 
@@ -100,3 +126,157 @@ func TestFixture_LoadExecute(t *testing.T) {
 		assert.EqualValues(t, expectedUrls, collectedUrls)
 	})
 }
+
+func TestFixture_LoadExecute_Formats(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns records of a csv fixture with its columns mapped", func(t *testing.T) {
+		fixture := &Fixture{
+			Path:      "./testdata/images.csv",
+			BatchSize: 10,
+			Columns:   map[string]string{FieldUrl: "Image URL", FieldFileName: "Name"},
+		}
+
+		var collectedRecords []Record
+
+		err := fixture.LoadExecute(ctx, func(records []Record) error {
+			collectedRecords = append(collectedRecords, records...)
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []Record{
+			{ID: "1", Url: "https://a.com/a.jpg", FileName: "front", Category: "cars", SHA256: "ab12", Source: "./testdata/images.csv", Line: 2},
+			{ID: "2", Url: "https://b.com/c.png", Category: "boats", Source: "./testdata/images.csv", Line: 4},
+		}, collectedRecords)
+	})
+
+	t.Run("returns records of a jsonl fixture picked by its extension", func(t *testing.T) {
+		fixture := &Fixture{
+			Path:      "./testdata/images.jsonl",
+			BatchSize: 10,
+		}
+
+		var collectedRecords []Record
+
+		err := fixture.LoadExecute(ctx, func(records []Record) error {
+			collectedRecords = append(collectedRecords, records...)
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []Record{
+			{ID: "1", Url: "https://a.com/a.jpg", FileName: "front", Category: "cars", SHA256: "ab12", Source: "./testdata/images.jsonl", Line: 1},
+			{Url: "not json", Source: "./testdata/images.jsonl", Line: 3},
+			{Url: "https://c.com/c.gif", Source: "./testdata/images.jsonl", Line: 4},
+		}, collectedRecords)
+	})
+
+	t.Run("returns records of a parser of its own", func(t *testing.T) {
+		fixture := &Fixture{
+			Path:      "./testdata/images.txt",
+			BatchSize: 10,
+			NewParserFn: func(reader io.Reader) (Parser, error) {
+				return NewJSONLParser(strings.NewReader(`{"url": "https://d.com/d.jpg"}`)), nil
+			},
+		}
+
+		var collectedUrls []string
+
+		err := fixture.LoadExecute(ctx, func(records []Record) error {
+			collectedUrls = append(collectedUrls, urlsOf(records)...)
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"https://d.com/d.jpg"}, collectedUrls)
+	})
+
+	t.Run("returns error on an unknown format", func(t *testing.T) {
+		fixture := &Fixture{
+			Path:      "./testdata/images.txt",
+			BatchSize: 1,
+			Format:    "xml",
+		}
+
+		err := fixture.LoadExecute(ctx, nil)
+		assert.ErrorIs(t, err, ErrUnknownFormat)
+	})
+
+	t.Run("returns error on a csv fixture without url column", func(t *testing.T) {
+		fixture := &Fixture{
+			Path:      "./testdata/images.csv",
+			BatchSize: 1,
+		}
+
+		err := fixture.LoadExecute(ctx, nil)
+		assert.ErrorIs(t, err, ErrMissingUrlColumn)
+	})
+}
+
+func TestFixture_LoadExecute_Sources(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("https://a.com/a.jpg\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "b.csv.gz"), gzipped(t, "url\nhttps://b.com/b.jpg\n"), 0644))
+
+	t.Run("returns records of every path in order along with their origin", func(t *testing.T) {
+		fixture := &Fixture{
+			Path:      filepath.Join(dir, "*.gz"),
+			Paths:     []string{StdinPath, dir},
+			BatchSize: 2,
+			Stdin:     strings.NewReader("\nhttps://c.com/c.jpg\n"),
+		}
+
+		var collectedRecords []Record
+
+		err := fixture.LoadExecute(ctx, func(records []Record) error {
+			collectedRecords = append(collectedRecords, records...)
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []Record{
+			{Url: "https://b.com/b.jpg", Source: filepath.Join(dir, "b.csv.gz"), Line: 2},
+			{Url: "https://c.com/c.jpg", Source: StdinPath, Line: 2},
+			{Url: "https://a.com/a.jpg", Source: filepath.Join(dir, "a.txt"), Line: 1},
+			{Url: "https://b.com/b.jpg", Source: filepath.Join(dir, "b.csv.gz"), Line: 2},
+		}, collectedRecords)
+	})
+
+	t.Run("returns error before executing any record when a path is missing", func(t *testing.T) {
+		fixture := &Fixture{
+			Paths:     []string{dir, filepath.Join(dir, "missing.txt")},
+			BatchSize: 1,
+		}
+
+		err := fixture.LoadExecute(ctx, func(records []Record) error {
+			t.Fatal("no record must be executed")
+			return nil
+		})
+
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("returns error naming the fixture that failed to be parsed", func(t *testing.T) {
+		fixture := &Fixture{
+			Path:      StdinPath,
+			BatchSize: 1,
+			Format:    FormatCSV,
+			Stdin:     strings.NewReader("id\n1\n"),
+		}
+
+		err := fixture.LoadExecute(ctx, nil)
+		assert.ErrorIs(t, err, ErrMissingUrlColumn)
+		assert.ErrorContains(t, err, StdinPath)
+	})
+}
+
+func urlsOf(records []Record) []string {
+	urls := make([]string, 0, len(records))
+	for _, record := range records {
+		urls = append(urls, record.Url)
+	}
+	return urls
+}
@@ -0,0 +1,210 @@
+package fixture
+
+import (
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	// cssBackgroundPattern finds the value of background and background-image declarations
+	cssBackgroundPattern = regexp.MustCompile(`(?i)background(?:-image)?\s*:([^;}]*)`)
+	cssUrlPattern        = regexp.MustCompile(`(?i)url\(\s*['"]?([^'")\s]+)['"]?\s*\)`)
+)
+
+var (
+	ogImageProperties = map[string]bool{
+		"og:image":            true,
+		"og:image:url":        true,
+		"og:image:secure_url": true,
+	}
+)
+
+// Page lists the images an html page shows and the pages it links to
+type Page struct {
+	Images []string
+	Links  []string
+}
+
+// ExtractImages finds the image urls of an html page: img src or the largest srcset candidate, picture sources,
+// og:image and css background images, relative urls are resolved against the page base and every url is
+// returned once in the order it is found
+func ExtractImages(page *url.URL, reader io.Reader) ([]string, error) {
+	extracted, err := ExtractPage(page, reader)
+	return extracted.Images, err
+}
+
+// ExtractPage finds the image urls of an html page as ExtractImages does along with the urls its anchors link to,
+// links marked nofollow are left out
+func ExtractPage(page *url.URL, reader io.Reader) (Page, error) {
+	extractor := &pageExtractor{base: page, seen: make(map[string]bool), seenLinks: make(map[string]bool)}
+	tokenizer := html.NewTokenizer(reader)
+
+	inStyle := false
+
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if err := tokenizer.Err(); err != io.EOF {
+				return Page{}, err
+			}
+
+			if extractor.nofollow {
+				return Page{Images: extractor.urls}, nil
+			}
+
+			return Page{Images: extractor.urls, Links: extractor.links}, nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			extractor.tag(token)
+			inStyle = token.DataAtom == atom.Style && token.Type == html.StartTagToken
+		case html.EndTagToken:
+			inStyle = false
+		case html.TextToken:
+			// the content of a style element is raw text
+			if inStyle {
+				extractor.css(string(tokenizer.Text()))
+			}
+		}
+	}
+}
+
+type pageExtractor struct {
+	base    *url.URL
+	hasBase bool
+	urls    []string
+	seen    map[string]bool
+
+	links     []string
+	seenLinks map[string]bool
+	// nofollow is set by a robots meta element asking for none of the links to be followed
+	nofollow bool
+}
+
+func (p *pageExtractor) tag(token html.Token) {
+	attrs := make(map[string]string, len(token.Attr))
+	for _, attr := range token.Attr {
+		attrs[strings.ToLower(attr.Key)] = attr.Val
+	}
+
+	switch token.DataAtom {
+	case atom.Base:
+		// only the first base element counts
+		if href, ok := attrs["href"]; ok && !p.hasBase {
+			if base, err := p.base.Parse(strings.TrimSpace(href)); err == nil {
+				p.base, p.hasBase = base, true
+			}
+		}
+	case atom.Img:
+		// src is the fallback of a srcset, the same image at a lower resolution
+		if candidate := largestCandidate(attrs["srcset"]); candidate != "" {
+			p.add(candidate)
+		} else {
+			p.add(attrs["src"])
+		}
+	case atom.Source:
+		p.add(largestCandidate(attrs["srcset"]))
+	case atom.Meta:
+		property := attrs["property"]
+		if property == "" {
+			property = attrs["name"]
+		}
+
+		if ogImageProperties[strings.ToLower(property)] {
+			p.add(attrs["content"])
+		}
+
+		if strings.EqualFold(attrs["name"], "robots") && strings.Contains(strings.ToLower(attrs["content"]), "nofollow") {
+			p.nofollow = true
+		}
+	case atom.A, atom.Area:
+		if !strings.Contains(strings.ToLower(attrs["rel"]), "nofollow") {
+			p.link(attrs["href"])
+		}
+	}
+
+	if style, ok := attrs["style"]; ok {
+		p.css(style)
+	}
+}
+
+func (p *pageExtractor) css(style string) {
+	for _, declaration := range cssBackgroundPattern.FindAllStringSubmatch(style, -1) {
+		for _, match := range cssUrlPattern.FindAllStringSubmatch(declaration[1], -1) {
+			p.add(match[1])
+		}
+	}
+}
+
+// add keeps an image url not found yet
+func (p *pageExtractor) add(rawUrl string) {
+	if imageUrl, ok := p.resolve(rawUrl); ok && !p.seen[imageUrl] {
+		p.seen[imageUrl] = true
+		p.urls = append(p.urls, imageUrl)
+	}
+}
+
+// link keeps a linked page url not found yet
+func (p *pageExtractor) link(rawUrl string) {
+	if pageUrl, ok := p.resolve(rawUrl); ok && !p.seenLinks[pageUrl] {
+		p.seenLinks[pageUrl] = true
+		p.links = append(p.links, pageUrl)
+	}
+}
+
+// resolve returns a http or https url without its fragment, inline data urls and other schemes are skipped
+func (p *pageExtractor) resolve(rawUrl string) (string, bool) {
+	rawUrl = strings.TrimSpace(rawUrl)
+	if rawUrl == "" {
+		return "", false
+	}
+
+	u, err := p.base.Parse(rawUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", false
+	}
+
+	u.Fragment = ""
+	return u.String(), true
+}
+
+// largestCandidate picks the widest candidate of a srcset, or the densest one when no width is given
+func largestCandidate(srcset string) string {
+	var (
+		largest      string
+		largestWidth float64
+		largestScale float64
+	)
+
+	for _, candidate := range strings.Split(srcset, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+
+		width, scale := 0.0, 1.0
+		if len(fields) > 1 {
+			descriptor := strings.ToLower(fields[1])
+			value, err := strconv.ParseFloat(descriptor[:len(descriptor)-1], 64)
+
+			switch {
+			case err != nil:
+			case strings.HasSuffix(descriptor, "w"):
+				width = value
+			case strings.HasSuffix(descriptor, "x"):
+				scale = value
+			}
+		}
+
+		if largest == "" || width > largestWidth || (width == largestWidth && scale > largestScale) {
+			largest, largestWidth, largestScale = fields[0], width, scale
+		}
+	}
+
+	return largest
+}
@@ -0,0 +1,96 @@
+package fixture
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractImages(t *testing.T) {
+	page, _ := url.Parse("https://a.com/gallery/index.html")
+
+	t.Run("returns image urls of every kind resolved against the page", func(t *testing.T) {
+		document := `<html><head>
+			<meta property="og:image" content="https://cdn.a.com/cover.jpg">
+			<style>.hero { background-image: url('/img/hero.jpg'); } .x { color: red }</style>
+		</head><body>
+			<img src="a.jpg">
+			<img src="b-small.jpg" srcset="b-small.jpg 320w, b-large.jpg 1280w, b-medium.jpg 640w">
+			<img srcset="c.jpg, c@2x.jpg 2x">
+			<picture>
+				<source srcset="d.avif 1x, d@3x.avif 3x" type="image/avif">
+				<img src="d.jpg">
+			</picture>
+			<div style="background: #fff url(&quot;e.png&quot;) no-repeat"></div>
+			<img src="a.jpg#again">
+			<img src="data:image/png;base64,AAAA">
+		</body></html>`
+
+		imageUrls, err := ExtractImages(page, strings.NewReader(document))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			"https://cdn.a.com/cover.jpg",
+			"https://a.com/img/hero.jpg",
+			"https://a.com/gallery/a.jpg",
+			"https://a.com/gallery/b-large.jpg",
+			"https://a.com/gallery/c@2x.jpg",
+			"https://a.com/gallery/d@3x.avif",
+			"https://a.com/gallery/d.jpg",
+			"https://a.com/gallery/e.png",
+		}, imageUrls)
+	})
+
+	t.Run("returns image urls resolved against the base element", func(t *testing.T) {
+		document := `<head><base href="https://static.a.com/assets/"></head><img src="a.jpg"><img src="//b.com/b.jpg">`
+
+		imageUrls, err := ExtractImages(page, strings.NewReader(document))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"https://static.a.com/assets/a.jpg", "https://b.com/b.jpg"}, imageUrls)
+	})
+
+	t.Run("returns no image url of a page without images", func(t *testing.T) {
+		imageUrls, err := ExtractImages(page, strings.NewReader("<p>no images</p>"))
+		assert.NoError(t, err)
+		assert.Empty(t, imageUrls)
+	})
+}
+
+func TestExtractPage(t *testing.T) {
+	page, _ := url.Parse("https://a.com/gallery/index.html")
+
+	t.Run("returns images along with the links to follow", func(t *testing.T) {
+		document := `<img src="a.jpg">
+			<a href="page-2.html#top">next</a>
+			<a href="/about">about</a>
+			<a href="page-2.html">next again</a>
+			<a href="/login" rel="nofollow">login</a>
+			<a href="mailto:a@a.com">mail</a>
+			<map><area href="https://b.com/"></map>`
+
+		extracted, err := ExtractPage(page, strings.NewReader(document))
+		assert.NoError(t, err)
+		assert.Equal(t, Page{
+			Images: []string{"https://a.com/gallery/a.jpg"},
+			Links:  []string{"https://a.com/gallery/page-2.html", "https://a.com/about", "https://b.com/"},
+		}, extracted)
+	})
+
+	t.Run("returns no link of a page asking for its links not to be followed", func(t *testing.T) {
+		document := `<meta name="robots" content="noindex, nofollow"><img src="a.jpg"><a href="page-2.html">next</a>`
+
+		extracted, err := ExtractPage(page, strings.NewReader(document))
+		assert.NoError(t, err)
+		assert.Equal(t, Page{Images: []string{"https://a.com/gallery/a.jpg"}}, extracted)
+	})
+}
+
+func TestLargestCandidate(t *testing.T) {
+	t.Run("returns the widest candidate, else the densest one", func(t *testing.T) {
+		assert.Equal(t, "b.jpg", largestCandidate("a.jpg 100w, b.jpg 200w"))
+		assert.Equal(t, "b.jpg", largestCandidate("a.jpg 1.5x,b.jpg 2x, c.jpg"))
+		assert.Equal(t, "a.jpg", largestCandidate(" a.jpg "))
+		assert.Equal(t, "", largestCandidate(""))
+	})
+}
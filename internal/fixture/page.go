@@ -0,0 +1,198 @@
+package fixture
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"fachr.in/image-downloader/pkg/logger"
+)
+
+const (
+	// MaxPageSize is how much of a page or sitemap is read at most
+	MaxPageSize = 10 << 20
+	// maxSitemapDepth is how many sitemap indexes are followed down to an image sitemap
+	maxSitemapDepth = 2
+	// sniffLen is how much of a page is looked at to tell a sitemap served without an xml content type
+	sniffLen = 1024
+)
+
+var (
+	ErrPageStatus = errors.New("page answered with an unexpected status")
+
+	// errStopped ends reading the pages once stopped
+	errStopped = errors.New("page loader stopped")
+)
+
+type pageClient interface {
+	Fetch(req *http.Request) (*http.Response, error)
+}
+
+// Loader reads the records of a fixture in batches
+type Loader interface {
+	LoadExecute(ctx context.Context, batchExecutor func(records []Record) error) error
+}
+
+// PageLoader reads the urls loaded by Pages as html pages or image sitemaps and executes the image urls found
+// on them, an image keeps the category of its page and its page as the source
+type PageLoader struct {
+	Pages     Loader
+	Client    pageClient
+	BatchSize int
+	// Stop ends fetching pages, the image urls found so far are still executed
+	Stop <-chan struct{}
+}
+
+func (p *PageLoader) LoadExecute(ctx context.Context, batchExecutor func(records []Record) error) error {
+	batcher := NewBatcher(p.BatchSize, batchExecutor)
+
+	err := p.Pages.LoadExecute(ctx, func(pages []Record) error {
+		for _, page := range pages {
+			if p.stopping() {
+				return errStopped
+			}
+
+			imageUrls, err := p.extract(ctx, page.Url, 0, make(map[string]bool))
+			if err != nil {
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return ctxErr
+				}
+
+				// a page failing to load doesn't stop the rest of the pages
+				logger.Errorf("could not extract images from page: %v, err: %v", page.Url, err)
+				continue
+			}
+
+			for _, imageUrl := range imageUrls {
+				if err := batcher.Add(Record{Url: imageUrl, Category: page.Category, Source: page.Url}); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, errStopped) {
+		return err
+	}
+
+	// execute remaining records
+	return batcher.Flush()
+}
+
+func (p *PageLoader) stopping() bool {
+	select {
+	case <-p.Stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// extract returns the image urls of a page, or of every image sitemap a sitemap index leads to, each url once
+func (p *PageLoader) extract(ctx context.Context, pageUrl string, depth int, seen map[string]bool) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.Client.Fetch(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("%w: %d", ErrPageStatus, resp.StatusCode)
+	}
+
+	// relative urls are resolved against the page the request was redirected to
+	base := req.URL
+	if resp.Request != nil {
+		base = resp.Request.URL
+	}
+
+	// a sitemap is often served gzip compressed as a file rather than a content encoding
+	body, err := decompress(io.LimitReader(resp.Body, MaxPageSize))
+	if err != nil {
+		return nil, err
+	}
+
+	defer body.Close()
+
+	buffered := bufio.NewReader(body)
+
+	if !isSitemap(resp.Header.Get("Content-Type"), buffered) {
+		imageUrls, err := ExtractImages(base, buffered)
+		if err != nil {
+			return nil, err
+		}
+
+		return unseen(imageUrls, seen), nil
+	}
+
+	sitemap, err := ParseSitemap(base, buffered)
+	if err != nil {
+		return nil, err
+	}
+
+	imageUrls := unseen(sitemap.Images, seen)
+
+	if depth >= maxSitemapDepth {
+		return imageUrls, nil
+	}
+
+	for _, sitemapUrl := range sitemap.Sitemaps {
+		sitemapImageUrls, err := p.extract(ctx, sitemapUrl, depth+1, seen)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+
+			logger.Errorf("could not extract images from sitemap: %v, err: %v", sitemapUrl, err)
+			continue
+		}
+
+		imageUrls = append(imageUrls, sitemapImageUrls...)
+	}
+
+	return imageUrls, nil
+}
+
+// isSitemap tells a sitemap by its xml content type, or by its root element when served as anything but html
+func isSitemap(contentType string, reader *bufio.Reader) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		return false
+	case strings.HasSuffix(mediaType, "/xml") || strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+
+	head, _ := reader.Peek(sniffLen)
+	head = bytes.ToLower(head)
+
+	return bytes.Contains(head, []byte("<urlset")) || bytes.Contains(head, []byte("<sitemapindex"))
+}
+
+// unseen drops the urls found already, e.g. on another sitemap of the same sitemap index
+func unseen(urls []string, seen map[string]bool) []string {
+	var found []string
+	for _, u := range urls {
+		if !seen[u] {
+			seen[u] = true
+			found = append(found, u)
+		}
+	}
+
+	return found
+}
@@ -0,0 +1,196 @@
+package fixture
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fetchFn func(req *http.Request) (*http.Response, error)
+
+func (f fetchFn) Fetch(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestPageLoader_LoadExecute(t *testing.T) {
+	ctx := context.Background()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gallery.html", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<img src="a.jpg"><img src="/b.jpg"><img src="a.jpg">`)
+	})
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, `<sitemapindex><sitemap><loc>/sitemap-images.xml.gz</loc></sitemap><sitemap><loc>/missing.xml</loc></sitemap></sitemapindex>`)
+	})
+	mux.HandleFunc("/sitemap-images.xml.gz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+
+		writer := gzip.NewWriter(w)
+		fmt.Fprint(writer, `<urlset><url><loc>/gallery.html</loc><image:image><image:loc>/c.jpg</image:loc></image:image></url></urlset>`)
+		writer.Close()
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/gallery.html", http.StatusFound)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := fetchFn(http.DefaultClient.Do)
+
+	t.Run("returns image urls of every page and sitemap along with their page", func(t *testing.T) {
+		pages := strings.Join([]string{
+			server.URL + "/gallery.html",
+			server.URL + "/sitemap.xml",
+			server.URL + "/missing.html",
+			server.URL + "/redirect",
+		}, "\n")
+
+		loader := &PageLoader{
+			Pages:     &Fixture{Path: StdinPath, BatchSize: 2, Stdin: strings.NewReader(pages)},
+			Client:    client,
+			BatchSize: 2,
+		}
+
+		var collectedRecords []Record
+		var batches int
+
+		err := loader.LoadExecute(ctx, func(records []Record) error {
+			collectedRecords = append(collectedRecords, records...)
+			batches++
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 3, batches)
+		assert.Equal(t, []Record{
+			{Url: server.URL + "/a.jpg", Source: server.URL + "/gallery.html"},
+			{Url: server.URL + "/b.jpg", Source: server.URL + "/gallery.html"},
+			{Url: server.URL + "/c.jpg", Source: server.URL + "/sitemap.xml"},
+			{Url: server.URL + "/a.jpg", Source: server.URL + "/redirect"},
+			{Url: server.URL + "/b.jpg", Source: server.URL + "/redirect"},
+		}, collectedRecords)
+	})
+
+	t.Run("returns images keeping the category of their page", func(t *testing.T) {
+		loader := &PageLoader{
+			Pages:     &Fixture{Path: StdinPath, BatchSize: 1, Format: FormatJSONL, Stdin: strings.NewReader(`{"url": "` + server.URL + `/gallery.html", "category": "cars"}`)},
+			Client:    client,
+			BatchSize: 10,
+		}
+
+		var collectedRecords []Record
+
+		err := loader.LoadExecute(ctx, func(records []Record) error {
+			collectedRecords = append(collectedRecords, records...)
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []Record{
+			{Url: server.URL + "/a.jpg", Category: "cars", Source: server.URL + "/gallery.html"},
+			{Url: server.URL + "/b.jpg", Category: "cars", Source: server.URL + "/gallery.html"},
+		}, collectedRecords)
+	})
+
+	t.Run("returns error on failed batch execution", func(t *testing.T) {
+		loader := &PageLoader{
+			Pages:     &Fixture{Path: StdinPath, BatchSize: 1, Stdin: strings.NewReader(server.URL + "/gallery.html")},
+			Client:    client,
+			BatchSize: 1,
+		}
+
+		err := loader.LoadExecute(ctx, func(records []Record) error {
+			return errors.New("error")
+		})
+
+		assert.Error(t, err)
+	})
+
+	t.Run("returns no image once stopped", func(t *testing.T) {
+		stop := make(chan struct{})
+		close(stop)
+
+		var requested int
+
+		loader := &PageLoader{
+			Pages: &Fixture{Path: StdinPath, BatchSize: 1, Stdin: strings.NewReader(server.URL + "/gallery.html")},
+			Client: fetchFn(func(req *http.Request) (*http.Response, error) {
+				requested++
+				return http.DefaultClient.Do(req)
+			}),
+			BatchSize: 1,
+			Stop:      stop,
+		}
+
+		var collectedRecords []Record
+
+		err := loader.LoadExecute(ctx, func(records []Record) error {
+			collectedRecords = append(collectedRecords, records...)
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Empty(t, collectedRecords)
+		assert.Zero(t, requested)
+	})
+
+	t.Run("returns images of the pages fetched before being stopped", func(t *testing.T) {
+		stop := make(chan struct{})
+		pages := server.URL + "/gallery.html\n" + server.URL + "/redirect"
+
+		var requested []string
+
+		loader := &PageLoader{
+			Pages: &Fixture{Path: StdinPath, BatchSize: 2, Stdin: strings.NewReader(pages)},
+			Client: fetchFn(func(req *http.Request) (*http.Response, error) {
+				requested = append(requested, req.URL.String())
+				close(stop)
+				return http.DefaultClient.Do(req)
+			}),
+			BatchSize: 10,
+			Stop:      stop,
+		}
+
+		var collectedRecords []Record
+
+		err := loader.LoadExecute(ctx, func(records []Record) error {
+			collectedRecords = append(collectedRecords, records...)
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{server.URL + "/gallery.html"}, requested)
+		assert.Equal(t, []Record{
+			{Url: server.URL + "/a.jpg", Source: server.URL + "/gallery.html"},
+			{Url: server.URL + "/b.jpg", Source: server.URL + "/gallery.html"},
+		}, collectedRecords)
+	})
+
+	t.Run("returns context error once canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		loader := &PageLoader{
+			Pages: &Fixture{Path: StdinPath, BatchSize: 1, Stdin: strings.NewReader(server.URL + "/gallery.html")},
+			Client: fetchFn(func(req *http.Request) (*http.Response, error) {
+				return nil, req.Context().Err()
+			}),
+			BatchSize: 1,
+		}
+
+		err := loader.LoadExecute(ctx, func(records []Record) error {
+			return nil
+		})
+
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
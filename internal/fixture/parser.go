@@ -0,0 +1,220 @@
+package fixture
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+const (
+	FormatText  = "text"
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+const (
+	FieldID       = "id"
+	FieldUrl      = "url"
+	FieldFileName = "filename"
+	FieldCategory = "category"
+	FieldSHA256   = "sha256"
+)
+
+var (
+	fields = []string{FieldID, FieldUrl, FieldFileName, FieldCategory, FieldSHA256}
+)
+
+var (
+	ErrUnknownFormat    = errors.New("unknown fixture format")
+	ErrMissingUrlColumn = errors.New("csv fixture has no url column")
+)
+
+// Record is a single image to download along with what the upstream export knows about it
+type Record struct {
+	ID  string `json:"id"`
+	Url string `json:"url"`
+	// FileName is the desired name of the stored image, its extension still follows the content type
+	FileName string `json:"filename"`
+	// Category is the folder the image is stored under
+	Category string `json:"category"`
+	// SHA256 is the expected checksum of the image, a mismatching image is not stored
+	SHA256 string `json:"sha256"`
+	// Source and Line tell where the record was read from, Source is the fixture path or - for stdin
+	Source string `json:"-"`
+	Line   int    `json:"-"`
+}
+
+// Parser reads the records of a fixture one at a time, io.EOF ends the fixture
+type Parser interface {
+	Next() (Record, error)
+}
+
+// NewParserFn builds the parser reading a fixture
+type NewParserFn func(reader io.Reader) (Parser, error)
+
+// FormatOf picks the format of a fixture by its file extension, text for any other extension
+func FormatOf(fixturePath string) string {
+	switch strings.ToLower(path.Ext(fixturePath)) {
+	case ".csv":
+		return FormatCSV
+	case ".jsonl", ".ndjson":
+		return FormatJSONL
+	default:
+		return FormatText
+	}
+}
+
+// ValidField tells whether field is a record field a csv column can be mapped to
+func ValidField(field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TextParser reads one bare url per line
+type TextParser struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func NewTextParser(reader io.Reader) *TextParser {
+	return &TextParser{scanner: bufio.NewScanner(reader)}
+}
+
+func (t *TextParser) Next() (Record, error) {
+	for t.scanner.Scan() {
+		t.line++
+		if url := t.scanner.Text(); url != "" {
+			return Record{Url: url, Line: t.line}, nil
+		}
+	}
+
+	if err := t.scanner.Err(); err != nil {
+		return Record{}, err
+	}
+
+	return Record{}, io.EOF
+}
+
+// CSVParser reads one record per row, its fields are found by the header row
+type CSVParser struct {
+	reader *csv.Reader
+	// indexes maps every field to its column, a field without a column is left empty
+	indexes map[string]int
+}
+
+// NewCSVParser reads the header row right away, columns maps fields to the header naming them
+// and nil uses the field names, headers are matched case-insensitively
+func NewCSVParser(reader io.Reader, columns map[string]string) (*CSVParser, error) {
+	csvReader := csv.NewReader(reader)
+	// a malformed row is read as far as possible, a row without a valid url is reported as invalid anyway
+	csvReader.FieldsPerRecord = -1
+	csvReader.LazyQuotes = true
+	csvReader.TrimLeadingSpace = true
+
+	header, err := csvReader.Read()
+	if err == io.EOF {
+		return &CSVParser{reader: csvReader}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	columnIndexes := make(map[string]int, len(header))
+	for i, column := range header {
+		columnIndexes[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+
+	indexes := make(map[string]int)
+	for _, field := range fields {
+		column, ok := columns[field]
+		if !ok {
+			column = field
+		}
+
+		if i, ok := columnIndexes[strings.ToLower(column)]; ok {
+			indexes[field] = i
+		}
+	}
+
+	if _, ok := indexes[FieldUrl]; !ok {
+		return nil, ErrMissingUrlColumn
+	}
+
+	return &CSVParser{reader: csvReader, indexes: indexes}, nil
+}
+
+func (c *CSVParser) Next() (Record, error) {
+	for {
+		row, err := c.reader.Read()
+		if err != nil {
+			return Record{}, err
+		}
+
+		record := Record{
+			ID:       c.field(row, FieldID),
+			Url:      c.field(row, FieldUrl),
+			FileName: c.field(row, FieldFileName),
+			Category: c.field(row, FieldCategory),
+			SHA256:   c.field(row, FieldSHA256),
+		}
+
+		if record != (Record{}) {
+			record.Line, _ = c.reader.FieldPos(0)
+			return record, nil
+		}
+	}
+}
+
+func (c *CSVParser) field(row []string, field string) string {
+	i, ok := c.indexes[field]
+	if !ok || i >= len(row) {
+		return ""
+	}
+
+	return strings.TrimSpace(row[i])
+}
+
+// JSONLParser reads one json object per line
+type JSONLParser struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func NewJSONLParser(reader io.Reader) *JSONLParser {
+	return &JSONLParser{scanner: bufio.NewScanner(reader)}
+}
+
+func (j *JSONLParser) Next() (Record, error) {
+	for j.scanner.Scan() {
+		j.line++
+		line := strings.TrimSpace(j.scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		// a malformed line is kept as the url so it is reported as invalid instead of failing the fixture
+		var record Record
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return Record{Url: line, Line: j.line}, nil
+		}
+
+		record.Line = j.line
+		return record, nil
+	}
+
+	if err := j.scanner.Err(); err != nil {
+		return Record{}, err
+	}
+
+	return Record{}, io.EOF
+}
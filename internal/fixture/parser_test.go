@@ -0,0 +1,76 @@
+package fixture
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatOf(t *testing.T) {
+	t.Run("returns format of a fixture by its extension", func(t *testing.T) {
+		assert.Equal(t, FormatCSV, FormatOf("/fixtures/images.CSV"))
+		assert.Equal(t, FormatJSONL, FormatOf("/fixtures/images.jsonl"))
+		assert.Equal(t, FormatJSONL, FormatOf("/fixtures/images.ndjson"))
+		assert.Equal(t, FormatText, FormatOf("/fixtures/images.txt"))
+		assert.Equal(t, FormatText, FormatOf("/fixtures/images"))
+	})
+}
+
+func TestTextParser_Next(t *testing.T) {
+	t.Run("returns one record per non-empty line along with its line number", func(t *testing.T) {
+		parser := NewTextParser(strings.NewReader("https://a.com/a.jpg\n\nhttps://b.com/b.jpg"))
+
+		assert.Equal(t, []Record{{Url: "https://a.com/a.jpg", Line: 1}, {Url: "https://b.com/b.jpg", Line: 3}}, readAll(t, parser))
+	})
+}
+
+func TestCSVParser_Next(t *testing.T) {
+	t.Run("returns records by the field names when no column is mapped", func(t *testing.T) {
+		parser, err := NewCSVParser(strings.NewReader("URL,sha256,extra\nhttps://a.com/a.jpg,AB12,x\nhttps://b.com/b.jpg\n"), nil)
+		assert.NoError(t, err)
+
+		assert.Equal(t, []Record{
+			{Url: "https://a.com/a.jpg", SHA256: "AB12", Line: 2},
+			{Url: "https://b.com/b.jpg", Line: 3},
+		}, readAll(t, parser))
+	})
+
+	t.Run("returns no record from an empty csv", func(t *testing.T) {
+		parser, err := NewCSVParser(strings.NewReader(""), nil)
+		assert.NoError(t, err)
+
+		assert.Empty(t, readAll(t, parser))
+	})
+
+	t.Run("returns error on a header without url column", func(t *testing.T) {
+		_, err := NewCSVParser(strings.NewReader("id,link\n1,https://a.com/a.jpg\n"), nil)
+		assert.ErrorIs(t, err, ErrMissingUrlColumn)
+	})
+}
+
+func TestJSONLParser_Next(t *testing.T) {
+	t.Run("returns malformed lines as urls so they are reported as invalid", func(t *testing.T) {
+		parser := NewJSONLParser(strings.NewReader("{\"url\": \"https://a.com/a.jpg\", \"category\": \"cars\"}\n{broken\n"))
+
+		assert.Equal(t, []Record{
+			{Url: "https://a.com/a.jpg", Category: "cars", Line: 1},
+			{Url: "{broken", Line: 2},
+		}, readAll(t, parser))
+	})
+}
+
+func readAll(t *testing.T, parser Parser) []Record {
+	var records []Record
+
+	for {
+		record, err := parser.Next()
+		if err == io.EOF {
+			return records
+		}
+
+		assert.NoError(t, err)
+		records = append(records, record)
+	}
+}
@@ -0,0 +1,68 @@
+package fixture
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrNotSitemap = errors.New("xml document is neither a sitemap nor a sitemap index")
+)
+
+// Sitemap lists the image urls of an image sitemap, or the sitemaps of a sitemap index
+type Sitemap struct {
+	Images   []string
+	Sitemaps []string
+}
+
+type sitemapDocument struct {
+	XMLName xml.Name
+	Urls    []struct {
+		Images []struct {
+			Loc string `xml:"loc"`
+		} `xml:"image"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// ParseSitemap reads the image:loc of every url of a sitemap, or the loc of every sitemap of a sitemap index,
+// relative locations are resolved against the sitemap url
+func ParseSitemap(sitemapUrl *url.URL, reader io.Reader) (Sitemap, error) {
+	var document sitemapDocument
+	if err := xml.NewDecoder(reader).Decode(&document); err != nil {
+		return Sitemap{}, err
+	}
+
+	var sitemap Sitemap
+
+	switch document.XMLName.Local {
+	case "urlset":
+		for _, u := range document.Urls {
+			for _, image := range u.Images {
+				sitemap.Images = appendLoc(sitemap.Images, sitemapUrl, image.Loc)
+			}
+		}
+	case "sitemapindex":
+		for _, s := range document.Sitemaps {
+			sitemap.Sitemaps = appendLoc(sitemap.Sitemaps, sitemapUrl, s.Loc)
+		}
+	default:
+		return Sitemap{}, ErrNotSitemap
+	}
+
+	return sitemap, nil
+}
+
+func appendLoc(locs []string, sitemapUrl *url.URL, loc string) []string {
+	u, err := sitemapUrl.Parse(strings.TrimSpace(loc))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return locs
+	}
+
+	return append(locs, u.String())
+}
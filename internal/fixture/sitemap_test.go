@@ -0,0 +1,50 @@
+package fixture
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSitemap(t *testing.T) {
+	sitemapUrl, _ := url.Parse("https://a.com/sitemap.xml")
+
+	t.Run("returns image urls of an image sitemap", func(t *testing.T) {
+		document := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9" xmlns:image="http://www.google.com/schemas/sitemap-image/1.1">
+	<url>
+		<loc>https://a.com/gallery.html</loc>
+		<image:image><image:loc>https://a.com/a.jpg</image:loc></image:image>
+		<image:image><image:loc> /b.jpg </image:loc></image:image>
+	</url>
+	<url><loc>https://a.com/about.html</loc></url>
+</urlset>`
+
+		sitemap, err := ParseSitemap(sitemapUrl, strings.NewReader(document))
+		assert.NoError(t, err)
+		assert.Equal(t, Sitemap{Images: []string{"https://a.com/a.jpg", "https://a.com/b.jpg"}}, sitemap)
+	})
+
+	t.Run("returns sitemaps of a sitemap index", func(t *testing.T) {
+		document := `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<sitemap><loc>https://a.com/sitemap-1.xml</loc></sitemap>
+	<sitemap><loc>https://a.com/sitemap-2.xml.gz</loc></sitemap>
+</sitemapindex>`
+
+		sitemap, err := ParseSitemap(sitemapUrl, strings.NewReader(document))
+		assert.NoError(t, err)
+		assert.Equal(t, Sitemap{Sitemaps: []string{"https://a.com/sitemap-1.xml", "https://a.com/sitemap-2.xml.gz"}}, sitemap)
+	})
+
+	t.Run("returns error on an xml document of another kind", func(t *testing.T) {
+		_, err := ParseSitemap(sitemapUrl, strings.NewReader(`<rss><channel></channel></rss>`))
+		assert.ErrorIs(t, err, ErrNotSitemap)
+	})
+
+	t.Run("returns error on a malformed document", func(t *testing.T) {
+		_, err := ParseSitemap(sitemapUrl, strings.NewReader(`<urlset><url>`))
+		assert.Error(t, err)
+	})
+}
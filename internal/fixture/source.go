@@ -0,0 +1,123 @@
+package fixture
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// StdinPath reads the fixture piped into the service
+const StdinPath = "-"
+
+var (
+	ErrNoFixtureFound = errors.New("no fixture file found")
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// expandPath lists the fixture files a path stands for: stdin, the files matching a glob pattern or the files
+// of a directory, hidden files and directories are skipped as a shell would
+func expandPath(fixturePath string) ([]string, error) {
+	if fixturePath == StdinPath {
+		return []string{fixturePath}, nil
+	}
+
+	if strings.ContainsAny(fixturePath, "*?[") {
+		matches, err := filepath.Glob(fixturePath)
+		if err != nil {
+			return nil, err
+		}
+
+		var paths []string
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && !info.IsDir() && !hidden(match) {
+				paths = append(paths, match)
+			}
+		}
+
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrNoFixtureFound, fixturePath)
+		}
+
+		return paths, nil
+	}
+
+	info, err := os.Stat(fixturePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []string{fixturePath}, nil
+	}
+
+	entries, err := os.ReadDir(fixturePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		if entry.IsDir() || hidden(entry.Name()) {
+			continue
+		}
+
+		paths = append(paths, filepath.Join(fixturePath, entry.Name()))
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoFixtureFound, fixturePath)
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func hidden(fixturePath string) bool {
+	return strings.HasPrefix(filepath.Base(fixturePath), ".")
+}
+
+// decompress reads a gzip or zstd compressed fixture as plain text, the compression is found by its magic bytes
+// so a compressed fixture piped through stdin is read too
+func decompress(reader io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(reader)
+
+	// a fixture shorter than the magic bytes is not compressed
+	magic, _ := buffered.Peek(len(zstdMagic))
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(buffered)
+	case bytes.HasPrefix(magic, zstdMagic):
+		decoder, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+
+		return decoder.IOReadCloser(), nil
+	default:
+		return io.NopCloser(buffered), nil
+	}
+}
+
+// formatPath strips the compression extension so the format is picked by the extension before it
+func formatPath(fixturePath string) string {
+	switch strings.ToLower(filepath.Ext(fixturePath)) {
+	case ".gz", ".zst":
+		return strings.TrimSuffix(fixturePath, filepath.Ext(fixturePath))
+	default:
+		return fixturePath
+	}
+}
@@ -0,0 +1,123 @@
+package fixture
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandPath(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.txt", "a.csv", ".hidden.txt"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "nested"), 0755))
+
+	t.Run("returns stdin as is", func(t *testing.T) {
+		paths, err := expandPath(StdinPath)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{StdinPath}, paths)
+	})
+
+	t.Run("returns files of a directory in order without hidden files and sub directories", func(t *testing.T) {
+		paths, err := expandPath(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{filepath.Join(dir, "a.csv"), filepath.Join(dir, "b.txt")}, paths)
+	})
+
+	t.Run("returns files matching a glob pattern", func(t *testing.T) {
+		paths, err := expandPath(filepath.Join(dir, "*.txt"))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{filepath.Join(dir, "b.txt")}, paths)
+	})
+
+	t.Run("returns error on a glob pattern matching no file", func(t *testing.T) {
+		_, err := expandPath(filepath.Join(dir, "*.jsonl"))
+		assert.ErrorIs(t, err, ErrNoFixtureFound)
+	})
+
+	t.Run("returns error on a directory without fixture files", func(t *testing.T) {
+		_, err := expandPath(filepath.Join(dir, "nested"))
+		assert.ErrorIs(t, err, ErrNoFixtureFound)
+	})
+
+	t.Run("returns error on a missing file", func(t *testing.T) {
+		_, err := expandPath(filepath.Join(dir, "missing.txt"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestDecompress(t *testing.T) {
+	t.Run("returns plain text as is", func(t *testing.T) {
+		assert.Equal(t, "https://a.com/a.jpg\n", readDecompressed(t, strings.NewReader("https://a.com/a.jpg\n")))
+	})
+
+	t.Run("returns gzip compressed text decompressed", func(t *testing.T) {
+		assert.Equal(t, "https://a.com/a.jpg\n", readDecompressed(t, bytes.NewReader(gzipped(t, "https://a.com/a.jpg\n"))))
+	})
+
+	t.Run("returns zstd compressed text decompressed", func(t *testing.T) {
+		assert.Equal(t, "https://a.com/a.jpg\n", readDecompressed(t, bytes.NewReader(zstded(t, "https://a.com/a.jpg\n"))))
+	})
+
+	t.Run("returns error on corrupted zstd compressed text", func(t *testing.T) {
+		compressed := zstded(t, "https://a.com/a.jpg\n")
+
+		reader, err := decompress(bytes.NewReader(compressed[:len(compressed)-4]))
+		assert.NoError(t, err)
+		defer reader.Close()
+
+		_, err = io.ReadAll(reader)
+		assert.Error(t, err)
+	})
+}
+
+func TestFormatPath(t *testing.T) {
+	t.Run("returns path without its compression extension", func(t *testing.T) {
+		assert.Equal(t, "/fixtures/images.csv", formatPath("/fixtures/images.csv.gz"))
+		assert.Equal(t, "/fixtures/images.jsonl", formatPath("/fixtures/images.jsonl.zst"))
+		assert.Equal(t, "/fixtures/images.txt", formatPath("/fixtures/images.txt"))
+	})
+}
+
+func readDecompressed(t *testing.T, reader io.Reader) string {
+	decompressed, err := decompress(reader)
+	assert.NoError(t, err)
+	defer decompressed.Close()
+
+	content, err := io.ReadAll(decompressed)
+	assert.NoError(t, err)
+
+	return string(content)
+}
+
+func gzipped(t *testing.T, content string) []byte {
+	var buffer bytes.Buffer
+
+	writer := gzip.NewWriter(&buffer)
+	_, err := writer.Write([]byte(content))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	return buffer.Bytes()
+}
+
+func zstded(t *testing.T, content string) []byte {
+	var buffer bytes.Buffer
+
+	writer, err := zstd.NewWriter(&buffer)
+	assert.NoError(t, err)
+
+	_, err = writer.Write([]byte(content))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+
+	return buffer.Bytes()
+}
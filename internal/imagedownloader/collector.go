@@ -0,0 +1,103 @@
+package imagedownloader
+
+import (
+	"sync"
+	"time"
+
+	"fachr.in/image-downloader/pkg/imagedownloader"
+	"fachr.in/image-downloader/pkg/logger"
+)
+
+// collector is the only way results of concurrent download slots reach the reporter, it hands them over
+// one at a time so reporters never need a lock of their own
+type collector struct {
+	mutex    sync.Mutex
+	reporter Reporter
+	summary  Summary
+	start    time.Time
+	finished bool
+	err      error
+}
+
+func newCollector(reporter Reporter) *collector {
+	return &collector{
+		reporter: reporter,
+		summary:  Summary{Statuses: map[Status]int{}},
+		start:    time.Now(),
+	}
+}
+
+func (c *collector) add(status Status, imageInfo ImageInfo) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// the report is already written, a late image must not change it behind its back
+	if c.finished {
+		logger.Errorf("could not report image after the summary, imageInfo: %v", imageInfo)
+		return
+	}
+
+	c.summary.Total++
+	c.summary.Statuses[status]++
+
+	// keep counting once the reporter failed, the first error is returned at the end
+	if c.err != nil {
+		return
+	}
+
+	if err := c.reporter.Report(status, imageInfo); err != nil {
+		logger.Errorf("could not report image, imageInfo: %v, err: %v", imageInfo, err)
+		c.err = err
+	}
+}
+
+// recordLimits keeps the latest adaptive limits for the summary, a limit of 0 is not adaptive
+func (c *collector) recordLimits(concurrency int, host string, hostLimit int) {
+	if concurrency <= 0 && hostLimit <= 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.summary.Limits == nil {
+		c.summary.Limits = &Limits{}
+	}
+
+	if concurrency > 0 {
+		c.summary.Limits.Concurrency = concurrency
+	}
+
+	if hostLimit > 0 {
+		if c.summary.Limits.Hosts == nil {
+			c.summary.Limits.Hosts = map[string]int{}
+		}
+		c.summary.Limits.Hosts[host] = hostLimit
+	}
+}
+
+// recordCircuits keeps the hosts whose circuit opened for the summary
+func (c *collector) recordCircuits(circuits map[string]imagedownloader.BreakerStats) {
+	if len(circuits) == 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.summary.Circuits = circuits
+}
+
+func (c *collector) finish() (Summary, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.finished = true
+	c.summary.DurationMs = time.Since(c.start).Milliseconds()
+
+	if c.err != nil {
+		return c.summary, c.err
+	}
+
+	return c.summary, c.reporter.Finish(c.summary)
+}
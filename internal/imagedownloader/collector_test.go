@@ -0,0 +1,77 @@
+package imagedownloader
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	t.Run("returns every image added from concurrent goroutines exactly once", func(t *testing.T) {
+		reporter := NewOutputReporter(io.Discard)
+		collector := newCollector(reporter)
+
+		var wg sync.WaitGroup
+
+		for g := 0; g < 50; g++ {
+			wg.Add(1)
+
+			go func(g int) {
+				defer wg.Done()
+
+				for i := 0; i < 100; i++ {
+					status := StatusDownloaded
+					if i%2 == 0 {
+						status = StatusFailed
+					}
+
+					collector.add(status, ImageInfo{Url: fmt.Sprintf("https://a.com/%d/%d.jpg", g, i)})
+				}
+			}(g)
+		}
+
+		wg.Wait()
+
+		summary, err := collector.finish()
+		assert.NoError(t, err)
+		assert.Equal(t, 5000, summary.Total)
+		assert.Equal(t, map[Status]int{StatusDownloaded: 2500, StatusFailed: 2500}, summary.Statuses)
+
+		seen := make(map[string]int)
+		for _, imageInfo := range append(reporter.Output.DownloadedImages, reporter.Output.FailedImages...) {
+			seen[imageInfo.Url]++
+		}
+
+		assert.Len(t, seen, 5000)
+		for url, count := range seen {
+			assert.Equal(t, 1, count, url)
+		}
+	})
+
+	t.Run("returns the summary untouched by images added after it", func(t *testing.T) {
+		reporter := NewOutputReporter(io.Discard)
+		collector := newCollector(reporter)
+
+		collector.add(StatusDownloaded, ImageInfo{Url: "https://a.com/a.jpg"})
+		summary, err := collector.finish()
+		assert.NoError(t, err)
+
+		collector.add(StatusDownloaded, ImageInfo{Url: "https://a.com/b.jpg"})
+		assert.Equal(t, 1, summary.Total)
+		assert.Len(t, reporter.Output.DownloadedImages, 1)
+	})
+
+	t.Run("returns the first reporter error while still counting images", func(t *testing.T) {
+		collector := newCollector(NewNDJSONReporter(failingWriter{}))
+
+		collector.add(StatusDownloaded, ImageInfo{Url: "https://a.com/a.jpg"})
+		collector.add(StatusDownloaded, ImageInfo{Url: "https://a.com/b.jpg"})
+
+		summary, err := collector.finish()
+		assert.Error(t, err)
+		assert.Equal(t, 2, summary.Total)
+	})
+}
@@ -1,14 +1,97 @@
 package imagedownloader
 
+import (
+	"fachr.in/image-downloader/pkg/imagedownloader"
+)
+
+type Status string
+
+const (
+	StatusDownloaded  Status = "downloaded"
+	StatusSkipped     Status = "skipped"
+	StatusNotFound    Status = "not_found"
+	StatusInvalid     Status = "invalid"
+	StatusFailed      Status = "failed"
+	StatusResumed     Status = "resumed"
+	StatusMismatched  Status = "mismatched"
+	StatusQuarantined Status = "quarantined"
+	StatusRejected    Status = "rejected"
+	StatusOversized   Status = "oversized"
+	StatusUndersized  Status = "undersized"
+	StatusUnchanged   Status = "unchanged"
+	StatusCancelled   Status = "cancelled"
+	// StatusCircuitOpen is a url failed fast as its host kept failing
+	StatusCircuitOpen Status = "circuit_open"
+	// StatusChecksumMismatch is an image whose sha256 is not the one its fixture record expects
+	StatusChecksumMismatch Status = "checksum_mismatch"
+)
+
 type ImageInfo struct {
-	Url   string `json:"url"`
-	Error string `json:"error,omitempty"`
+	// ID and Category come from the fixture record of the image
+	ID       string `json:"id,omitempty"`
+	Url      string `json:"url"`
+	Category string `json:"category,omitempty"`
+	Key      string `json:"key,omitempty"`
+	SHA256   string `json:"sha256,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	// ExpectedSHA256 is the checksum the fixture record expects the image to have
+	ExpectedSHA256 string `json:"expected_sha256,omitempty"`
+	// Source and Line tell which fixture file and line the url was read from, - being stdin
+	Source string `json:"source,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	// Attempts and StatusCode tell how many requests were made and how the last one was answered
+	Attempts   int `json:"attempts,omitempty"`
+	StatusCode int `json:"status_code,omitempty"`
+	// ContentType is the content type header and DetectedContentType the image format found in the body
+	ContentType         string `json:"content_type,omitempty"`
+	DetectedContentType string `json:"detected_content_type,omitempty"`
+	// Format, Width and Height are decoded from the image when images are validated
+	Format string `json:"format,omitempty"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	// LimiterWaitMs is how long the download waited on its host rate limit and in-flight cap
+	LimiterWaitMs int64 `json:"limiter_wait_ms,omitempty"`
+	// DurationMs is how long the download took, the whole of LimiterWaitMs included
+	DurationMs int64 `json:"duration_ms,omitempty"`
+	// ConcurrencyLimit and HostLimit are the adaptive limits once the download is done, omitted when not adaptive
+	ConcurrencyLimit int    `json:"concurrency_limit,omitempty"`
+	HostLimit        int    `json:"host_limit,omitempty"`
+	Error            string `json:"error,omitempty"`
 }
 
 type Output struct {
-	DownloadedImages []ImageInfo `json:"downloaded_images"`
-	SkippedImages    []ImageInfo `json:"skipped_images"`
-	NotFoundImages   []ImageInfo `json:"not_found_images"`
-	InvalidImages    []ImageInfo `json:"invalid_images"`
-	FailedImages     []ImageInfo `json:"failed_images"`
+	DownloadedImages  []ImageInfo `json:"downloaded_images"`
+	SkippedImages     []ImageInfo `json:"skipped_images"`
+	NotFoundImages    []ImageInfo `json:"not_found_images"`
+	InvalidImages     []ImageInfo `json:"invalid_images"`
+	FailedImages      []ImageInfo `json:"failed_images"`
+	ResumedImages     []ImageInfo `json:"resumed_images"`
+	MismatchedImages  []ImageInfo `json:"mismatched_images"`
+	QuarantinedImages []ImageInfo `json:"quarantined_images"`
+	RejectedImages    []ImageInfo `json:"rejected_images"`
+	OversizedImages   []ImageInfo `json:"oversized_images"`
+	UndersizedImages  []ImageInfo `json:"undersized_images"`
+	UnchangedImages   []ImageInfo `json:"unchanged_images"`
+	CancelledImages   []ImageInfo `json:"cancelled_images"`
+	CircuitOpenImages []ImageInfo `json:"circuit_open_images"`
+	// ChecksumMismatchImages are images whose checksum is not the expected one, none of them is stored
+	ChecksumMismatchImages []ImageInfo `json:"checksum_mismatch_images"`
+	Limits                 *Limits     `json:"limits,omitempty"`
+	// Circuits are the hosts whose circuit opened during the run
+	Circuits map[string]imagedownloader.BreakerStats `json:"circuits,omitempty"`
+}
+
+type Summary struct {
+	Total      int            `json:"total"`
+	Statuses   map[Status]int `json:"statuses"`
+	DurationMs int64          `json:"duration_ms"`
+	// Limits are the adaptive limits the run ended with, nil when they are not adaptive
+	Limits *Limits `json:"limits,omitempty"`
+	// Circuits are the hosts whose circuit opened during the run and the state they ended in
+	Circuits map[string]imagedownloader.BreakerStats `json:"circuits,omitempty"`
+}
+
+type Limits struct {
+	Concurrency int            `json:"concurrency,omitempty"`
+	Hosts       map[string]int `json:"hosts,omitempty"`
 }
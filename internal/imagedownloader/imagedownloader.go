@@ -2,150 +2,487 @@ package imagedownloader
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	uri "net/url"
 	"path"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/oklog/ulid/v2"
 
+	"fachr.in/image-downloader/internal/fixture"
+	"fachr.in/image-downloader/internal/journal"
 	"fachr.in/image-downloader/pkg/imagedownloader"
 	"fachr.in/image-downloader/pkg/logger"
 )
 
 type downloaderClient interface {
-	DownloadImage(ctx context.Context, url string, destinationPath func(contentType string) string) error
+	DownloadImage(ctx context.Context, request imagedownloader.DownloadRequest) (imagedownloader.Result, error)
 }
 
 type fixtureLoader interface {
-	LoadExecute(ctx context.Context, batchExecutor func(urls []string) error) error
+	LoadExecute(ctx context.Context, batchExecutor func(records []fixture.Record) error) error
+}
+
+type downloadJournal interface {
+	Lookup(url string) (journal.Entry, bool)
+	Record(entry journal.Entry) error
+}
+
+type hostLimiter interface {
+	TryAcquire(host string) (release func(), retryIn time.Duration, ok bool)
+}
+
+type circuitBreaker interface {
+	Stats() map[string]imagedownloader.BreakerStats
 }
 
 type ImageDownloader struct {
-	FixtureLoader                    fixtureLoader
-	DownloaderClient                 downloaderClient
-	UlidMakerFn                      func() (id ulid.ULID)
-	Workers                          int
-	StorageRootPath                  string
-	CommonImageContentTypeExtensions map[string]string
+	FixtureLoader    fixtureLoader
+	DownloaderClient downloaderClient
+	Journal          downloadJournal
+	Reporter         Reporter
+	UlidMakerFn      func() (id ulid.ULID)
+	// QueueSize bounds the number of urls queued ahead of their download
+	QueueSize int
+	// Concurrency bounds the number of images downloaded at once and can be resized while they run,
+	// nil downloads QueueSize images at once
+	Concurrency *Semaphore
+	// Adaptive resizes Concurrency to the latency and congestion of finished downloads, nil keeps it as is
+	Adaptive     *imagedownloader.AdaptiveLimit
+	ContentTypes *imagedownloader.ContentTypeRegistry
+	// HostLimiter is the host limiter of DownloaderClient, a host at its in-flight cap or rate limit is skipped
+	// until it has a slot left rather than hold a concurrency slot while waiting for one, nil never skips a host
+	HostLimiter hostLimiter
+	// Breaker is the circuit breaker of DownloaderClient whose opened circuits are summarized, nil summarizes none
+	Breaker circuitBreaker
+	// Stop stops starting downloads once it is closed, queued and unread urls are then reported as cancelled
+	// while in-flight downloads carry on until ctx is done, a nil channel never stops
+	Stop <-chan struct{}
+
+	// limitMutex keeps Concurrency and Adaptive in step when both change it
+	limitMutex sync.Mutex
+}
+
+// SetConcurrency resizes Concurrency while images are downloaded, an adaptive limit carries on from the new limit
+func (i *ImageDownloader) SetConcurrency(limit int) error {
+	if i.Concurrency == nil {
+		return ErrNoConcurrency
+	}
+
+	i.limitMutex.Lock()
+	defer i.limitMutex.Unlock()
+
+	if i.Adaptive != nil {
+		if err := i.Adaptive.SetLimit(limit); err != nil {
+			return err
+		}
+	}
+
+	return i.Concurrency.SetLimit(limit)
+}
+
+// ConcurrencyUsage returns the concurrency limit and how many images are downloaded at once, zero values
+// without Concurrency
+func (i *ImageDownloader) ConcurrencyUsage() (limit, inUse int) {
+	if i.Concurrency == nil {
+		return 0, 0
+	}
+
+	return i.Concurrency.Usage()
 }
 
-func (i *ImageDownloader) DownloadAllImages(ctx context.Context) (*Output, error) {
-	var jobs = make(chan []string)
+func (i *ImageDownloader) DownloadAllImages(ctx context.Context) (Summary, error) {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// stopped is done once no download must start anymore
+	stopped, stop := context.WithCancel(ctx)
+	defer stop()
+
+	go func() {
+		select {
+		case <-i.Stop:
+			stop()
+		case <-stopped.Done():
+		}
+	}()
+
 	var wg sync.WaitGroup
-	var mutex sync.Mutex
+	var collector = newCollector(i.Reporter)
+	var downloads = newScheduler(i.QueueSize)
 
-	var out = Output{
-		DownloadedImages: []ImageInfo{},
-		SkippedImages:    []ImageInfo{},
-		NotFoundImages:   []ImageInfo{},
-		InvalidImages:    []ImageInfo{},
-		FailedImages:     []ImageInfo{},
+	if i.HostLimiter != nil {
+		downloads.acquire = i.HostLimiter.TryAcquire
 	}
 
-	// spawn workers
-	for worker := 0; worker < i.Workers; worker++ {
-		go i.worker(ctx, worker, jobs, &wg, &mutex, &out)
+	concurrency := i.Concurrency
+	if concurrency == nil {
+		concurrency = NewSemaphore(i.QueueSize)
 	}
 
-	enqueueJobs := func(urls []string) error {
-		wg.Add(1)
-		jobs <- urls
+	// dispatch every queued download as soon as the concurrency limit lets it start
+	keys := newDestinationKeys()
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for concurrency.Acquire(ctx) == nil {
+			d, ok := downloads.Pop(ctx)
+			if !ok {
+				concurrency.Release()
+				return
+			}
+
+			if i.stopping(ctx) {
+				d.release()
+				concurrency.Release()
+				collector.add(StatusCancelled, cancelledImage(d.record))
+				continue
+			}
+
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+				defer concurrency.Release()
+				defer d.release()
+
+				i.downloadImage(ctx, d, concurrency, keys, collector)
+			}()
+		}
+	}()
+
+	// claimed are the urls this run went through, a url repeated within the run is downloaded once
+	claimed := make(map[string]bool)
+
+	enqueueDownloads := func(records []fixture.Record) error {
+		for _, record := range records {
+			if err := i.enqueueDownload(stopped, record, claimed, downloads, collector); err != nil {
+				return err
+			}
+		}
 		return nil
 	}
 
-	if err := i.FixtureLoader.LoadExecute(ctx, enqueueJobs); err != nil {
-		return nil, err
+	err := i.FixtureLoader.LoadExecute(ctx, enqueueDownloads)
+	if err != nil {
+		// abandon queued downloads
+		cancel()
 	}
 
-	// shutdown all workers
+	// stop dispatching once the queue is drained
+	downloads.Close()
 	wg.Wait()
-	close(jobs)
 
-	return &out, nil
+	// dispatching stops early once ctx is done, whatever it left queued was never started
+	for _, d := range downloads.Drain() {
+		collector.add(StatusCancelled, cancelledImage(d.record))
+	}
+
+	// a run interrupted or out of time still reports the urls it went through
+	if err != nil && (parent.Err() == nil || !errors.Is(err, parent.Err())) {
+		return Summary{}, err
+	}
+
+	if i.Breaker != nil {
+		collector.recordCircuits(i.Breaker.Stats())
+	}
+
+	return collector.finish()
 }
 
-func (i *ImageDownloader) downloadImages(ctx context.Context, urls []string) Output {
-	var out Output
-	var wg sync.WaitGroup
+func (i *ImageDownloader) enqueueDownload(ctx context.Context, record fixture.Record, claimed map[string]bool, downloads *scheduler, collector *collector) error {
+	url := record.Url
 
-	for _, url := range urls {
-		if _, err := uri.ParseRequestURI(url); err != nil {
-			out.InvalidImages = append(out.InvalidImages, ImageInfo{
-				Url:   url,
-				Error: "image url is invalid",
-			})
-			continue
-		}
+	u, err := uri.ParseRequestURI(url)
+	if err != nil {
+		imageInfo := recordInfo(record)
+		imageInfo.Error = "image url is invalid"
+
+		collector.add(StatusInvalid, imageInfo)
+		return nil
+	}
+
+	// the rest of the fixture is still read once stopped so every unprocessed url is reported
+	if i.stopping(ctx) {
+		collector.add(StatusCancelled, cancelledImage(record))
+		return nil
+	}
 
-		wg.Add(1)
+	// downloads are keyed by url, a url repeated within the run would take the journal entry of the first one
+	if claimed[url] {
+		logger.Infof("skip image repeated in the fixture: %v", url)
 
-		go func(url string) {
-			logger.Infof("downloading an image from url: %v", url)
+		imageInfo := recordInfo(record)
+		imageInfo.Error = "image url is repeated, it is downloaded once"
+
+		collector.add(StatusSkipped, imageInfo)
+		return nil
+	}
 
-			defer wg.Done()
-			err := i.DownloaderClient.DownloadImage(ctx, url, i.destinationPath(url))
+	claimed[url] = true
 
-			imageInfo := ImageInfo{
-				Url: url,
-			}
+	entry, _ := i.lookupJournal(url)
 
-			if err != nil {
-				imageInfo.Error = err.Error()
-				logger.Errorf("could not download image, imageInfo: %v", imageInfo)
-			}
+	if entry.State == journal.StateCompleted {
+		logger.Infof("skip image downloaded in a previous run: %v", url)
 
-			switch err {
-			case nil:
-				logger.Infof("image downloaded: %v", imageInfo)
-				out.DownloadedImages = append(out.DownloadedImages, imageInfo)
-			case imagedownloader.ErrImageNotFound:
-				out.NotFoundImages = append(out.NotFoundImages, imageInfo)
-			case imagedownloader.ErrSkippedContentType:
-				out.SkippedImages = append(out.SkippedImages, imageInfo)
-			default:
-				out.FailedImages = append(out.FailedImages, imageInfo)
-			}
-		}(url)
+		imageInfo := recordInfo(record)
+		imageInfo.Key = entry.Key
+
+		collector.add(StatusResumed, imageInfo)
+		return nil
 	}
 
-	// wait until all images downloaded
-	wg.Wait()
+	// an interrupted download keeps its id so the retried image overwrites the partial one
+	if entry.ID == "" {
+		entry.ID = strings.ToLower(i.UlidMakerFn().String())
+	}
+
+	err = downloads.Push(ctx, download{
+		url:    url,
+		host:   strings.ToLower(u.Hostname()),
+		id:     entry.ID,
+		record: record,
+	})
+
+	if err != nil && i.stopping(ctx) {
+		collector.add(StatusCancelled, cancelledImage(record))
+		return nil
+	}
 
-	return out
+	return err
 }
 
-func (i *ImageDownloader) worker(ctx context.Context, id int, jobs chan []string, wg *sync.WaitGroup, mutex *sync.Mutex, out *Output) {
-	for urls := range jobs {
-		// download images
-		logger.Infof("worker: %d - downloading images from %v", id, urls)
-		result := i.downloadImages(ctx, urls)
+// stopping tells whether no download must start anymore, Stop is checked on its own as ctx might not be
+// canceled yet right after Stop is closed
+func (i *ImageDownloader) stopping(ctx context.Context) bool {
+	select {
+	case <-i.Stop:
+		return true
+	default:
+		return ctx.Err() != nil
+	}
+}
+
+func cancelledImage(record fixture.Record) ImageInfo {
+	imageInfo := recordInfo(record)
+	imageInfo.Error = "download cancelled before it started"
+
+	return imageInfo
+}
+
+// recordInfo reports the fixture metadata of an image
+func recordInfo(record fixture.Record) ImageInfo {
+	return ImageInfo{
+		ID:             record.ID,
+		Url:            record.Url,
+		Category:       record.Category,
+		ExpectedSHA256: record.SHA256,
+		Source:         record.Source,
+		Line:           record.Line,
+	}
+}
+
+func (i *ImageDownloader) downloadImage(ctx context.Context, d download, concurrency *Semaphore, keys *destinationKeys, collector *collector) {
+	logger.Infof("downloading an image from url: %v", d.url)
+	i.recordJournal(journal.Entry{Url: d.url, State: journal.StateStarted, ID: d.id})
+
+	start := time.Now()
+	result, err := i.DownloaderClient.DownloadImage(ctx, imagedownloader.DownloadRequest{
+		Url:            d.url,
+		DestinationKey: i.destinationKey(d.record, d.id, keys),
+		SHA256:         d.record.SHA256,
+		HostAcquired:   d.releaseHost != nil,
+	})
+
+	imageInfo := recordInfo(d.record)
+	imageInfo.Attempts = result.Attempts
+	imageInfo.StatusCode = result.StatusCode
+	imageInfo.ContentType = result.ContentType
+	imageInfo.DetectedContentType = result.DetectedContentType
+	// a rejected image is still reported with whatever is known about it, e.g. its quarantine key
+	imageInfo.Key = result.Key
+	imageInfo.SHA256 = result.SHA256
+	imageInfo.Size = result.Size
+	imageInfo.Format = result.Format
+	imageInfo.Width = result.Width
+	imageInfo.Height = result.Height
+	imageInfo.LimiterWaitMs = (d.limiterWait + result.LimiterWait).Milliseconds()
+	// the host wait ahead of the download is spent before start, it is counted in the duration all the same
+	imageInfo.DurationMs = (d.limiterWait + time.Since(start)).Milliseconds()
+	imageInfo.ConcurrencyLimit = i.adapt(concurrency, result)
+	imageInfo.HostLimit = result.HostLimit
+
+	collector.recordLimits(imageInfo.ConcurrencyLimit, d.host, imageInfo.HostLimit)
+
+	if err != nil {
+		imageInfo.Error = err.Error()
+		logger.Errorf("could not download image, imageInfo: %v", imageInfo)
+		i.recordJournal(journal.Entry{Url: d.url, State: journal.StateFailed, ID: d.id, Error: imageInfo.Error})
+	} else {
+		i.recordJournal(journal.Entry{Url: d.url, State: journal.StateCompleted, ID: d.id, Key: result.Key})
+	}
+
+	status := statusOf(err)
+
+	// an aborted download fails with whatever error the interrupted step returned
+	if err != nil && ctx.Err() != nil {
+		status = StatusCancelled
+	}
+
+	// the server confirmed the image stored by a previous run is still current
+	if status == StatusDownloaded && result.Unchanged {
+		status = StatusUnchanged
+	}
+
+	if status == StatusDownloaded {
+		logger.Infof("image downloaded: %v", imageInfo)
+	}
+
+	collector.add(status, imageInfo)
+}
+
+// adapt resizes concurrency to the outcome of a download and returns its limit, 0 when it is not adaptive
+func (i *ImageDownloader) adapt(concurrency *Semaphore, result imagedownloader.Result) int {
+	if i.Adaptive == nil {
+		return 0
+	}
+
+	// a download that never reached its host tells nothing about it
+	if result.Attempts == 0 {
+		return i.Adaptive.Limit()
+	}
 
-		// collect results
-		mutex.Lock()
-		out.DownloadedImages = append(out.DownloadedImages, result.DownloadedImages...)
-		out.FailedImages = append(out.FailedImages, result.FailedImages...)
-		out.InvalidImages = append(out.InvalidImages, result.InvalidImages...)
-		out.NotFoundImages = append(out.NotFoundImages, result.NotFoundImages...)
-		out.SkippedImages = append(out.SkippedImages, result.SkippedImages...)
+	i.limitMutex.Lock()
+	defer i.limitMutex.Unlock()
 
-		// release resource
-		wg.Done()
-		mutex.Unlock()
+	limit, changed := i.Adaptive.Observe(result.Latency, result.Congested)
+	if changed {
+		_ = concurrency.SetLimit(limit)
+		logger.Infof("concurrency limit adapted to %d", limit)
 	}
+
+	return limit
 }
 
-func (i *ImageDownloader) destinationPath(url string) func(string) string {
-	u, _ := uri.Parse(url)
-	id := i.UlidMakerFn().String()
+// statusOf categorizes the outcome of a download by the error it returned
+func statusOf(err error) Status {
+	switch {
+	case err == nil:
+		return StatusDownloaded
+	case errors.Is(err, imagedownloader.ErrImageNotFound):
+		return StatusNotFound
+	case errors.Is(err, imagedownloader.ErrSkippedContentType):
+		return StatusSkipped
+	case errors.Is(err, imagedownloader.ErrContentTypeMismatch):
+		return StatusMismatched
+	case errors.Is(err, imagedownloader.ErrCorruptImage):
+		return StatusQuarantined
+	case errors.Is(err, imagedownloader.ErrImageDimensions):
+		return StatusRejected
+	case errors.Is(err, imagedownloader.ErrImageTooLarge):
+		return StatusOversized
+	case errors.Is(err, imagedownloader.ErrImageTooSmall):
+		return StatusUndersized
+	case errors.Is(err, imagedownloader.ErrHostCircuitOpen):
+		return StatusCircuitOpen
+	case errors.Is(err, imagedownloader.ErrChecksumMismatch):
+		return StatusChecksumMismatch
+	default:
+		return StatusFailed
+	}
+}
 
-	imageName := path.Base(u.Path)
-	imageNameWithoutExt := strings.TrimSuffix(imageName, path.Ext(imageName))
-	fileName := fmt.Sprintf("%s_%s", imageNameWithoutExt, strings.ToLower(id))
+func (i *ImageDownloader) lookupJournal(url string) (journal.Entry, bool) {
+	if i.Journal == nil {
+		return journal.Entry{}, false
+	}
+
+	return i.Journal.Lookup(url)
+}
+
+func (i *ImageDownloader) recordJournal(entry journal.Entry) {
+	if i.Journal == nil {
+		return
+	}
+
+	if err := i.Journal.Record(entry); err != nil {
+		logger.Errorf("could not record journal entry: %v, err: %v", entry, err)
+	}
+}
+
+// destinationKey names an image <category>/<filename><ext> after its fixture record, an image without a desired
+// file name is named <url base name>_<id> and one without category is stored at the root
+func (i *ImageDownloader) destinationKey(record fixture.Record, id string, keys *destinationKeys) func(string) string {
+	fileName := stem(record.FileName)
+
+	if fileName == "" {
+		u, _ := uri.Parse(record.Url)
+		fileName = fmt.Sprintf("%s_%s", stem(u.Path), id)
+	}
+
+	// a category of several segments such as cars/front is stored in nested folders
+	prefix := ""
+	for _, segment := range strings.Split(record.Category, "/") {
+		if segment = strings.TrimSpace(segment); segment != "" && segment != "." && segment != ".." {
+			prefix += uri.PathEscape(segment) + "/"
+		}
+	}
 
 	return func(contentType string) string {
-		ext := i.CommonImageContentTypeExtensions[contentType]
-		return fmt.Sprintf("%s/%s%s", i.StorageRootPath, uri.PathEscape(fileName), ext)
+		_, ext, _ := i.ContentTypes.Lookup(contentType)
+		key := fmt.Sprintf("%s%s%s", prefix, uri.PathEscape(fileName), ext)
+
+		// records sharing a file name and category would overwrite each other, the later ones are told apart by id
+		if !keys.claim(key, id) {
+			key = fmt.Sprintf("%s%s_%s%s", prefix, uri.PathEscape(fileName), id, ext)
+		}
+
+		return key
 	}
 }
+
+// destinationKeys are the keys the downloads of a run are stored under along with the id of their download
+type destinationKeys struct {
+	mutex  sync.Mutex
+	owners map[string]string
+}
+
+func newDestinationKeys() *destinationKeys {
+	return &destinationKeys{owners: make(map[string]string)}
+}
+
+// claim takes key for the download of id, it returns false when another download of the run took key already
+func (k *destinationKeys) claim(key, id string) bool {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if owner, ok := k.owners[key]; ok {
+		return owner == id
+	}
+
+	k.owners[key] = id
+	return true
+}
+
+// stem is the base name of p without its extension, empty for a name that can't be stored under
+func stem(p string) string {
+	if p == "" {
+		return ""
+	}
+
+	name := path.Base(p)
+	name = strings.TrimSuffix(name, path.Ext(name))
+
+	if name == "." || name == ".." {
+		return ""
+	}
+
+	return name
+}
@@ -7,7 +7,11 @@ package imagedownloader
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
+	fixture "fachr.in/image-downloader/internal/fixture"
+	journal "fachr.in/image-downloader/internal/journal"
+	imagedownloader "fachr.in/image-downloader/pkg/imagedownloader"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -35,17 +39,18 @@ func (m *MockdownloaderClient) EXPECT() *MockdownloaderClientMockRecorder {
 }
 
 // DownloadImage mocks base method.
-func (m *MockdownloaderClient) DownloadImage(ctx context.Context, url string, destinationPath func(string) string) error {
+func (m *MockdownloaderClient) DownloadImage(ctx context.Context, request imagedownloader.DownloadRequest) (imagedownloader.Result, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DownloadImage", ctx, url, destinationPath)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "DownloadImage", ctx, request)
+	ret0, _ := ret[0].(imagedownloader.Result)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // DownloadImage indicates an expected call of DownloadImage.
-func (mr *MockdownloaderClientMockRecorder) DownloadImage(ctx, url, destinationPath interface{}) *gomock.Call {
+func (mr *MockdownloaderClientMockRecorder) DownloadImage(ctx, request interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadImage", reflect.TypeOf((*MockdownloaderClient)(nil).DownloadImage), ctx, url, destinationPath)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadImage", reflect.TypeOf((*MockdownloaderClient)(nil).DownloadImage), ctx, request)
 }
 
 // MockfixtureLoader is a mock of fixtureLoader interface.
@@ -72,7 +77,7 @@ func (m *MockfixtureLoader) EXPECT() *MockfixtureLoaderMockRecorder {
 }
 
 // LoadExecute mocks base method.
-func (m *MockfixtureLoader) LoadExecute(ctx context.Context, batchExecutor func([]string) error) error {
+func (m *MockfixtureLoader) LoadExecute(ctx context.Context, batchExecutor func([]fixture.Record) error) error {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "LoadExecute", ctx, batchExecutor)
 	ret0, _ := ret[0].(error)
@@ -84,3 +89,131 @@ func (mr *MockfixtureLoaderMockRecorder) LoadExecute(ctx, batchExecutor interfac
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoadExecute", reflect.TypeOf((*MockfixtureLoader)(nil).LoadExecute), ctx, batchExecutor)
 }
+
+// MockdownloadJournal is a mock of downloadJournal interface.
+type MockdownloadJournal struct {
+	ctrl     *gomock.Controller
+	recorder *MockdownloadJournalMockRecorder
+}
+
+// MockdownloadJournalMockRecorder is the mock recorder for MockdownloadJournal.
+type MockdownloadJournalMockRecorder struct {
+	mock *MockdownloadJournal
+}
+
+// NewMockdownloadJournal creates a new mock instance.
+func NewMockdownloadJournal(ctrl *gomock.Controller) *MockdownloadJournal {
+	mock := &MockdownloadJournal{ctrl: ctrl}
+	mock.recorder = &MockdownloadJournalMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockdownloadJournal) EXPECT() *MockdownloadJournalMockRecorder {
+	return m.recorder
+}
+
+// Lookup mocks base method.
+func (m *MockdownloadJournal) Lookup(url string) (journal.Entry, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Lookup", url)
+	ret0, _ := ret[0].(journal.Entry)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// Lookup indicates an expected call of Lookup.
+func (mr *MockdownloadJournalMockRecorder) Lookup(url interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Lookup", reflect.TypeOf((*MockdownloadJournal)(nil).Lookup), url)
+}
+
+// Record mocks base method.
+func (m *MockdownloadJournal) Record(entry journal.Entry) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Record", entry)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Record indicates an expected call of Record.
+func (mr *MockdownloadJournalMockRecorder) Record(entry interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Record", reflect.TypeOf((*MockdownloadJournal)(nil).Record), entry)
+}
+
+// MockhostLimiter is a mock of hostLimiter interface.
+type MockhostLimiter struct {
+	ctrl     *gomock.Controller
+	recorder *MockhostLimiterMockRecorder
+}
+
+// MockhostLimiterMockRecorder is the mock recorder for MockhostLimiter.
+type MockhostLimiterMockRecorder struct {
+	mock *MockhostLimiter
+}
+
+// NewMockhostLimiter creates a new mock instance.
+func NewMockhostLimiter(ctrl *gomock.Controller) *MockhostLimiter {
+	mock := &MockhostLimiter{ctrl: ctrl}
+	mock.recorder = &MockhostLimiterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockhostLimiter) EXPECT() *MockhostLimiterMockRecorder {
+	return m.recorder
+}
+
+// TryAcquire mocks base method.
+func (m *MockhostLimiter) TryAcquire(host string) (func(), time.Duration, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TryAcquire", host)
+	ret0, _ := ret[0].(func())
+	ret1, _ := ret[1].(time.Duration)
+	ret2, _ := ret[2].(bool)
+	return ret0, ret1, ret2
+}
+
+// TryAcquire indicates an expected call of TryAcquire.
+func (mr *MockhostLimiterMockRecorder) TryAcquire(host interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TryAcquire", reflect.TypeOf((*MockhostLimiter)(nil).TryAcquire), host)
+}
+
+// MockcircuitBreaker is a mock of circuitBreaker interface.
+type MockcircuitBreaker struct {
+	ctrl     *gomock.Controller
+	recorder *MockcircuitBreakerMockRecorder
+}
+
+// MockcircuitBreakerMockRecorder is the mock recorder for MockcircuitBreaker.
+type MockcircuitBreakerMockRecorder struct {
+	mock *MockcircuitBreaker
+}
+
+// NewMockcircuitBreaker creates a new mock instance.
+func NewMockcircuitBreaker(ctrl *gomock.Controller) *MockcircuitBreaker {
+	mock := &MockcircuitBreaker{ctrl: ctrl}
+	mock.recorder = &MockcircuitBreakerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockcircuitBreaker) EXPECT() *MockcircuitBreakerMockRecorder {
+	return m.recorder
+}
+
+// Stats mocks base method.
+func (m *MockcircuitBreaker) Stats() map[string]imagedownloader.BreakerStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stats")
+	ret0, _ := ret[0].(map[string]imagedownloader.BreakerStats)
+	return ret0
+}
+
+// Stats indicates an expected call of Stats.
+func (mr *MockcircuitBreakerMockRecorder) Stats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockcircuitBreaker)(nil).Stats))
+}
@@ -3,13 +3,24 @@ package imagedownloader
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/oklog/ulid/v2"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
 	"go.uber.org/mock/gomock"
 
 	"fachr.in/image-downloader/internal/fixture"
+	"fachr.in/image-downloader/internal/journal"
 	"fachr.in/image-downloader/pkg/imagedownloader"
 )
 
@@ -24,15 +35,15 @@ func TestImageDownloader_DownloadAllImages(t *testing.T) {
 
 		imageDownloader := &ImageDownloader{
 			FixtureLoader: mockFixture,
-			Workers:       3,
+			QueueSize:     3,
 		}
 
 		// mock functions
-		mockFixture.EXPECT().LoadExecute(ctx, gomock.Any()).Return(errors.New("error"))
+		mockFixture.EXPECT().LoadExecute(gomock.Any(), gomock.Any()).Return(errors.New("error"))
 
-		out, err := imageDownloader.DownloadAllImages(ctx)
+		summary, err := imageDownloader.DownloadAllImages(ctx)
 		assert.Error(t, err)
-		assert.Equal(t, (*Output)(nil), out)
+		assert.Equal(t, Summary{}, summary)
 	})
 
 	t.Run("returns no error when fixture is loaded and executed successfully", func(t *testing.T) {
@@ -40,47 +51,840 @@ func TestImageDownloader_DownloadAllImages(t *testing.T) {
 		defer ctrl.Finish()
 
 		mockDownloaderClient := NewMockdownloaderClient(ctrl)
+		reporter := NewOutputReporter(io.Discard)
 
 		imageDownloader := &ImageDownloader{
 			FixtureLoader: &fixture.Fixture{
 				Path:      "./testdata/images.txt",
 				BatchSize: 20,
 			},
-			DownloaderClient:                 mockDownloaderClient,
-			UlidMakerFn:                      ulid.Make,
-			Workers:                          3,
-			StorageRootPath:                  "/some/storage/path",
-			CommonImageContentTypeExtensions: imagedownloader.CommonImageContentTypeExtensions,
+			DownloaderClient: mockDownloaderClient,
+			Reporter:         reporter,
+			UlidMakerFn:      ulid.Make,
+			QueueSize:        3,
+			ContentTypes:     imagedownloader.NewContentTypeRegistry(imagedownloader.CommonImageContentTypeExtensions, nil),
 		}
 
 		// mock functions
-		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any(), gomock.Any()).Return(imagedownloader.ErrSkippedContentType)
-		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any(), gomock.Any()).Return(imagedownloader.ErrImageNotFound)
-		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any(), gomock.Any()).Return(imagedownloader.ErrFailedImage)
-		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any()).Return(imagedownloader.Result{}, errors.Join(imagedownloader.ErrFetchResponse, imagedownloader.ErrSkippedContentType))
+		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any()).Return(imagedownloader.Result{}, imagedownloader.ErrImageNotFound)
+		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any()).Return(imagedownloader.Result{}, imagedownloader.ErrFailedImage)
+		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any()).Return(imagedownloader.Result{}, nil)
 
-		out, err := imageDownloader.DownloadAllImages(ctx)
+		summary, err := imageDownloader.DownloadAllImages(ctx)
 		assert.NoError(t, err)
+		assert.Equal(t, 5, summary.Total)
+		assert.Equal(t, map[Status]int{
+			StatusDownloaded: 1,
+			StatusSkipped:    1,
+			StatusNotFound:   1,
+			StatusInvalid:    1,
+			StatusFailed:     1,
+		}, summary.Statuses)
+
+		out := reporter.Output
 		assert.Len(t, out.DownloadedImages, 1)
+		assert.Len(t, out.SkippedImages, 1)
 		assert.Len(t, out.FailedImages, 1)
 		assert.Len(t, out.InvalidImages, 1)
 		assert.Len(t, out.NotFoundImages, 1)
 	})
-}
 
-func TestImageDownloader_destinationPath(t *testing.T) {
-	t.Run("returns path based on url and content type", func(t *testing.T) {
+	t.Run("returns resumed images when journal has completed entries", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockDownloaderClient := NewMockdownloaderClient(ctrl)
+		mockJournal := NewMockdownloadJournal(ctrl)
+		reporter := NewOutputReporter(io.Discard)
+
 		imageDownloader := &ImageDownloader{
+			FixtureLoader: &fixture.Fixture{
+				Path:      "./testdata/images.txt",
+				BatchSize: 20,
+			},
+			DownloaderClient: mockDownloaderClient,
+			Journal:          mockJournal,
+			Reporter:         reporter,
 			UlidMakerFn: func() (id ulid.ULID) {
 				return ulid.MustNew(0, nil)
 			},
-			StorageRootPath:                  "/downloads",
-			CommonImageContentTypeExtensions: imagedownloader.CommonImageContentTypeExtensions,
+			QueueSize:    3,
+			ContentTypes: imagedownloader.NewContentTypeRegistry(imagedownloader.CommonImageContentTypeExtensions, nil),
+		}
+
+		// mock functions
+		mockJournal.EXPECT().Lookup("https://a.com/a.jpg").Return(journal.Entry{Url: "https://a.com/a.jpg", State: journal.StateCompleted, Key: "a.jpg"}, true)
+		mockJournal.EXPECT().Lookup("https://b.com/c.png").Return(journal.Entry{Url: "https://b.com/c.png", State: journal.StateStarted, ID: "previous"}, true)
+		mockJournal.EXPECT().Lookup(gomock.Any()).Return(journal.Entry{}, false).Times(2)
+		mockJournal.EXPECT().Record(journal.Entry{Url: "https://b.com/c.png", State: journal.StateStarted, ID: "previous"}).Return(nil)
+		mockJournal.EXPECT().Record(journal.Entry{Url: "https://b.com/c.png", State: journal.StateCompleted, ID: "previous", Key: "c_previous.png"}).Return(nil)
+		mockJournal.EXPECT().Record(gomock.Any()).Return(nil).Times(4)
+
+		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, request imagedownloader.DownloadRequest) (imagedownloader.Result, error) {
+				return imagedownloader.Result{Key: request.DestinationKey("image/png")}, nil
+			}).Times(3)
+
+		_, err := imageDownloader.DownloadAllImages(ctx)
+		assert.NoError(t, err)
+
+		out := reporter.Output
+		assert.Equal(t, []ImageInfo{{Url: "https://a.com/a.jpg", Key: "a.jpg", Source: "./testdata/images.txt", Line: 1}}, out.ResumedImages)
+		assert.Len(t, out.DownloadedImages, 3)
+		assert.Len(t, out.InvalidImages, 1)
+	})
+
+	t.Run("returns a url repeated within a run skipped rather than resumed", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockDownloaderClient := NewMockdownloaderClient(ctrl)
+		reporter := NewOutputReporter(io.Discard)
+
+		downloadJournal, err := journal.Open(filepath.Join(t.TempDir(), "journal.jsonl"), false)
+		assert.NoError(t, err)
+		defer downloadJournal.Close()
+
+		imageDownloader := &ImageDownloader{
+			FixtureLoader: &fixture.Fixture{
+				Path:      fixture.StdinPath,
+				Stdin:     strings.NewReader("https://a.com/a.jpg\nhttps://b.com/b.jpg\nhttps://a.com/a.jpg\n"),
+				BatchSize: 1,
+			},
+			DownloaderClient: mockDownloaderClient,
+			Journal:          downloadJournal,
+			Reporter:         reporter,
+			UlidMakerFn:      ulid.Make,
+			QueueSize:        1,
+			Concurrency:      NewSemaphore(1),
+			ContentTypes:     imagedownloader.NewContentTypeRegistry(imagedownloader.CommonImageContentTypeExtensions, nil),
+		}
+
+		// mock functions
+		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any()).Return(imagedownloader.Result{Key: "a.jpg"}, nil).Times(2)
+
+		summary, err := imageDownloader.DownloadAllImages(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, map[Status]int{
+			StatusDownloaded: 2,
+			StatusSkipped:    1,
+		}, summary.Statuses)
+		assert.Empty(t, reporter.Output.ResumedImages)
+		assert.Equal(t, []ImageInfo{{
+			Url:    "https://a.com/a.jpg",
+			Error:  "image url is repeated, it is downloaded once",
+			Source: fixture.StdinPath,
+			Line:   3,
+		}}, reporter.Output.SkippedImages)
+	})
+
+	t.Run("returns a url repeated within a run skipped without a journal", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockDownloaderClient := NewMockdownloaderClient(ctrl)
+		reporter := NewOutputReporter(io.Discard)
+
+		imageDownloader := &ImageDownloader{
+			FixtureLoader: &fixture.Fixture{
+				Path:      fixture.StdinPath,
+				Stdin:     strings.NewReader("https://a.com/a.jpg\nhttps://b.com/b.jpg\nhttps://a.com/a.jpg\n"),
+				BatchSize: 1,
+			},
+			DownloaderClient: mockDownloaderClient,
+			Reporter:         reporter,
+			UlidMakerFn:      ulid.Make,
+			QueueSize:        1,
+			Concurrency:      NewSemaphore(1),
+			ContentTypes:     imagedownloader.NewContentTypeRegistry(imagedownloader.CommonImageContentTypeExtensions, nil),
+		}
+
+		// mock functions
+		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any()).Return(imagedownloader.Result{Key: "a.jpg"}, nil).Times(2)
+
+		summary, err := imageDownloader.DownloadAllImages(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, map[Status]int{
+			StatusDownloaded: 2,
+			StatusSkipped:    1,
+		}, summary.Statuses)
+		assert.Equal(t, []ImageInfo{{
+			Url:    "https://a.com/a.jpg",
+			Error:  "image url is repeated, it is downloaded once",
+			Source: fixture.StdinPath,
+			Line:   3,
+		}}, reporter.Output.SkippedImages)
+	})
+
+	t.Run("returns unchanged images the server did not modify since a previous run", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockDownloaderClient := NewMockdownloaderClient(ctrl)
+		reporter := NewOutputReporter(io.Discard)
+
+		imageDownloader := &ImageDownloader{
+			FixtureLoader: &fixture.Fixture{
+				Path:      "./testdata/images.txt",
+				BatchSize: 20,
+			},
+			DownloaderClient: mockDownloaderClient,
+			Reporter:         reporter,
+			UlidMakerFn:      ulid.Make,
+			QueueSize:        3,
+			ContentTypes:     imagedownloader.NewContentTypeRegistry(imagedownloader.CommonImageContentTypeExtensions, nil),
+		}
+
+		// mock functions
+		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any()).Return(imagedownloader.Result{Key: "a.jpg", Unchanged: true}, nil).Times(4)
+
+		summary, err := imageDownloader.DownloadAllImages(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, map[Status]int{
+			StatusUnchanged: 4,
+			StatusInvalid:   1,
+		}, summary.Statuses)
+		assert.Len(t, reporter.Output.UnchangedImages, 4)
+		assert.Empty(t, reporter.Output.DownloadedImages)
+	})
+
+	t.Run("returns every image without exceeding the concurrency limit whatever the queue size", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockDownloaderClient := NewMockdownloaderClient(ctrl)
+
+		imageDownloader := &ImageDownloader{
+			FixtureLoader: &fixture.Fixture{
+				Path:      "./testdata/images.txt",
+				BatchSize: 20,
+			},
+			DownloaderClient: mockDownloaderClient,
+			Reporter:         NewOutputReporter(io.Discard),
+			UlidMakerFn:      ulid.Make,
+			QueueSize:        20,
+			Concurrency:      NewSemaphore(2),
+			ContentTypes:     imagedownloader.NewContentTypeRegistry(imagedownloader.CommonImageContentTypeExtensions, nil),
+		}
+
+		var inFlight, maxInFlight int32
+
+		// mock functions
+		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(context.Context, imagedownloader.DownloadRequest) (imagedownloader.Result, error) {
+				n := atomic.AddInt32(&inFlight, 1)
+				defer atomic.AddInt32(&inFlight, -1)
+
+				for {
+					current := atomic.LoadInt32(&maxInFlight)
+					if n <= current || atomic.CompareAndSwapInt32(&maxInFlight, current, n) {
+						break
+					}
+				}
+
+				time.Sleep(time.Duration(10) * time.Millisecond)
+				return imagedownloader.Result{}, nil
+			}).Times(4)
+
+		summary, err := imageDownloader.DownloadAllImages(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, summary.Statuses[StatusDownloaded])
+		assert.Equal(t, int32(2), atomic.LoadInt32(&maxInFlight))
+	})
+
+	t.Run("returns images of other hosts while a host is at its in-flight cap", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockDownloaderClient := NewMockdownloaderClient(ctrl)
+		limiter := &imagedownloader.HostLimiter{Overrides: map[string]imagedownloader.HostLimit{"a.com": {MaxInFlight: 1}}}
+
+		imageDownloader := &ImageDownloader{
+			FixtureLoader: &fixture.Fixture{
+				Path:      fixture.StdinPath,
+				Stdin:     strings.NewReader("https://a.com/1.jpg\nhttps://a.com/2.jpg\nhttps://a.com/3.jpg\nhttps://b.com/1.jpg\nhttps://b.com/2.jpg\n"),
+				BatchSize: 20,
+			},
+			DownloaderClient: mockDownloaderClient,
+			Reporter:         NewOutputReporter(io.Discard),
+			UlidMakerFn:      ulid.Make,
+			QueueSize:        20,
+			Concurrency:      NewSemaphore(2),
+			HostLimiter:      limiter,
+			ContentTypes:     imagedownloader.NewContentTypeRegistry(imagedownloader.CommonImageContentTypeExtensions, nil),
+		}
+
+		var bDownloaded int32
+		bDone := make(chan struct{})
+
+		// mock functions
+		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, request imagedownloader.DownloadRequest) (imagedownloader.Result, error) {
+				host := strings.Split(strings.TrimPrefix(request.Url, "https://"), "/")[0]
+
+				// the client waits for a slot of the host unless the scheduler took it already
+				if !request.HostAcquired {
+					release, _, err := limiter.Acquire(ctx, host)
+					if err != nil {
+						return imagedownloader.Result{}, err
+					}
+
+					defer release()
+				}
+
+				if host == "b.com" {
+					if atomic.AddInt32(&bDownloaded, 1) == 2 {
+						close(bDone)
+					}
+
+					return imagedownloader.Result{}, nil
+				}
+
+				// a.com is slow, the downloads of b.com must not wait behind it
+				select {
+				case <-bDone:
+					return imagedownloader.Result{}, nil
+				case <-time.After(time.Second):
+					return imagedownloader.Result{}, errors.New("b.com stalled behind a.com")
+				}
+			}).Times(5)
+
+		summary, err := imageDownloader.DownloadAllImages(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 5, summary.Statuses[StatusDownloaded])
+	})
+
+	t.Run("returns durations counting the wait for a host", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockDownloaderClient := NewMockdownloaderClient(ctrl)
+		reporter := NewOutputReporter(io.Discard)
+
+		imageDownloader := &ImageDownloader{
+			FixtureLoader: &fixture.Fixture{
+				Path:      fixture.StdinPath,
+				Stdin:     strings.NewReader("https://a.com/1.jpg\nhttps://a.com/2.jpg\n"),
+				BatchSize: 20,
+			},
+			DownloaderClient: mockDownloaderClient,
+			Reporter:         reporter,
+			UlidMakerFn:      ulid.Make,
+			QueueSize:        20,
+			Concurrency:      NewSemaphore(2),
+			HostLimiter:      &imagedownloader.HostLimiter{Overrides: map[string]imagedownloader.HostLimit{"a.com": {MaxInFlight: 1}}},
+			ContentTypes:     imagedownloader.NewContentTypeRegistry(imagedownloader.CommonImageContentTypeExtensions, nil),
+		}
+
+		// mock functions
+		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, request imagedownloader.DownloadRequest) (imagedownloader.Result, error) {
+				time.Sleep(50 * time.Millisecond)
+				return imagedownloader.Result{}, nil
+			}).Times(2)
+
+		_, err := imageDownloader.DownloadAllImages(ctx)
+		assert.NoError(t, err)
+
+		images := reporter.Output.DownloadedImages
+		assert.Len(t, images, 2)
+
+		var limiterWaitMs int64
+		for _, image := range images {
+			assert.GreaterOrEqual(t, image.DurationMs, image.LimiterWaitMs+50)
+			limiterWaitMs += image.LimiterWaitMs
+		}
+
+		assert.Positive(t, limiterWaitMs)
+	})
+
+	t.Run("returns adaptive limits backed off by congested downloads", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockDownloaderClient := NewMockdownloaderClient(ctrl)
+		reporter := NewOutputReporter(io.Discard)
+		concurrency := NewSemaphore(8)
+
+		imageDownloader := &ImageDownloader{
+			FixtureLoader: &fixture.Fixture{
+				Path:      "./testdata/images.txt",
+				BatchSize: 20,
+			},
+			DownloaderClient: mockDownloaderClient,
+			Reporter:         reporter,
+			UlidMakerFn:      ulid.Make,
+			QueueSize:        20,
+			Concurrency:      concurrency,
+			Adaptive:         imagedownloader.NewAdaptiveLimit(imagedownloader.AdaptiveOption{Initial: 8, Max: 16}),
+			ContentTypes:     imagedownloader.NewContentTypeRegistry(imagedownloader.CommonImageContentTypeExtensions, nil),
+		}
+
+		// mock functions
+		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any()).Return(imagedownloader.Result{
+			Attempts:   1,
+			StatusCode: http.StatusServiceUnavailable,
+			Congested:  true,
+			HostLimit:  2,
+		}, imagedownloader.ErrFailedImage).Times(4)
+
+		summary, err := imageDownloader.DownloadAllImages(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, summary.Statuses[StatusFailed])
+		assert.Equal(t, 4, summary.Limits.Concurrency)
+		assert.NotEmpty(t, summary.Limits.Hosts)
+		assert.Equal(t, summary.Limits, reporter.Output.Limits)
+
+		for _, imageInfo := range reporter.Output.FailedImages {
+			assert.Equal(t, 4, imageInfo.ConcurrencyLimit)
+			assert.Equal(t, 2, imageInfo.HostLimit)
+		}
+
+		limit, _ := concurrency.Usage()
+		assert.Equal(t, 4, limit)
+	})
+
+	t.Run("returns adaptive limits backed off from the concurrency limit set while downloading", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockDownloaderClient := NewMockdownloaderClient(ctrl)
+		reporter := NewOutputReporter(io.Discard)
+		concurrency := NewSemaphore(8)
+
+		imageDownloader := &ImageDownloader{
+			FixtureLoader: &fixture.Fixture{
+				Path:      "./testdata/images.txt",
+				BatchSize: 20,
+			},
+			DownloaderClient: mockDownloaderClient,
+			Reporter:         reporter,
+			UlidMakerFn:      ulid.Make,
+			QueueSize:        20,
+			Concurrency:      concurrency,
+			Adaptive:         imagedownloader.NewAdaptiveLimit(imagedownloader.AdaptiveOption{Initial: 8, Max: 16}),
+			ContentTypes:     imagedownloader.NewContentTypeRegistry(imagedownloader.CommonImageContentTypeExtensions, nil),
+		}
+
+		var resized int32
+
+		// mock functions
+		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, request imagedownloader.DownloadRequest) (imagedownloader.Result, error) {
+				// the operator lowers the limit through the admin api while the first images download
+				if atomic.CompareAndSwapInt32(&resized, 0, 1) {
+					assert.NoError(t, imageDownloader.SetConcurrency(2))
+				}
+
+				return imagedownloader.Result{Attempts: 1, StatusCode: http.StatusServiceUnavailable, Congested: true}, imagedownloader.ErrFailedImage
+			}).Times(4)
+
+		summary, err := imageDownloader.DownloadAllImages(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, summary.Statuses[StatusFailed])
+		assert.Equal(t, 1, imageDownloader.Adaptive.Limit())
+
+		limit, _ := concurrency.Usage()
+		assert.Equal(t, 1, limit)
+	})
+
+	t.Run("returns images failed fast by an open circuit and the circuits that opened", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockDownloaderClient := NewMockdownloaderClient(ctrl)
+		mockBreaker := NewMockcircuitBreaker(ctrl)
+		reporter := NewOutputReporter(io.Discard)
+
+		imageDownloader := &ImageDownloader{
+			FixtureLoader: &fixture.Fixture{
+				Path:      "./testdata/images.txt",
+				BatchSize: 20,
+			},
+			DownloaderClient: mockDownloaderClient,
+			Reporter:         reporter,
+			UlidMakerFn:      ulid.Make,
+			QueueSize:        20,
+			Breaker:          mockBreaker,
+			ContentTypes:     imagedownloader.NewContentTypeRegistry(imagedownloader.CommonImageContentTypeExtensions, nil),
 		}
 
-		assert.Equal(t, "/downloads/a_00000000000000000000000000.jpg", imageDownloader.destinationPath("https://a.com/a")("image/jpeg"))
-		assert.Equal(t, "/downloads/a_00000000000000000000000000.jpg", imageDownloader.destinationPath("https://a.com/a.jpeg")("image/jpeg"))
-		assert.Equal(t, "/downloads/%2F_00000000000000000000000000.jpg", imageDownloader.destinationPath("https://a.com/")("image/jpeg"))
-		assert.Equal(t, "/downloads/_00000000000000000000000000.jpg", imageDownloader.destinationPath("https://a.com")("image/jpeg"))
+		circuits := map[string]imagedownloader.BreakerStats{
+			"a.com": {State: imagedownloader.BreakerStateOpen, Opened: 1},
+		}
+
+		// mock functions
+		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any()).Return(
+			imagedownloader.Result{}, errors.Join(imagedownloader.ErrFetchResponse, imagedownloader.ErrHostCircuitOpen)).Times(4)
+		mockBreaker.EXPECT().Stats().Return(circuits)
+
+		summary, err := imageDownloader.DownloadAllImages(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, summary.Statuses[StatusCircuitOpen])
+		assert.Equal(t, circuits, summary.Circuits)
+		assert.Len(t, reporter.Output.CircuitOpenImages, 4)
+		assert.Equal(t, circuits, reporter.Output.Circuits)
+	})
+
+	t.Run("returns images carrying the metadata and origin of their fixture records", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockDownloaderClient := NewMockdownloaderClient(ctrl)
+		reporter := NewOutputReporter(io.Discard)
+
+		imageDownloader := &ImageDownloader{
+			FixtureLoader: &fixture.Fixture{
+				Path:      "./testdata/images.csv",
+				BatchSize: 20,
+			},
+			DownloaderClient: mockDownloaderClient,
+			Reporter:         reporter,
+			UlidMakerFn:      ulid.Make,
+			QueueSize:        20,
+			ContentTypes:     imagedownloader.NewContentTypeRegistry(imagedownloader.CommonImageContentTypeExtensions, nil),
+		}
+
+		// mock functions
+		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, request imagedownloader.DownloadRequest) (imagedownloader.Result, error) {
+				assert.Equal(t, "https://a.com/a.jpg", request.Url)
+				assert.Equal(t, "ab12", request.SHA256)
+
+				return imagedownloader.Result{Key: request.DestinationKey("image/jpeg")}, errors.Join(imagedownloader.ErrCopyImage, imagedownloader.ErrChecksumMismatch)
+			})
+
+		_, err := imageDownloader.DownloadAllImages(ctx)
+		assert.NoError(t, err)
+
+		out := reporter.Output
+		assert.Equal(t, []ImageInfo{{
+			ID:             "7",
+			Url:            "https://a.com/a.jpg",
+			Category:       "cars",
+			Key:            "cars/front.jpg",
+			ExpectedSHA256: "ab12",
+			Source:         "./testdata/images.csv",
+			Line:           2,
+			Error:          out.ChecksumMismatchImages[0].Error,
+			DurationMs:     out.ChecksumMismatchImages[0].DurationMs,
+		}}, out.ChecksumMismatchImages)
+		assert.Equal(t, []ImageInfo{{ID: "8", Url: ":) invalid", Category: "boats", Source: "./testdata/images.csv", Line: 3, Error: "image url is invalid"}}, out.InvalidImages)
+	})
+
+	t.Run("returns in-flight downloads and cancels the rest once stopped", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockDownloaderClient := NewMockdownloaderClient(ctrl)
+		reporter := NewOutputReporter(io.Discard)
+		stop := make(chan struct{})
+
+		imageDownloader := &ImageDownloader{
+			FixtureLoader: &fixture.Fixture{
+				Path:      "./testdata/images.txt",
+				BatchSize: 20,
+			},
+			DownloaderClient: mockDownloaderClient,
+			Reporter:         reporter,
+			UlidMakerFn:      ulid.Make,
+			QueueSize:        1,
+			ContentTypes:     imagedownloader.NewContentTypeRegistry(imagedownloader.CommonImageContentTypeExtensions, nil),
+			Stop:             stop,
+		}
+
+		// mock functions
+		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(context.Context, imagedownloader.DownloadRequest) (imagedownloader.Result, error) {
+				close(stop)
+				return imagedownloader.Result{}, nil
+			})
+
+		summary, err := imageDownloader.DownloadAllImages(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, map[Status]int{
+			StatusDownloaded: 1,
+			StatusCancelled:  3,
+			StatusInvalid:    1,
+		}, summary.Statuses)
+		assert.Len(t, reporter.Output.CancelledImages, 3)
+	})
+
+	t.Run("returns in-flight downloads as cancelled once ctx is done", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockDownloaderClient := NewMockdownloaderClient(ctrl)
+		reporter := NewOutputReporter(io.Discard)
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		imageDownloader := &ImageDownloader{
+			FixtureLoader: &fixture.Fixture{
+				Path:      "./testdata/images.txt",
+				BatchSize: 20,
+			},
+			DownloaderClient: mockDownloaderClient,
+			Reporter:         reporter,
+			UlidMakerFn:      ulid.Make,
+			QueueSize:        1,
+			ContentTypes:     imagedownloader.NewContentTypeRegistry(imagedownloader.CommonImageContentTypeExtensions, nil),
+		}
+
+		// mock functions
+		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, _ imagedownloader.DownloadRequest) (imagedownloader.Result, error) {
+				cancel()
+				<-ctx.Done()
+				return imagedownloader.Result{}, errors.New("net/http: request canceled")
+			})
+
+		summary, err := imageDownloader.DownloadAllImages(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, map[Status]int{
+			StatusCancelled: 4,
+			StatusInvalid:   1,
+		}, summary.Statuses)
+		assert.Len(t, reporter.Output.CancelledImages, 4)
+	})
+
+	t.Run("returns partial summary without leaking goroutines once the fixture loader is canceled", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockFixture := NewMockfixtureLoader(ctrl)
+		mockDownloaderClient := NewMockdownloaderClient(ctrl)
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		imageDownloader := &ImageDownloader{
+			FixtureLoader:    mockFixture,
+			DownloaderClient: mockDownloaderClient,
+			Reporter:         NewOutputReporter(io.Discard),
+			UlidMakerFn:      ulid.Make,
+			QueueSize:        3,
+			ContentTypes:     imagedownloader.NewContentTypeRegistry(imagedownloader.CommonImageContentTypeExtensions, nil),
+		}
+
+		// mock functions
+		mockFixture.EXPECT().LoadExecute(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, batchExecutor func(records []fixture.Record) error) error {
+				assert.NoError(t, batchExecutor([]fixture.Record{{Url: "https://a.com/a.jpg"}, {Url: "https://b.com/b.jpg"}}))
+				cancel()
+				return ctx.Err()
+			})
+		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, _ imagedownloader.DownloadRequest) (imagedownloader.Result, error) {
+				<-ctx.Done()
+				return imagedownloader.Result{}, ctx.Err()
+			}).MaxTimes(2)
+
+		summary, err := imageDownloader.DownloadAllImages(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, map[Status]int{StatusCancelled: 2}, summary.Statuses)
+	})
+
+	t.Run("returns error without leaking goroutines once the fixture loader fails with downloads in flight", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockFixture := NewMockfixtureLoader(ctrl)
+		mockDownloaderClient := NewMockdownloaderClient(ctrl)
+
+		imageDownloader := &ImageDownloader{
+			FixtureLoader:    mockFixture,
+			DownloaderClient: mockDownloaderClient,
+			Reporter:         NewOutputReporter(io.Discard),
+			UlidMakerFn:      ulid.Make,
+			QueueSize:        3,
+			ContentTypes:     imagedownloader.NewContentTypeRegistry(imagedownloader.CommonImageContentTypeExtensions, nil),
+		}
+
+		// mock functions
+		mockFixture.EXPECT().LoadExecute(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, batchExecutor func(records []fixture.Record) error) error {
+				assert.NoError(t, batchExecutor([]fixture.Record{{Url: "https://a.com/a.jpg"}, {Url: "https://b.com/b.jpg"}, {Url: "https://c.com/c.jpg"}}))
+				return errors.New("error")
+			})
+		mockDownloaderClient.EXPECT().DownloadImage(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, _ imagedownloader.DownloadRequest) (imagedownloader.Result, error) {
+				<-ctx.Done()
+				return imagedownloader.Result{}, ctx.Err()
+			}).MaxTimes(3)
+
+		_, err := imageDownloader.DownloadAllImages(ctx)
+		assert.Error(t, err)
+	})
+}
+
+func TestImageDownloader_DownloadAllImages_Stress(t *testing.T) {
+	const total = 2000
+
+	png := []byte("\x89PNG\r\n\x1A\nimage")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// every tenth image is missing
+		if strings.HasSuffix(r.URL.Path, "0.png") {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(png)
+	}))
+	defer server.Close()
+
+	var fixtureLines strings.Builder
+	for i := 0; i < total; i++ {
+		fmt.Fprintf(&fixtureLines, "%s/%d.png\n", server.URL, i)
+	}
+
+	fixturePath := filepath.Join(t.TempDir(), "images.txt")
+	assert.NoError(t, os.WriteFile(fixturePath, []byte(fixtureLines.String()), 0644))
+
+	contentTypes := imagedownloader.NewContentTypeRegistry(imagedownloader.CommonImageContentTypeExtensions, nil)
+	reporter := NewOutputReporter(io.Discard)
+
+	imageDownloader := &ImageDownloader{
+		FixtureLoader: &fixture.Fixture{
+			Path:      fixturePath,
+			BatchSize: 25,
+		},
+		DownloaderClient: &imagedownloader.Client{
+			HTTPClient: &imagedownloader.HTTPClient{
+				BaseClient:   server.Client(),
+				ContentTypes: contentTypes,
+				SniffPolicy:  imagedownloader.SniffPolicyDetect,
+			},
+			Storage:          &imagedownloader.LocalStorage{RootPath: t.TempDir()},
+			CreateTempFileFn: os.CreateTemp,
+		},
+		Reporter:     reporter,
+		UlidMakerFn:  ulid.Make,
+		QueueSize:    64,
+		ContentTypes: contentTypes,
+	}
+
+	summary, err := imageDownloader.DownloadAllImages(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, total, summary.Total)
+	assert.Equal(t, map[Status]int{StatusDownloaded: total * 9 / 10, StatusNotFound: total / 10}, summary.Statuses)
+
+	seen := make(map[string]int, total)
+	for _, imageInfo := range append(reporter.Output.DownloadedImages, reporter.Output.NotFoundImages...) {
+		seen[imageInfo.Url]++
+	}
+
+	assert.Len(t, seen, total)
+	for i := 0; i < total; i++ {
+		url := fmt.Sprintf("%s/%d.png", server.URL, i)
+		assert.Equal(t, 1, seen[url], url)
+	}
+}
+
+func TestImageDownloader_SetConcurrency(t *testing.T) {
+	t.Run("returns the concurrency limit set", func(t *testing.T) {
+		imageDownloader := &ImageDownloader{Concurrency: NewSemaphore(1)}
+
+		assert.NoError(t, imageDownloader.SetConcurrency(3))
+
+		limit, inUse := imageDownloader.ConcurrencyUsage()
+		assert.Equal(t, 3, limit)
+		assert.Equal(t, 0, inUse)
+	})
+
+	t.Run("returns error without a semaphore", func(t *testing.T) {
+		imageDownloader := &ImageDownloader{}
+
+		assert.ErrorIs(t, imageDownloader.SetConcurrency(3), ErrNoConcurrency)
+
+		limit, inUse := imageDownloader.ConcurrencyUsage()
+		assert.Equal(t, 0, limit)
+		assert.Equal(t, 0, inUse)
+	})
+}
+
+func TestImageDownloader_destinationKey(t *testing.T) {
+	t.Run("returns key based on url and content type", func(t *testing.T) {
+		imageDownloader := &ImageDownloader{
+			ContentTypes: imagedownloader.NewContentTypeRegistry(imagedownloader.CommonImageContentTypeExtensions, nil),
+		}
+
+		id := "00000000000000000000000000"
+		keys := newDestinationKeys()
+
+		assert.Equal(t, "a_00000000000000000000000000.jpg", imageDownloader.destinationKey(fixture.Record{Url: "https://a.com/a"}, id, keys)("image/jpeg"))
+		assert.Equal(t, "a_00000000000000000000000000.jpg", imageDownloader.destinationKey(fixture.Record{Url: "https://a.com/a.jpeg"}, id, keys)("image/jpeg"))
+		assert.Equal(t, "%2F_00000000000000000000000000.jpg", imageDownloader.destinationKey(fixture.Record{Url: "https://a.com/"}, id, keys)("image/jpeg"))
+		assert.Equal(t, "_00000000000000000000000000.jpg", imageDownloader.destinationKey(fixture.Record{Url: "https://a.com"}, id, keys)("image/jpeg"))
+	})
+
+	t.Run("returns key based on the desired file name and category of the record", func(t *testing.T) {
+		imageDownloader := &ImageDownloader{
+			ContentTypes: imagedownloader.NewContentTypeRegistry(imagedownloader.CommonImageContentTypeExtensions, nil),
+		}
+
+		id := "00000000000000000000000000"
+		keys := newDestinationKeys()
+
+		assert.Equal(t, "cars/front.jpg", imageDownloader.destinationKey(fixture.Record{Url: "https://a.com/a", FileName: "front.png", Category: "cars"}, id, keys)("image/jpeg"))
+		assert.Equal(t, "front.jpg", imageDownloader.destinationKey(fixture.Record{Url: "https://a.com/a", FileName: "../../front"}, id, keys)("image/jpeg"))
+		assert.Equal(t, "a/a_00000000000000000000000000.jpg", imageDownloader.destinationKey(fixture.Record{Url: "https://a.com/a", FileName: "..", Category: "a"}, id, keys)("image/jpeg"))
+		assert.Equal(t, "a_00000000000000000000000000.jpg", imageDownloader.destinationKey(fixture.Record{Url: "https://a.com/a", Category: ".."}, id, keys)("image/jpeg"))
+	})
+
+	t.Run("returns key in nested folders of a category of several segments", func(t *testing.T) {
+		imageDownloader := &ImageDownloader{
+			ContentTypes: imagedownloader.NewContentTypeRegistry(imagedownloader.CommonImageContentTypeExtensions, nil),
+		}
+
+		id := "00000000000000000000000000"
+		keys := newDestinationKeys()
+
+		assert.Equal(t, "cars/sedan/front.jpg", imageDownloader.destinationKey(fixture.Record{Url: "https://a.com/a", FileName: "front", Category: "cars/sedan"}, id, keys)("image/jpeg"))
+		assert.Equal(t, "cars/a%20b/back.jpg", imageDownloader.destinationKey(fixture.Record{Url: "https://a.com/a", FileName: "back", Category: "/cars/../a b//"}, id, keys)("image/jpeg"))
+		assert.Equal(t, "side.jpg", imageDownloader.destinationKey(fixture.Record{Url: "https://a.com/a", FileName: "side", Category: "../.."}, id, keys)("image/jpeg"))
+	})
+
+	t.Run("returns key told apart by id once another download of the run took it", func(t *testing.T) {
+		imageDownloader := &ImageDownloader{
+			ContentTypes: imagedownloader.NewContentTypeRegistry(imagedownloader.CommonImageContentTypeExtensions, nil),
+		}
+
+		keys := newDestinationKeys()
+		record := fixture.Record{Url: "https://a.com/a", FileName: "front", Category: "cars"}
+
+		first := imageDownloader.destinationKey(record, "a", keys)
+		second := imageDownloader.destinationKey(fixture.Record{Url: "https://a.com/b", FileName: "front", Category: "cars"}, "b", keys)
+
+		assert.Equal(t, "cars/front.jpg", first("image/jpeg"))
+		assert.Equal(t, "cars/front_b.jpg", second("image/jpeg"))
+		assert.Equal(t, "cars/front.png", second("image/png"))
+		// a download asking for its key again, e.g. on a retry, keeps it
+		assert.Equal(t, "cars/front.jpg", first("image/jpeg"))
+		assert.Equal(t, "cars/front_b.jpg", second("image/jpeg"))
+	})
+}
+
+func TestStatusOf(t *testing.T) {
+	t.Run("returns status of wrapped download errors", func(t *testing.T) {
+		assert.Equal(t, StatusDownloaded, statusOf(nil))
+		assert.Equal(t, StatusNotFound, statusOf(imagedownloader.ErrImageNotFound))
+		assert.Equal(t, StatusSkipped, statusOf(errors.Join(imagedownloader.ErrFetchResponse, imagedownloader.ErrSkippedContentType)))
+		assert.Equal(t, StatusMismatched, statusOf(errors.Join(imagedownloader.ErrFetchResponse, imagedownloader.ErrContentTypeMismatch)))
+		assert.Equal(t, StatusQuarantined, statusOf(errors.Join(imagedownloader.ErrCorruptImage, errors.New("unexpected EOF"))))
+		assert.Equal(t, StatusRejected, statusOf(fmt.Errorf("%w: 1x1", imagedownloader.ErrImageDimensions)))
+		assert.Equal(t, StatusOversized, statusOf(errors.Join(imagedownloader.ErrCopyImage, imagedownloader.ErrImageTooLarge)))
+		assert.Equal(t, StatusUndersized, statusOf(imagedownloader.ErrImageTooSmall))
+		assert.Equal(t, StatusChecksumMismatch, statusOf(errors.Join(imagedownloader.ErrCopyImage, imagedownloader.ErrChecksumMismatch)))
+		assert.Equal(t, StatusCircuitOpen, statusOf(errors.Join(imagedownloader.ErrFetchResponse, imagedownloader.ErrHostCircuitOpen)))
+		assert.Equal(t, StatusFailed, statusOf(imagedownloader.ErrFailedImage))
 	})
 }
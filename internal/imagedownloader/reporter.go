@@ -0,0 +1,127 @@
+package imagedownloader
+
+import (
+	"encoding/json"
+	"io"
+
+	"fachr.in/image-downloader/internal/util"
+)
+
+const (
+	recordTypeImage   = "image"
+	recordTypeSummary = "summary"
+)
+
+// Reporter receives the outcome of every url as soon as it is known and a summary once all urls are done,
+// its calls are never made concurrently
+type Reporter interface {
+	Report(status Status, imageInfo ImageInfo) error
+	Finish(summary Summary) error
+}
+
+// OutputReporter aggregates every image into a single Output written as one json document at the end
+type OutputReporter struct {
+	Writer io.Writer
+	Output Output
+}
+
+func NewOutputReporter(w io.Writer) *OutputReporter {
+	return &OutputReporter{
+		Writer: w,
+		Output: Output{
+			DownloadedImages:       []ImageInfo{},
+			SkippedImages:          []ImageInfo{},
+			NotFoundImages:         []ImageInfo{},
+			InvalidImages:          []ImageInfo{},
+			FailedImages:           []ImageInfo{},
+			ResumedImages:          []ImageInfo{},
+			MismatchedImages:       []ImageInfo{},
+			QuarantinedImages:      []ImageInfo{},
+			RejectedImages:         []ImageInfo{},
+			OversizedImages:        []ImageInfo{},
+			UndersizedImages:       []ImageInfo{},
+			UnchangedImages:        []ImageInfo{},
+			CancelledImages:        []ImageInfo{},
+			CircuitOpenImages:      []ImageInfo{},
+			ChecksumMismatchImages: []ImageInfo{},
+		},
+	}
+}
+
+func (o *OutputReporter) Report(status Status, imageInfo ImageInfo) error {
+	switch status {
+	case StatusDownloaded:
+		o.Output.DownloadedImages = append(o.Output.DownloadedImages, imageInfo)
+	case StatusSkipped:
+		o.Output.SkippedImages = append(o.Output.SkippedImages, imageInfo)
+	case StatusNotFound:
+		o.Output.NotFoundImages = append(o.Output.NotFoundImages, imageInfo)
+	case StatusInvalid:
+		o.Output.InvalidImages = append(o.Output.InvalidImages, imageInfo)
+	case StatusResumed:
+		o.Output.ResumedImages = append(o.Output.ResumedImages, imageInfo)
+	case StatusMismatched:
+		o.Output.MismatchedImages = append(o.Output.MismatchedImages, imageInfo)
+	case StatusQuarantined:
+		o.Output.QuarantinedImages = append(o.Output.QuarantinedImages, imageInfo)
+	case StatusRejected:
+		o.Output.RejectedImages = append(o.Output.RejectedImages, imageInfo)
+	case StatusOversized:
+		o.Output.OversizedImages = append(o.Output.OversizedImages, imageInfo)
+	case StatusUndersized:
+		o.Output.UndersizedImages = append(o.Output.UndersizedImages, imageInfo)
+	case StatusUnchanged:
+		o.Output.UnchangedImages = append(o.Output.UnchangedImages, imageInfo)
+	case StatusCancelled:
+		o.Output.CancelledImages = append(o.Output.CancelledImages, imageInfo)
+	case StatusCircuitOpen:
+		o.Output.CircuitOpenImages = append(o.Output.CircuitOpenImages, imageInfo)
+	case StatusChecksumMismatch:
+		o.Output.ChecksumMismatchImages = append(o.Output.ChecksumMismatchImages, imageInfo)
+	default:
+		o.Output.FailedImages = append(o.Output.FailedImages, imageInfo)
+	}
+
+	return nil
+}
+
+func (o *OutputReporter) Finish(summary Summary) error {
+	o.Output.Limits = summary.Limits
+	o.Output.Circuits = summary.Circuits
+	return util.JsonWrite(o.Writer, o.Output)
+}
+
+// NDJSONReporter streams one json line per image as it finishes, followed by a summary line
+type NDJSONReporter struct {
+	encoder *json.Encoder
+}
+
+type imageRecord struct {
+	Type   string `json:"type"`
+	Status Status `json:"status"`
+	ImageInfo
+}
+
+type summaryRecord struct {
+	Type string `json:"type"`
+	Summary
+}
+
+func NewNDJSONReporter(w io.Writer) *NDJSONReporter {
+	return &NDJSONReporter{encoder: json.NewEncoder(w)}
+}
+
+func (n *NDJSONReporter) Report(status Status, imageInfo ImageInfo) error {
+	return n.encoder.Encode(imageRecord{
+		Type:      recordTypeImage,
+		Status:    status,
+		ImageInfo: imageInfo,
+	})
+}
+
+func (n *NDJSONReporter) Finish(summary Summary) error {
+	return n.encoder.Encode(summaryRecord{
+		Type:    recordTypeSummary,
+		Summary: summary,
+	})
+}
@@ -0,0 +1,64 @@
+package imagedownloader
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write(_ []byte) (int, error) {
+	return 0, errors.New("error")
+}
+
+func TestOutputReporter(t *testing.T) {
+	t.Run("returns every image grouped by its status", func(t *testing.T) {
+		var buf bytes.Buffer
+		reporter := NewOutputReporter(&buf)
+
+		assert.NoError(t, reporter.Report(StatusDownloaded, ImageInfo{Url: "https://a.com/a.jpg", Key: "a.jpg"}))
+		assert.NoError(t, reporter.Report(StatusNotFound, ImageInfo{Url: "https://b.com/b.jpg"}))
+		assert.NoError(t, reporter.Report(StatusFailed, ImageInfo{Url: "https://c.com/c.jpg"}))
+
+		// nothing is written until the end
+		assert.Empty(t, buf.String())
+
+		assert.NoError(t, reporter.Finish(Summary{Total: 3}))
+		assert.Equal(t, []ImageInfo{{Url: "https://a.com/a.jpg", Key: "a.jpg"}}, reporter.Output.DownloadedImages)
+		assert.Equal(t, []ImageInfo{{Url: "https://b.com/b.jpg"}}, reporter.Output.NotFoundImages)
+		assert.Equal(t, []ImageInfo{{Url: "https://c.com/c.jpg"}}, reporter.Output.FailedImages)
+		assert.Contains(t, buf.String(), `"downloaded_images": [`)
+		assert.Contains(t, buf.String(), `"skipped_images": []`)
+	})
+
+	t.Run("returns error when couldn't write the output", func(t *testing.T) {
+		reporter := NewOutputReporter(failingWriter{})
+		assert.Error(t, reporter.Finish(Summary{}))
+	})
+}
+
+func TestNDJSONReporter(t *testing.T) {
+	t.Run("returns one line per image followed by the summary", func(t *testing.T) {
+		var buf bytes.Buffer
+		reporter := NewNDJSONReporter(&buf)
+
+		assert.NoError(t, reporter.Report(StatusDownloaded, ImageInfo{Url: "https://a.com/a.jpg", Key: "a.jpg", Size: 5, DurationMs: 12}))
+		assert.Equal(t, `{"type":"image","status":"downloaded","url":"https://a.com/a.jpg","key":"a.jpg","size":5,"duration_ms":12}`+"\n", buf.String())
+
+		buf.Reset()
+		assert.NoError(t, reporter.Report(StatusFailed, ImageInfo{Url: "https://b.com/b.jpg", Error: "error"}))
+		assert.Equal(t, `{"type":"image","status":"failed","url":"https://b.com/b.jpg","error":"error"}`+"\n", buf.String())
+
+		buf.Reset()
+		assert.NoError(t, reporter.Finish(Summary{Total: 2, Statuses: map[Status]int{StatusDownloaded: 1, StatusFailed: 1}, DurationMs: 20}))
+		assert.Equal(t, `{"type":"summary","total":2,"statuses":{"downloaded":1,"failed":1},"duration_ms":20}`+"\n", buf.String())
+	})
+
+	t.Run("returns error when couldn't write a line", func(t *testing.T) {
+		reporter := NewNDJSONReporter(failingWriter{})
+		assert.Error(t, reporter.Report(StatusDownloaded, ImageInfo{}))
+	})
+}
@@ -0,0 +1,246 @@
+package imagedownloader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"fachr.in/image-downloader/internal/fixture"
+)
+
+var (
+	ErrSchedulerClosed = errors.New("could not schedule a download on a closed scheduler")
+)
+
+type download struct {
+	url  string
+	host string
+	id   string
+	// record carries the fixture metadata of the url into its naming, verification and report
+	record fixture.Record
+
+	// releaseHost releases the host slot taken ahead of the download, nil when none was taken
+	releaseHost func()
+	// limiterWait is how long the host had no slot left for the download
+	limiterWait time.Duration
+}
+
+func (d download) release() {
+	if d.releaseHost != nil {
+		d.releaseHost()
+	}
+}
+
+// scheduler queues downloads per host and hands them out round-robin across hosts,
+// so a host with many queued urls can't starve the others of download slots
+type scheduler struct {
+	capacity int
+	// acquire takes a slot of a host ahead of its download, a host it returns none for is skipped until
+	// retryIn is over or a download is released, nil never skips a host
+	acquire func(host string) (release func(), retryIn time.Duration, ok bool)
+
+	mutex  sync.Mutex
+	queues map[string][]download
+	hosts  []string
+	next   int
+	size   int
+	closed bool
+	// blocked holds since when a host is skipped, retryIn how long until a rate limited host lets a download through
+	blocked map[string]time.Time
+	retryIn time.Duration
+
+	// changed is closed and replaced on every state change to wake up waiting pushes and pops
+	changed chan struct{}
+}
+
+func newScheduler(capacity int) *scheduler {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &scheduler{
+		capacity: capacity,
+		queues:   make(map[string][]download),
+		blocked:  make(map[string]time.Time),
+		changed:  make(chan struct{}),
+	}
+}
+
+// Push queues a download, it blocks while the scheduler holds capacity downloads
+func (s *scheduler) Push(ctx context.Context, d download) error {
+	for {
+		s.mutex.Lock()
+
+		if s.closed {
+			s.mutex.Unlock()
+			return ErrSchedulerClosed
+		}
+
+		if s.size < s.capacity {
+			if _, ok := s.queues[d.host]; !ok {
+				s.hosts = append(s.hosts, d.host)
+			}
+
+			s.queues[d.host] = append(s.queues[d.host], d)
+			s.size++
+			s.notify()
+			s.mutex.Unlock()
+
+			return nil
+		}
+
+		changed := s.changed
+		s.mutex.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Pop takes the next download of the next host in turn which has a slot left, it returns false once the scheduler
+// is closed and drained or ctx is done
+func (s *scheduler) Pop(ctx context.Context) (download, bool) {
+	for {
+		s.mutex.Lock()
+
+		if d, ok := s.pop(); ok {
+			s.notify()
+			s.mutex.Unlock()
+
+			return d, true
+		}
+
+		if s.closed && s.size == 0 {
+			s.mutex.Unlock()
+			return download{}, false
+		}
+
+		changed, retryIn := s.changed, s.retryIn
+		s.mutex.Unlock()
+
+		// a rate limited host is not released, it is tried again once its rate lets a download through
+		var retry *time.Timer
+		var retried <-chan time.Time
+
+		if retryIn > 0 {
+			retry = time.NewTimer(retryIn)
+			retried = retry.C
+		}
+
+		select {
+		case <-changed:
+		case <-retried:
+		case <-ctx.Done():
+		}
+
+		if retry != nil {
+			retry.Stop()
+		}
+
+		if ctx.Err() != nil {
+			return download{}, false
+		}
+	}
+}
+
+// Drain takes every queued download without a host slot, they are never downloaded
+func (s *scheduler) Drain() []download {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var downloads []download
+	for _, host := range s.hosts {
+		downloads = append(downloads, s.queues[host]...)
+	}
+
+	s.queues = make(map[string][]download)
+	s.blocked = make(map[string]time.Time)
+	s.hosts = nil
+	s.size = 0
+	s.notify()
+
+	return downloads
+}
+
+// Close stops accepting downloads, queued downloads are still handed out
+func (s *scheduler) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closed = true
+	s.notify()
+}
+
+func (s *scheduler) pop() (download, bool) {
+	s.retryIn = 0
+
+	for k := range s.hosts {
+		i := (s.next + k) % len(s.hosts)
+		host := s.hosts[i]
+
+		var releaseHost func()
+		var limiterWait time.Duration
+
+		if s.acquire != nil {
+			release, retryIn, ok := s.acquire(host)
+			if !ok {
+				if _, ok := s.blocked[host]; !ok {
+					s.blocked[host] = time.Now()
+				}
+
+				if retryIn > 0 && (s.retryIn == 0 || retryIn < s.retryIn) {
+					s.retryIn = retryIn
+				}
+
+				continue
+			}
+
+			releaseHost = s.released(release)
+
+			if since, ok := s.blocked[host]; ok {
+				limiterWait = time.Since(since)
+				delete(s.blocked, host)
+			}
+		}
+
+		queue := s.queues[host]
+		d := queue[0]
+		d.releaseHost, d.limiterWait = releaseHost, limiterWait
+
+		if len(queue) > 1 {
+			s.queues[host] = queue[1:]
+			s.next = i + 1
+		} else {
+			// the following host moves into the current position of the drained host
+			delete(s.queues, host)
+			s.hosts = append(s.hosts[:i], s.hosts[i+1:]...)
+			s.next = i
+		}
+
+		s.size--
+		return d, true
+	}
+
+	return download{}, false
+}
+
+// released wakes up a waiting pop once a host slot is released as the host might be skipped
+func (s *scheduler) released(release func()) func() {
+	return func() {
+		release()
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		s.notify()
+	}
+}
+
+func (s *scheduler) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
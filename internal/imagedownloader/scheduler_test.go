@@ -0,0 +1,196 @@
+package imagedownloader
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns downloads round-robin across hosts", func(t *testing.T) {
+		downloads := newScheduler(10)
+
+		for _, d := range []download{
+			{url: "a1", host: "a.com"},
+			{url: "a2", host: "a.com"},
+			{url: "a3", host: "a.com"},
+			{url: "b1", host: "b.com"},
+			{url: "c1", host: "c.com"},
+			{url: "c2", host: "c.com"},
+		} {
+			assert.NoError(t, downloads.Push(ctx, d))
+		}
+
+		downloads.Close()
+
+		var urls []string
+		for {
+			d, ok := downloads.Pop(ctx)
+			if !ok {
+				break
+			}
+			urls = append(urls, d.url)
+		}
+
+		assert.Equal(t, []string{"a1", "b1", "c1", "a2", "c2", "a3"}, urls)
+	})
+
+	t.Run("returns error when context is done while the scheduler is full", func(t *testing.T) {
+		downloads := newScheduler(1)
+		assert.NoError(t, downloads.Push(ctx, download{url: "a1", host: "a.com"}))
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		assert.ErrorIs(t, downloads.Push(timeoutCtx, download{url: "b1", host: "b.com"}), context.DeadlineExceeded)
+	})
+
+	t.Run("returns once a full scheduler hands out a download", func(t *testing.T) {
+		downloads := newScheduler(1)
+		assert.NoError(t, downloads.Push(ctx, download{url: "a1", host: "a.com"}))
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			downloads.Pop(ctx)
+		}()
+
+		assert.NoError(t, downloads.Push(ctx, download{url: "a2", host: "a.com"}))
+
+		d, ok := downloads.Pop(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, "a2", d.url)
+	})
+
+	t.Run("returns error when pushing to a closed scheduler", func(t *testing.T) {
+		downloads := newScheduler(1)
+		downloads.Close()
+
+		assert.ErrorIs(t, downloads.Push(ctx, download{url: "a1", host: "a.com"}), ErrSchedulerClosed)
+	})
+
+	t.Run("returns nothing when context is done while the scheduler is empty", func(t *testing.T) {
+		downloads := newScheduler(1)
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		_, ok := downloads.Pop(timeoutCtx)
+		assert.False(t, ok)
+	})
+
+	t.Run("returns queued downloads to a waiting pop", func(t *testing.T) {
+		downloads := newScheduler(1)
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			_ = downloads.Push(ctx, download{url: "a1", host: "a.com"})
+		}()
+
+		d, ok := downloads.Pop(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, "a1", d.url)
+	})
+
+	t.Run("returns downloads of other hosts while a host has no slot left", func(t *testing.T) {
+		downloads := newScheduler(10)
+
+		var mutex sync.Mutex
+		aInFlight := 0
+
+		downloads.acquire = func(host string) (func(), time.Duration, bool) {
+			if host != "a.com" {
+				return func() {}, 0, true
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if aInFlight == 1 {
+				return nil, 0, false
+			}
+
+			aInFlight++
+
+			return func() {
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				aInFlight--
+			}, 0, true
+		}
+
+		for _, d := range []download{
+			{url: "a1", host: "a.com"},
+			{url: "a2", host: "a.com"},
+			{url: "b1", host: "b.com"},
+			{url: "b2", host: "b.com"},
+		} {
+			assert.NoError(t, downloads.Push(ctx, d))
+		}
+
+		downloads.Close()
+
+		a1, _ := downloads.Pop(ctx)
+		b1, _ := downloads.Pop(ctx)
+		b2, _ := downloads.Pop(ctx)
+		assert.Equal(t, []string{"a1", "b1", "b2"}, []string{a1.url, b1.url, b2.url})
+
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			a1.release()
+		}()
+
+		a2, ok := downloads.Pop(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, "a2", a2.url)
+		assert.GreaterOrEqual(t, a2.limiterWait, 10*time.Millisecond)
+
+		_, ok = downloads.Pop(ctx)
+		assert.False(t, ok)
+	})
+
+	t.Run("returns a download of a rate limited host once its rate lets it through", func(t *testing.T) {
+		downloads := newScheduler(10)
+
+		due := time.Now().Add(20 * time.Millisecond)
+		downloads.acquire = func(host string) (func(), time.Duration, bool) {
+			if wait := time.Until(due); wait > 0 {
+				return nil, wait, false
+			}
+
+			return func() {}, 0, true
+		}
+
+		assert.NoError(t, downloads.Push(ctx, download{url: "a1", host: "a.com"}))
+
+		d, ok := downloads.Pop(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, "a1", d.url)
+		assert.False(t, time.Now().Before(due))
+	})
+
+	t.Run("returns every queued download drained without a host slot", func(t *testing.T) {
+		downloads := newScheduler(10)
+		downloads.acquire = func(host string) (func(), time.Duration, bool) {
+			return nil, 0, false
+		}
+
+		assert.NoError(t, downloads.Push(ctx, download{url: "a1", host: "a.com"}))
+		assert.NoError(t, downloads.Push(ctx, download{url: "b1", host: "b.com"}))
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		_, ok := downloads.Pop(timeoutCtx)
+		assert.False(t, ok)
+
+		drained := downloads.Drain()
+		assert.Len(t, drained, 2)
+		assert.Nil(t, drained[0].releaseHost)
+	})
+}
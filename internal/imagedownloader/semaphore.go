@@ -0,0 +1,88 @@
+package imagedownloader
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	ErrInvalidConcurrency = errors.New("concurrency limit must be greater than 0")
+	ErrNoConcurrency      = errors.New("concurrency limit could not be changed without a semaphore")
+)
+
+// Semaphore bounds how many images are downloaded at once, its limit can be changed while downloads run
+type Semaphore struct {
+	mutex sync.Mutex
+	limit int
+	inUse int
+	// changed is closed and replaced on every change, waiters select on it to retry
+	changed chan struct{}
+}
+
+func NewSemaphore(limit int) *Semaphore {
+	return &Semaphore{
+		limit:   limit,
+		changed: make(chan struct{}),
+	}
+}
+
+// Acquire blocks until a download may start or ctx is done
+func (s *Semaphore) Acquire(ctx context.Context) error {
+	for {
+		s.mutex.Lock()
+
+		if s.inUse < s.limit {
+			s.inUse++
+			s.mutex.Unlock()
+
+			return nil
+		}
+
+		changed := s.changed
+		s.mutex.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *Semaphore) Release() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.inUse--
+	s.notify()
+}
+
+// SetLimit changes the limit right away, lowering it lets in-flight downloads finish but holds back new ones
+// until fewer than limit are left
+func (s *Semaphore) SetLimit(limit int) error {
+	if limit <= 0 {
+		return ErrInvalidConcurrency
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.limit = limit
+	s.notify()
+
+	return nil
+}
+
+// Usage returns the current limit and how many downloads hold it
+func (s *Semaphore) Usage() (limit int, inUse int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.limit, s.inUse
+}
+
+func (s *Semaphore) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
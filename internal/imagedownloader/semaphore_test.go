@@ -0,0 +1,81 @@
+package imagedownloader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSemaphore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns error once ctx is done while the limit is reached", func(t *testing.T) {
+		semaphore := NewSemaphore(2)
+		assert.NoError(t, semaphore.Acquire(ctx))
+		assert.NoError(t, semaphore.Acquire(ctx))
+
+		ctx, cancel := context.WithTimeout(ctx, time.Duration(10)*time.Millisecond)
+		defer cancel()
+
+		assert.ErrorIs(t, semaphore.Acquire(ctx), context.DeadlineExceeded)
+
+		limit, inUse := semaphore.Usage()
+		assert.Equal(t, 2, limit)
+		assert.Equal(t, 2, inUse)
+	})
+
+	t.Run("returns a waiting acquire once the limit is raised", func(t *testing.T) {
+		semaphore := NewSemaphore(1)
+		assert.NoError(t, semaphore.Acquire(ctx))
+
+		acquired := make(chan error)
+		go func() {
+			acquired <- semaphore.Acquire(ctx)
+		}()
+
+		select {
+		case <-acquired:
+			t.Fatal("acquired beyond the limit")
+		case <-time.After(time.Duration(10) * time.Millisecond):
+		}
+
+		assert.NoError(t, semaphore.SetLimit(2))
+		assert.NoError(t, <-acquired)
+	})
+
+	t.Run("returns a waiting acquire only once enough permits are released under a lowered limit", func(t *testing.T) {
+		semaphore := NewSemaphore(3)
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, semaphore.Acquire(ctx))
+		}
+
+		assert.NoError(t, semaphore.SetLimit(1))
+
+		acquired := make(chan error)
+		go func() {
+			acquired <- semaphore.Acquire(ctx)
+		}()
+
+		semaphore.Release()
+		semaphore.Release()
+
+		select {
+		case <-acquired:
+			t.Fatal("acquired beyond the lowered limit")
+		case <-time.After(time.Duration(10) * time.Millisecond):
+		}
+
+		semaphore.Release()
+		assert.NoError(t, <-acquired)
+	})
+
+	t.Run("returns error on a limit below 1", func(t *testing.T) {
+		semaphore := NewSemaphore(1)
+		assert.ErrorIs(t, semaphore.SetLimit(0), ErrInvalidConcurrency)
+
+		limit, _ := semaphore.Usage()
+		assert.Equal(t, 1, limit)
+	})
+}
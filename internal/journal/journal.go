@@ -0,0 +1,102 @@
+package journal
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"fachr.in/image-downloader/internal/jsonl"
+)
+
+type State string
+
+const (
+	StateStarted   State = "started"
+	StateCompleted State = "completed"
+	StateFailed    State = "failed"
+)
+
+type Entry struct {
+	Url   string `json:"url"`
+	State State  `json:"state"`
+	ID    string `json:"id,omitempty"`
+	Key   string `json:"key,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Journal is an append-only log of every url's download state, the last entry of a url wins
+type Journal struct {
+	mutex   sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	// previous are the entries loaded from the runs resumed
+	previous map[string]Entry
+}
+
+// Open creates a new journal at path, or continues the existing one when resume is true
+func Open(path string, resume bool) (*Journal, error) {
+	entries := make(map[string]Entry)
+
+	if resume {
+		var err error
+		if entries, err = load(path); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := jsonl.OpenAppend(path, resume)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Journal{
+		file:     file,
+		encoder:  json.NewEncoder(file),
+		previous: entries,
+	}, nil
+}
+
+// Lookup returns the last entry a previous run left for url, the entries of this run are not returned
+// so a url repeated within a run is never taken for one resumed
+func (j *Journal) Lookup(url string) (Entry, bool) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	entry, ok := j.previous[url]
+	return entry, ok
+}
+
+func (j *Journal) Record(entry Entry) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return j.encoder.Encode(entry)
+}
+
+func (j *Journal) Close() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return j.file.Close()
+}
+
+func load(path string) (map[string]Entry, error) {
+	entries := make(map[string]Entry)
+
+	err := jsonl.Load(path, func(line []byte) {
+		var entry Entry
+
+		// a crash might leave the last line half written, such url is simply downloaded again
+		if err := json.Unmarshal(line, &entry); err != nil || entry.Url == "" {
+			return
+		}
+
+		entries[entry.Url] = entry
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,75 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournal(t *testing.T) {
+	t.Run("returns error when journal could not be opened", func(t *testing.T) {
+		_, err := Open(filepath.Join(t.TempDir(), "non/existing/dir/journal.jsonl"), false)
+		assert.Error(t, err)
+	})
+
+	t.Run("returns no entry recorded by the same run", func(t *testing.T) {
+		j, err := Open(filepath.Join(t.TempDir(), "journal.jsonl"), false)
+		assert.NoError(t, err)
+		defer j.Close()
+
+		assert.NoError(t, j.Record(Entry{Url: "https://a.com/a.jpg", State: StateStarted, ID: "a"}))
+		assert.NoError(t, j.Record(Entry{Url: "https://a.com/a.jpg", State: StateCompleted, ID: "a", Key: "a.jpg"}))
+
+		_, ok := j.Lookup("https://a.com/a.jpg")
+		assert.False(t, ok)
+	})
+
+	t.Run("returns previous entries on resume and none on a fresh start", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "journal.jsonl")
+
+		j, err := Open(path, false)
+		assert.NoError(t, err)
+		assert.NoError(t, j.Record(Entry{Url: "https://a.com/a.jpg", State: StateCompleted, Key: "a.jpg"}))
+		assert.NoError(t, j.Record(Entry{Url: "https://b.com/b.jpg", State: StateStarted, ID: "b"}))
+		assert.NoError(t, j.Close())
+
+		j, err = Open(path, true)
+		assert.NoError(t, err)
+
+		entry, ok := j.Lookup("https://b.com/b.jpg")
+		assert.True(t, ok)
+		assert.Equal(t, StateStarted, entry.State)
+		assert.NoError(t, j.Close())
+
+		j, err = Open(path, false)
+		assert.NoError(t, err)
+
+		_, ok = j.Lookup("https://a.com/a.jpg")
+		assert.False(t, ok)
+		assert.NoError(t, j.Close())
+	})
+
+	t.Run("ignores a half written entry on resume", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "journal.jsonl")
+		content := `{"url":"https://a.com/a.jpg","state":"completed"}` + "\n" + `{"url":"https://b.com/b.jp`
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+		j, err := Open(path, true)
+		assert.NoError(t, err)
+		assert.NoError(t, j.Record(Entry{Url: "https://c.com/c.jpg", State: StateFailed}))
+		assert.NoError(t, j.Close())
+
+		j, err = Open(path, true)
+		assert.NoError(t, err)
+		defer j.Close()
+
+		_, ok := j.Lookup("https://a.com/a.jpg")
+		assert.True(t, ok)
+		_, ok = j.Lookup("https://b.com/b.jpg")
+		assert.False(t, ok)
+		_, ok = j.Lookup("https://c.com/c.jpg")
+		assert.True(t, ok)
+	})
+}
@@ -0,0 +1,69 @@
+package jsonl
+
+import (
+	"bufio"
+	"errors"
+	"os"
+)
+
+// Load calls apply with every line of the append-only json lines log at path, a missing log has no lines;
+// a crash might leave the last line half written, so apply must skip a line that doesn't decode
+func Load(path string, apply func(line []byte)) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		apply(scanner.Bytes())
+	}
+
+	return scanner.Err()
+}
+
+// OpenAppend creates a new log at path, or appends to the existing one when resume is true
+func OpenAppend(path string, resume bool) (*os.File, error) {
+	flag := os.O_CREATE | os.O_RDWR | os.O_APPEND
+	if !resume {
+		flag |= os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := terminateLastLine(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// terminateLastLine makes sure new lines are not appended onto a half written line
+func terminateLastLine(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+
+	lastByte := make([]byte, 1)
+
+	if _, err := file.ReadAt(lastByte, info.Size()-1); err != nil {
+		return err
+	}
+
+	if lastByte[0] == '\n' {
+		return nil
+	}
+
+	_, err = file.Write([]byte("\n"))
+	return err
+}
@@ -0,0 +1,72 @@
+package jsonl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("returns no line of a missing log", func(t *testing.T) {
+		var lines []string
+
+		err := Load(filepath.Join(t.TempDir(), "log.jsonl"), func(line []byte) {
+			lines = append(lines, string(line))
+		})
+
+		assert.NoError(t, err)
+		assert.Empty(t, lines)
+	})
+
+	t.Run("returns every line along with a half written last line", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.jsonl")
+		assert.NoError(t, os.WriteFile(path, []byte("{\"a\":1}\n{\"b\":"), 0644))
+
+		var lines []string
+
+		err := Load(path, func(line []byte) {
+			lines = append(lines, string(line))
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{`{"a":1}`, `{"b":`}, lines)
+	})
+}
+
+func TestOpenAppend(t *testing.T) {
+	t.Run("returns a log appending after a half written last line", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.jsonl")
+		assert.NoError(t, os.WriteFile(path, []byte("{\"a\":1}\n{\"b\":"), 0644))
+
+		file, err := OpenAppend(path, true)
+		assert.NoError(t, err)
+
+		_, err = file.Write([]byte("{\"c\":3}\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, file.Close())
+
+		b, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, "{\"a\":1}\n{\"b\":\n{\"c\":3}\n", string(b))
+	})
+
+	t.Run("returns an empty log unless resumed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "log.jsonl")
+		assert.NoError(t, os.WriteFile(path, []byte("{\"a\":1}\n"), 0644))
+
+		file, err := OpenAppend(path, false)
+		assert.NoError(t, err)
+		assert.NoError(t, file.Close())
+
+		b, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Empty(t, b)
+	})
+
+	t.Run("returns error when log could not be opened", func(t *testing.T) {
+		_, err := OpenAppend(filepath.Join(t.TempDir(), "non/existing/dir/log.jsonl"), false)
+		assert.Error(t, err)
+	})
+}
@@ -3,16 +3,21 @@ package util
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 )
 
 func JsonStdout(data interface{}) error {
+	return JsonWrite(os.Stdout, data)
+}
+
+func JsonWrite(w io.Writer, data interface{}) error {
 	b, err := json.MarshalIndent(data, "", "	")
 	if err != nil {
 		return err
 	}
 
-	if _, err := fmt.Fprintln(os.Stdout, string(b)); err != nil {
+	if _, err := fmt.Fprintln(w, string(b)); err != nil {
 		return err
 	}
 
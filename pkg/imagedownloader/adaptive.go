@@ -0,0 +1,123 @@
+package imagedownloader
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// backoffFactor is what a limit is multiplied by on congestion
+	backoffFactor = 0.5
+)
+
+type AdaptiveOption struct {
+	Initial int
+	Min     int
+	Max     int
+	// LatencyTarget is the response time above which the limit stops growing, 0 ignores latency
+	LatencyTarget time.Duration
+}
+
+var (
+	ErrAdaptiveLimitBounds = errors.New("limit is out of the adaptive limit bounds")
+)
+
+// AdaptiveLimit is an AIMD limit: it grows by one once a whole limit of downloads came back healthy
+// and is halved on a timeout, a 429 or a 5xx response
+type AdaptiveLimit struct {
+	option AdaptiveOption
+
+	mutex sync.Mutex
+	limit int
+	// healthy counts healthy downloads since the limit last grew
+	healthy int
+	// decreased and sinceDecrease hold back another decrease until the downloads in flight during
+	// the last one came back, so a burst of congested responses halves the limit once
+	decreased     bool
+	sinceDecrease int
+}
+
+func NewAdaptiveLimit(option AdaptiveOption) *AdaptiveLimit {
+	if option.Min < 1 {
+		option.Min = 1
+	}
+
+	if option.Max < option.Min {
+		option.Max = option.Min
+	}
+
+	limit := option.Initial
+	if limit < option.Min {
+		limit = option.Min
+	}
+
+	if limit > option.Max {
+		limit = option.Max
+	}
+
+	return &AdaptiveLimit{
+		option: option,
+		limit:  limit,
+	}
+}
+
+// Observe adjusts the limit by the outcome of a download and returns the limit and whether it changed
+func (a *AdaptiveLimit) Observe(latency time.Duration, congested bool) (limit int, changed bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	before := a.limit
+	a.sinceDecrease++
+
+	switch {
+	case congested:
+		if a.decreased && a.sinceDecrease <= before {
+			return before, false
+		}
+
+		a.limit = int(float64(a.limit) * backoffFactor)
+		if a.limit < a.option.Min {
+			a.limit = a.option.Min
+		}
+
+		a.healthy = 0
+		a.decreased = true
+		a.sinceDecrease = 0
+	// a slow host is not failing yet but more downloads would not make it faster
+	case a.option.LatencyTarget > 0 && latency > a.option.LatencyTarget:
+	default:
+		a.healthy++
+		if a.healthy >= a.limit && a.limit < a.option.Max {
+			a.limit++
+			a.healthy = 0
+		}
+	}
+
+	return a.limit, a.limit != before
+}
+
+// SetLimit replaces the limit, e.g. by an operator, so the next observations grow or back off from it
+func (a *AdaptiveLimit) SetLimit(limit int) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if limit < a.option.Min || limit > a.option.Max {
+		return fmt.Errorf("%w: %d not within %d and %d", ErrAdaptiveLimitBounds, limit, a.option.Min, a.option.Max)
+	}
+
+	a.limit = limit
+	a.healthy = 0
+	a.decreased = false
+	a.sinceDecrease = 0
+
+	return nil
+}
+
+func (a *AdaptiveLimit) Limit() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.limit
+}
@@ -0,0 +1,98 @@
+package imagedownloader
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAdaptiveLimit(t *testing.T) {
+	t.Run("returns initial limit clamped between min and max", func(t *testing.T) {
+		assert.Equal(t, 1, NewAdaptiveLimit(AdaptiveOption{}).Limit())
+		assert.Equal(t, 4, NewAdaptiveLimit(AdaptiveOption{Initial: 2, Min: 4, Max: 8}).Limit())
+		assert.Equal(t, 8, NewAdaptiveLimit(AdaptiveOption{Initial: 16, Min: 4, Max: 8}).Limit())
+	})
+}
+
+func TestAdaptiveLimit_Observe(t *testing.T) {
+	t.Run("returns limit grown by one after a whole limit of healthy downloads", func(t *testing.T) {
+		limit := NewAdaptiveLimit(AdaptiveOption{Initial: 4, Max: 10})
+
+		for i := 0; i < 3; i++ {
+			got, changed := limit.Observe(time.Millisecond, false)
+			assert.Equal(t, 4, got)
+			assert.False(t, changed)
+		}
+
+		got, changed := limit.Observe(time.Millisecond, false)
+		assert.Equal(t, 5, got)
+		assert.True(t, changed)
+	})
+
+	t.Run("returns limit capped by max", func(t *testing.T) {
+		limit := NewAdaptiveLimit(AdaptiveOption{Initial: 2, Max: 3})
+
+		for i := 0; i < 100; i++ {
+			limit.Observe(time.Millisecond, false)
+		}
+
+		assert.Equal(t, 3, limit.Limit())
+	})
+
+	t.Run("returns unchanged limit on downloads slower than the latency target", func(t *testing.T) {
+		limit := NewAdaptiveLimit(AdaptiveOption{Initial: 2, Max: 10, LatencyTarget: time.Second})
+
+		for i := 0; i < 10; i++ {
+			limit.Observe(2*time.Second, false)
+		}
+
+		assert.Equal(t, 2, limit.Limit())
+	})
+
+	t.Run("returns halved limit once per burst of congested downloads", func(t *testing.T) {
+		limit := NewAdaptiveLimit(AdaptiveOption{Initial: 16, Min: 2, Max: 16})
+
+		got, changed := limit.Observe(time.Millisecond, true)
+		assert.Equal(t, 8, got)
+		assert.True(t, changed)
+
+		// the rest of the downloads in flight during the decrease
+		for i := 0; i < 8; i++ {
+			got, changed = limit.Observe(time.Millisecond, true)
+			assert.Equal(t, 8, got)
+			assert.False(t, changed)
+		}
+
+		got, _ = limit.Observe(time.Millisecond, true)
+		assert.Equal(t, 4, got)
+	})
+
+	t.Run("returns limit no lower than min", func(t *testing.T) {
+		limit := NewAdaptiveLimit(AdaptiveOption{Initial: 3, Min: 2, Max: 16})
+
+		got, _ := limit.Observe(time.Millisecond, true)
+		assert.Equal(t, 2, got)
+	})
+}
+
+func TestAdaptiveLimit_SetLimit(t *testing.T) {
+	t.Run("returns limit grown from the limit set", func(t *testing.T) {
+		limit := NewAdaptiveLimit(AdaptiveOption{Initial: 8, Max: 16})
+		assert.NoError(t, limit.SetLimit(2))
+		assert.Equal(t, 2, limit.Limit())
+
+		limit.Observe(time.Millisecond, false)
+		got, changed := limit.Observe(time.Millisecond, false)
+		assert.Equal(t, 3, got)
+		assert.True(t, changed)
+	})
+
+	t.Run("returns error on a limit out of bounds", func(t *testing.T) {
+		limit := NewAdaptiveLimit(AdaptiveOption{Initial: 8, Min: 2, Max: 16})
+
+		assert.ErrorIs(t, limit.SetLimit(1), ErrAdaptiveLimitBounds)
+		assert.ErrorIs(t, limit.SetLimit(17), ErrAdaptiveLimitBounds)
+		assert.Equal(t, 8, limit.Limit())
+	})
+}
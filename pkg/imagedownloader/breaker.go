@@ -0,0 +1,208 @@
+package imagedownloader
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"fachr.in/image-downloader/pkg/logger"
+)
+
+type BreakerState string
+
+const (
+	BreakerStateClosed   BreakerState = "closed"
+	BreakerStateOpen     BreakerState = "open"
+	BreakerStateHalfOpen BreakerState = "half_open"
+)
+
+// breakerOutcome is what a request allowed through a circuit tells about its host
+type breakerOutcome int
+
+const (
+	breakerSuccess breakerOutcome = iota
+	breakerFailure
+	// breakerIgnored is a request canceled by its caller, it tells nothing about the host
+	breakerIgnored
+)
+
+var (
+	ErrHostCircuitOpen = errors.New("host circuit is open, request not sent")
+)
+
+type BreakerOption struct {
+	// FailureRatio is the share of failed requests within Window that opens the circuit of a host
+	FailureRatio float64
+	// MinRequests is how many requests within Window are needed before the failure ratio is judged
+	MinRequests int
+	// Window is how long failures are counted for before counting starts over, 0 never starts over
+	Window time.Duration
+	// OpenTimeout is how long an open circuit fails fast before it lets probes through
+	OpenTimeout time.Duration
+	// HalfOpenProbes is how many probes are let through a half-open circuit, all of them must succeed to close it
+	HalfOpenProbes int
+}
+
+// BreakerStats tells the state a host circuit is in and how many times it opened
+type BreakerStats struct {
+	State  BreakerState `json:"state"`
+	Opened int          `json:"opened"`
+}
+
+// HostBreaker is a circuit breaker per host: a closed circuit opens once too many requests to its host fail,
+// an open one fails fast until OpenTimeout is over, then a half-open one probes the host to close again
+type HostBreaker struct {
+	Option BreakerOption
+
+	mutex sync.Mutex
+	hosts map[string]*breakerState
+}
+
+type breakerState struct {
+	state  BreakerState
+	opened int
+	// generation changes on every transition so outcomes of requests allowed before it are ignored
+	generation int
+
+	windowStart time.Time
+	requests    int
+	failures    int
+
+	openUntil time.Time
+	probes    int
+	succeeded int
+}
+
+// Allow fails fast with ErrHostCircuitOpen while the circuit of host is open, otherwise done must be called
+// with the outcome of the request
+func (h *HostBreaker) Allow(host string) (done func(outcome breakerOutcome), err error) {
+	host = strings.ToLower(host)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	state := h.state(host)
+	now := time.Now()
+
+	if state.state == BreakerStateOpen {
+		if now.Before(state.openUntil) {
+			return nil, ErrHostCircuitOpen
+		}
+
+		h.transition(host, state, BreakerStateHalfOpen, now)
+	}
+
+	if state.state == BreakerStateHalfOpen {
+		if state.probes >= h.halfOpenProbes() {
+			return nil, ErrHostCircuitOpen
+		}
+
+		state.probes++
+	}
+
+	generation := state.generation
+
+	return func(outcome breakerOutcome) {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+
+		if state.generation == generation {
+			h.record(host, state, outcome, time.Now())
+		}
+	}, nil
+}
+
+// Stats returns the circuit of every host that has been open at least once
+func (h *HostBreaker) Stats() map[string]BreakerStats {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	stats := make(map[string]BreakerStats)
+	for host, state := range h.hosts {
+		if state.opened > 0 {
+			stats[host] = BreakerStats{State: state.state, Opened: state.opened}
+		}
+	}
+
+	return stats
+}
+
+func (h *HostBreaker) state(host string) *breakerState {
+	if h.hosts == nil {
+		h.hosts = make(map[string]*breakerState)
+	}
+
+	state, ok := h.hosts[host]
+	if !ok {
+		state = &breakerState{state: BreakerStateClosed, windowStart: time.Now()}
+		h.hosts[host] = state
+	}
+
+	return state
+}
+
+func (h *HostBreaker) record(host string, state *breakerState, outcome breakerOutcome, now time.Time) {
+	if outcome == breakerIgnored {
+		// a canceled probe makes way for another one
+		if state.state == BreakerStateHalfOpen {
+			state.probes--
+		}
+		return
+	}
+
+	failed := outcome == breakerFailure
+
+	if state.state == BreakerStateHalfOpen {
+		if failed {
+			h.transition(host, state, BreakerStateOpen, now)
+			return
+		}
+
+		state.succeeded++
+		if state.succeeded >= h.halfOpenProbes() {
+			h.transition(host, state, BreakerStateClosed, now)
+		}
+		return
+	}
+
+	if h.Option.Window > 0 && now.Sub(state.windowStart) > h.Option.Window {
+		state.windowStart = now
+		state.requests = 0
+		state.failures = 0
+	}
+
+	state.requests++
+	if failed {
+		state.failures++
+	}
+
+	if failed && state.requests >= h.Option.MinRequests && float64(state.failures) >= h.Option.FailureRatio*float64(state.requests) {
+		h.transition(host, state, BreakerStateOpen, now)
+	}
+}
+
+func (h *HostBreaker) halfOpenProbes() int {
+	if h.Option.HalfOpenProbes < 1 {
+		return 1
+	}
+
+	return h.Option.HalfOpenProbes
+}
+
+func (h *HostBreaker) transition(host string, state *breakerState, to BreakerState, now time.Time) {
+	logger.Infof("circuit of host %s changed from %s to %s", host, state.state, to)
+
+	state.state = to
+	state.generation++
+	state.windowStart = now
+	state.requests = 0
+	state.failures = 0
+	state.probes = 0
+	state.succeeded = 0
+
+	if to == BreakerStateOpen {
+		state.opened++
+		state.openUntil = now.Add(h.Option.OpenTimeout)
+	}
+}
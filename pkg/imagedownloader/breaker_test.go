@@ -0,0 +1,121 @@
+package imagedownloader
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostBreaker_Allow(t *testing.T) {
+	option := BreakerOption{FailureRatio: 0.5, MinRequests: 4, OpenTimeout: 20 * time.Millisecond, HalfOpenProbes: 2}
+
+	t.Run("returns no error while the failure ratio stays below the threshold", func(t *testing.T) {
+		breaker := &HostBreaker{Option: option}
+
+		for i := 0; i < 20; i++ {
+			done, err := breaker.Allow("a.com")
+			assert.NoError(t, err)
+
+			if i%4 == 0 {
+				done(breakerFailure)
+			} else {
+				done(breakerSuccess)
+			}
+		}
+
+		assert.Empty(t, breaker.Stats())
+	})
+
+	t.Run("returns circuit open error once the failure ratio is reached", func(t *testing.T) {
+		breaker := &HostBreaker{Option: option}
+		failRequests(t, breaker, "a.com", 4)
+
+		_, err := breaker.Allow("A.com")
+		assert.ErrorIs(t, err, ErrHostCircuitOpen)
+
+		_, err = breaker.Allow("b.com")
+		assert.NoError(t, err)
+
+		assert.Equal(t, map[string]BreakerStats{"a.com": {State: BreakerStateOpen, Opened: 1}}, breaker.Stats())
+	})
+
+	t.Run("returns closed circuit once every probe succeeds after the open timeout", func(t *testing.T) {
+		breaker := &HostBreaker{Option: option}
+		failRequests(t, breaker, "a.com", 4)
+
+		time.Sleep(option.OpenTimeout)
+
+		first, err := breaker.Allow("a.com")
+		assert.NoError(t, err)
+		second, err := breaker.Allow("a.com")
+		assert.NoError(t, err)
+
+		// only the probes get through a half-open circuit
+		_, err = breaker.Allow("a.com")
+		assert.ErrorIs(t, err, ErrHostCircuitOpen)
+
+		first(breakerSuccess)
+		second(breakerSuccess)
+
+		_, err = breaker.Allow("a.com")
+		assert.NoError(t, err)
+		assert.Equal(t, BreakerStateClosed, breaker.Stats()["a.com"].State)
+	})
+
+	t.Run("returns open circuit again once a probe fails", func(t *testing.T) {
+		breaker := &HostBreaker{Option: option}
+		failRequests(t, breaker, "a.com", 4)
+
+		time.Sleep(option.OpenTimeout)
+
+		done, err := breaker.Allow("a.com")
+		assert.NoError(t, err)
+		done(breakerFailure)
+
+		_, err = breaker.Allow("a.com")
+		assert.ErrorIs(t, err, ErrHostCircuitOpen)
+		assert.Equal(t, BreakerStats{State: BreakerStateOpen, Opened: 2}, breaker.Stats()["a.com"])
+	})
+
+	t.Run("returns another probe in place of a canceled one", func(t *testing.T) {
+		breaker := &HostBreaker{Option: BreakerOption{FailureRatio: 1, MinRequests: 1, OpenTimeout: time.Millisecond}}
+		failRequests(t, breaker, "a.com", 1)
+
+		time.Sleep(time.Millisecond)
+
+		done, err := breaker.Allow("a.com")
+		assert.NoError(t, err)
+		done(breakerIgnored)
+
+		_, err = breaker.Allow("a.com")
+		assert.NoError(t, err)
+	})
+
+	t.Run("returns no error on outcomes of requests allowed before the circuit opened", func(t *testing.T) {
+		breaker := &HostBreaker{Option: BreakerOption{FailureRatio: 1, MinRequests: 1, OpenTimeout: time.Millisecond}}
+
+		late, err := breaker.Allow("a.com")
+		assert.NoError(t, err)
+		failRequests(t, breaker, "a.com", 1)
+
+		time.Sleep(time.Millisecond)
+
+		probe, err := breaker.Allow("a.com")
+		assert.NoError(t, err)
+
+		// a late failure must not reopen the half-open circuit
+		late(breakerFailure)
+		probe(breakerSuccess)
+
+		assert.Equal(t, BreakerStateClosed, breaker.Stats()["a.com"].State)
+	})
+}
+
+func failRequests(t *testing.T, breaker *HostBreaker, host string, n int) {
+	for i := 0; i < n; i++ {
+		done, err := breaker.Allow(host)
+		assert.NoError(t, err)
+		done(breakerFailure)
+	}
+}
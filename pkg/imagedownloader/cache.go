@@ -0,0 +1,134 @@
+package imagedownloader
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"fachr.in/image-downloader/internal/jsonl"
+)
+
+const (
+	etagHeaderKey            = "ETag"
+	lastModifiedHeaderKey    = "Last-Modified"
+	ifNoneMatchHeaderKey     = "If-None-Match"
+	ifModifiedSinceHeaderKey = "If-Modified-Since"
+)
+
+// CacheEntry remembers the validators of a downloaded url along with where its image was stored
+type CacheEntry struct {
+	Url          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Key          string `json:"key"`
+	SHA256       string `json:"sha256,omitempty"`
+	Size         int64  `json:"size,omitempty"`
+	ContentType  string `json:"content_type,omitempty"`
+}
+
+// FileCacheStore is an append-only json lines file of cache entries, the last entry of a url wins
+type FileCacheStore struct {
+	mutex   sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	entries map[string]CacheEntry
+}
+
+// OpenFileCacheStore loads the cache file at path, compacting it to the latest entry of every url
+func OpenFileCacheStore(path string) (*FileCacheStore, error) {
+	entries, err := loadCacheEntries(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeCacheEntries(path, entries); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileCacheStore{
+		file:    file,
+		encoder: json.NewEncoder(file),
+		entries: entries,
+	}, nil
+}
+
+func (f *FileCacheStore) Get(url string) (CacheEntry, bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	entry, ok := f.entries[url]
+	return entry, ok, nil
+}
+
+func (f *FileCacheStore) Put(entry CacheEntry) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.entries[entry.Url] = entry
+	return f.encoder.Encode(entry)
+}
+
+func (f *FileCacheStore) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.file.Close()
+}
+
+func loadCacheEntries(path string) (map[string]CacheEntry, error) {
+	entries := make(map[string]CacheEntry)
+
+	err := jsonl.Load(path, func(line []byte) {
+		var entry CacheEntry
+
+		// a crash might leave the last line half written, such url is simply downloaded in full again
+		if err := json.Unmarshal(line, &entry); err != nil || entry.Url == "" {
+			return
+		}
+
+		entries[entry.Url] = entry
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// writeCacheEntries replaces the cache file atomically so a crash never loses the previous entries
+func writeCacheEntries(path string, entries map[string]CacheEntry) error {
+	file, err := os.CreateTemp(filepath.Dir(path), ".cache-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,62 @@
+package imagedownloader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileCacheStore(t *testing.T) {
+	t.Run("returns nothing from a missing cache file", func(t *testing.T) {
+		store, err := OpenFileCacheStore(filepath.Join(t.TempDir(), "cache.jsonl"))
+		assert.NoError(t, err)
+		defer store.Close()
+
+		_, ok, err := store.Get("https://a.com/a.jpg")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("returns the latest entry of a url across runs", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cache.jsonl")
+
+		store, err := OpenFileCacheStore(path)
+		assert.NoError(t, err)
+		assert.NoError(t, store.Put(CacheEntry{Url: "https://a.com/a.jpg", ETag: `"v1"`, Key: "a.jpg"}))
+		assert.NoError(t, store.Put(CacheEntry{Url: "https://a.com/a.jpg", ETag: `"v2"`, Key: "a.jpg"}))
+		assert.NoError(t, store.Close())
+
+		store, err = OpenFileCacheStore(path)
+		assert.NoError(t, err)
+		defer store.Close()
+
+		entry, ok, err := store.Get("https://a.com/a.jpg")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, `"v2"`, entry.ETag)
+	})
+
+	t.Run("skips malformed lines and compacts the cache file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cache.jsonl")
+		content := `{"url":"https://a.com/a.jpg","etag":"\"v1\"","key":"a.jpg"}` + "\n" +
+			`{"url":"https://a.com/a.jpg","etag":"\"v2\"","key":"a.jpg"}` + "\n" +
+			`{"url":"https://a.com/b.jpg","etag`
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+		store, err := OpenFileCacheStore(path)
+		assert.NoError(t, err)
+		defer store.Close()
+
+		entry, ok, _ := store.Get("https://a.com/a.jpg")
+		assert.True(t, ok)
+		assert.Equal(t, `"v2"`, entry.ETag)
+
+		_, ok, _ = store.Get("https://a.com/b.jpg")
+		assert.False(t, ok)
+
+		compacted, _ := os.ReadFile(path)
+		assert.Equal(t, `{"url":"https://a.com/a.jpg","etag":"\"v2\"","key":"a.jpg"}`+"\n", string(compacted))
+	})
+}
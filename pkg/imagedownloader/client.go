@@ -2,10 +2,20 @@ package imagedownloader
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"hash"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"os"
+	"path"
+	"strings"
+	"time"
+
+	"fachr.in/image-downloader/pkg/logger"
 )
 
 const (
@@ -13,58 +23,449 @@ const (
 )
 
 var (
-	ErrMakeRequest   = errors.New("could not build http request")
-	ErrFetchResponse = errors.New("could not fetch http response")
-	ErrImageNotFound = errors.New("could not download a non-existing image")
-	ErrFailedImage   = errors.New("could not download an invalid image")
-	ErrOpenImageFile = errors.New("could not create a new image file")
-	ErrCopyImage     = errors.New("could not copy image into the destination path")
+	ErrMakeRequest      = errors.New("could not build http request")
+	ErrFetchResponse    = errors.New("could not fetch http response")
+	ErrImageNotFound    = errors.New("could not download a non-existing image")
+	ErrFailedImage      = errors.New("could not download an invalid image")
+	ErrOpenImageFile    = errors.New("could not create a new image file")
+	ErrCopyImage        = errors.New("could not copy image into the destination path")
+	ErrStoreImage       = errors.New("could not store image at its content addressed path")
+	ErrIncompleteImage  = errors.New("image body is shorter or longer than its content length")
+	ErrImageTooLarge    = errors.New("image is larger than the maximum size")
+	ErrImageTooSmall    = errors.New("image is smaller than the minimum size")
+	ErrHostLimit        = errors.New("could not wait for the host rate limit")
+	ErrChecksumMismatch = errors.New("image sha256 does not match the expected checksum")
 )
 
+// DownloadRequest is a single image to download
+type DownloadRequest struct {
+	Url string
+	// DestinationKey returns the storage key of the image from its resolved content type
+	DestinationKey func(contentType string) string
+	// SHA256 is the expected hex checksum of the image, a mismatching image is not stored, empty accepts any
+	SHA256 string
+	// HostAcquired tells the caller holds a slot of the host limiter already, see HostLimiter.TryAcquire
+	HostAcquired bool
+}
+
+type Result struct {
+	Key    string
+	SHA256 string
+	Size   int64
+	// Attempts counts every http request made for the image, retries included
+	Attempts int
+	// StatusCode is the status of the last http response, 0 when none was received
+	StatusCode int
+	// ContentType is the content type header of the response and DetectedContentType the format found
+	// in its body, empty when the body was not sniffed or is no known image
+	ContentType         string
+	DetectedContentType string
+	// Format, Width and Height are decoded from the image when it is validated
+	Format string
+	Width  int
+	Height int
+	// LimiterWait is how long the download waited on the host limiter before its first request
+	LimiterWait time.Duration
+	// Unchanged tells the server answered a conditional request with 304, Key points to the image stored before
+	Unchanged bool
+	// Latency is how long the last request waited for its response headers
+	Latency time.Duration
+	// Congested tells a request timed out or was answered with a 429 or a 5xx, the host asks for less traffic
+	Congested bool
+	// HostLimit is the adaptive in-flight cap of the host once the download is done, 0 when it is not adaptive
+	HostLimit int
+}
+
 type Client struct {
-	HTTPClient   httpClient
-	CreateFileFn func(name string) (*os.File, error)
-	CopyFileFn   func(dst io.Writer, src io.Reader) (written int64, err error)
+	HTTPClient       httpClient
+	Storage          Storage
+	CreateTempFileFn func(dir, pattern string) (*os.File, error)
+	// HostLimiter throttles downloads per host, nil downloads without limits
+	HostLimiter hostLimiter
+
+	// ContentAddressed stores an image under <dir>/<aa>/<bb>/<sha256><ext> where dir and ext come from
+	// its destination key, so identical content referenced by many urls is written once
+	ContentAddressed bool
+
+	// Validator decodes every image before it is stored, nil stores images without validation
+	Validator imageValidator
+	// QuarantinePrefix is the key prefix corrupt images are stored under, empty drops them
+	QuarantinePrefix string
+
+	// MaxSize and MinSize bound the accepted image size in bytes, 0 means unlimited
+	MaxSize int64
+	MinSize int64
+
+	// Cache remembers the etag and last modified date of stored images to download them conditionally,
+	// nil always downloads images in full
+	Cache CacheStore
+}
+
+func (c *Client) DownloadImage(ctx context.Context, request DownloadRequest) (Result, error) {
+	ctx, trace := withTrace(ctx)
+
+	host := hostOf(request.Url)
+
+	release, waited, err := c.acquireHost(ctx, host, request.HostAcquired)
+	if err != nil {
+		return Result{LimiterWait: waited}, err
+	}
+
+	defer release()
+
+	result, err := c.downloadImage(ctx, request)
+	result.Attempts = trace.attempts
+	result.StatusCode = trace.statusCode
+	result.Latency = trace.latency
+	// the body can time out long after the response headers arrived
+	result.Congested = trace.congested || isTimeout(ctx, err)
+
+	// a 304 carries no content, its content type is the cached one
+	if !result.Unchanged {
+		result.ContentType = trace.contentType
+	}
+
+	result.DetectedContentType = trace.detectedContentType
+	result.LimiterWait = waited
+
+	// a download that never reached the host tells nothing about it
+	if c.HostLimiter != nil && host != "" && result.Attempts > 0 {
+		result.HostLimit = c.HostLimiter.Observe(host, result.Latency, result.Congested)
+	}
+
+	return result, err
+}
+
+// hostOf returns the host of rawURL, empty for an invalid url which is rejected later on by the request builder
+func hostOf(rawURL string) string {
+	uri, err := neturl.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	return uri.Hostname()
+}
+
+func (c *Client) acquireHost(ctx context.Context, host string, acquired bool) (func(), time.Duration, error) {
+	if c.HostLimiter == nil || host == "" || acquired {
+		return func() {}, 0, nil
+	}
+
+	release, waited, err := c.HostLimiter.Acquire(ctx, host)
+	if err != nil {
+		return nil, waited, errors.Join(ErrHostLimit, err)
+	}
+
+	return release, waited, nil
 }
 
-func (c *Client) DownloadImage(ctx context.Context, url string, destinationPath func(contentType string) string) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+func (c *Client) downloadImage(ctx context.Context, request DownloadRequest) (Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, request.Url, nil)
 	if err != nil {
-		return errors.Join(ErrMakeRequest, err)
+		return Result{}, errors.Join(ErrMakeRequest, err)
+	}
+
+	cached, conditional := c.cachedEntry(ctx, request)
+	if conditional {
+		setConditionalHeaders(req, cached)
 	}
 
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return errors.Join(ErrFetchResponse, err)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return Result{}, errors.Join(ErrFetchResponse, err)
 	}
 
 	// close body in every call made
 	defer resp.Body.Close()
-	contentType := resp.Header.Get(contentTypeHeaderKey)
+	contentType := traceFromContext(ctx).resolvedContentType(resp.Header.Get(contentTypeHeaderKey))
+
+	if conditional && resp.StatusCode == http.StatusNotModified {
+		return Result{
+			Key:         cached.Key,
+			SHA256:      cached.SHA256,
+			Size:        cached.Size,
+			ContentType: cached.ContentType,
+			Unchanged:   true,
+		}, nil
+	}
 
 	if resp.StatusCode == http.StatusNotFound {
-		return ErrImageNotFound
+		return Result{}, ErrImageNotFound
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return ErrFailedImage
+		return Result{}, ErrFailedImage
+	}
+
+	metadata := Metadata{
+		ContentType: contentType,
+		Size:        resp.ContentLength,
 	}
 
-	return c.saveImage(resp.Body, destinationPath(contentType))
+	key := request.DestinationKey(contentType)
+	expected := strings.ToLower(strings.TrimSpace(request.SHA256))
+
+	// a known size is judged before a single byte is downloaded
+	if err := c.checkSize(metadata.Size, metadata.Size >= 0); err != nil {
+		return Result{Size: metadata.Size}, err
+	}
+
+	var result Result
+
+	if c.ContentAddressed || c.Validator != nil {
+		result, err = c.saveSpooledImage(ctx, resp.Body, key, expected, metadata)
+	} else {
+		result, err = c.saveImage(ctx, resp.Body, key, expected, metadata)
+	}
+
+	if err == nil {
+		c.cacheImage(request.Url, resp.Header, result, contentType)
+	}
+
+	return result, err
 }
 
-func (c *Client) saveImage(body io.ReadCloser, destinationPath string) error {
-	file, err := c.CreateFileFn(destinationPath)
+// cachedEntry returns the cache entry of a url when its image is still stored, so it can be downloaded conditionally
+func (c *Client) cachedEntry(ctx context.Context, request DownloadRequest) (CacheEntry, bool) {
+	if c.Cache == nil {
+		return CacheEntry{}, false
+	}
+
+	entry, ok, err := c.Cache.Get(request.Url)
+	if err != nil || !ok || entry.Key == "" || (entry.ETag == "" && entry.LastModified == "") {
+		return CacheEntry{}, false
+	}
+
+	// the stored image is not the expected one anymore
+	if request.SHA256 != "" && !strings.EqualFold(strings.TrimSpace(request.SHA256), entry.SHA256) {
+		return CacheEntry{}, false
+	}
+
+	// a 304 is useless once the stored image is gone
+	exists, err := c.Storage.Exists(ctx, entry.Key)
+	if err != nil || !exists {
+		return CacheEntry{}, false
+	}
+
+	return entry, true
+}
+
+func setConditionalHeaders(req *http.Request, entry CacheEntry) {
+	if entry.ETag != "" {
+		req.Header.Set(ifNoneMatchHeaderKey, entry.ETag)
+	}
+
+	if entry.LastModified != "" {
+		req.Header.Set(ifModifiedSinceHeaderKey, entry.LastModified)
+	}
+}
+
+// cacheImage remembers the validators of a stored image, a cache failure only costs a full download next time
+func (c *Client) cacheImage(url string, header http.Header, result Result, contentType string) {
+	etag, lastModified := header.Get(etagHeaderKey), header.Get(lastModifiedHeaderKey)
+	if c.Cache == nil || result.Key == "" || (etag == "" && lastModified == "") {
+		return
+	}
+
+	entry := CacheEntry{
+		Url:          url,
+		ETag:         etag,
+		LastModified: lastModified,
+		Key:          result.Key,
+		SHA256:       result.SHA256,
+		Size:         result.Size,
+		ContentType:  contentType,
+	}
+
+	if err := c.Cache.Put(entry); err != nil {
+		logger.Errorf("could not cache image: %v, err: %v", entry, err)
+	}
+}
+
+func (c *Client) saveImage(ctx context.Context, body io.Reader, key string, expectedSHA256 string, metadata Metadata) (Result, error) {
+	reader := c.newHashingReader(body, metadata.Size, expectedSHA256)
+
+	if err := c.Storage.Put(ctx, key, reader, metadata); err != nil {
+		return Result{Size: reader.size}, errors.Join(ErrCopyImage, err)
+	}
+
+	return Result{
+		Key:    key,
+		SHA256: reader.sum(),
+		Size:   reader.size,
+	}, nil
+}
+
+// saveSpooledImage spools the body to a local temp file first when the image can only be stored once
+// it is fully known, either to be validated or to be keyed by its hash
+func (c *Client) saveSpooledImage(ctx context.Context, body io.Reader, key string, expectedSHA256 string, metadata Metadata) (Result, error) {
+	file, err := c.CreateTempFileFn("", ".download-*")
 	if err != nil {
-		return errors.Join(ErrOpenImageFile, err)
+		return Result{}, errors.Join(ErrOpenImageFile, err)
 	}
 
-	// close file whenever opened
+	defer os.Remove(file.Name())
 	defer file.Close()
 
-	if _, err := c.CopyFileFn(file, body); err != nil {
-		return errors.Join(ErrCopyImage, err)
+	reader := c.newHashingReader(&contextReader{ctx: ctx, reader: body}, metadata.Size, expectedSHA256)
+	if _, err := io.Copy(file, reader); err != nil {
+		return Result{Size: reader.size}, errors.Join(ErrCopyImage, err)
+	}
+
+	result := Result{
+		Key:    key,
+		SHA256: reader.sum(),
+		Size:   reader.size,
+	}
+
+	metadata.Size = result.Size
+
+	if c.Validator != nil {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return Result{}, errors.Join(ErrStoreImage, err)
+		}
+
+		imageConfig, err := c.Validator.Validate(file, metadata.ContentType)
+		result.Format, result.Width, result.Height = imageConfig.Format, imageConfig.Width, imageConfig.Height
+
+		if errors.Is(err, ErrCorruptImage) {
+			return c.quarantineImage(ctx, file, result, metadata, err)
+		}
+
+		if err != nil {
+			result.Key = ""
+			return result, err
+		}
+	}
+
+	if c.ContentAddressed {
+		result.Key = ContentAddressedKey(path.Dir(key), result.SHA256, path.Ext(key))
+
+		// identical content is already stored
+		exists, err := c.Storage.Exists(ctx, result.Key)
+		if err != nil {
+			return Result{}, errors.Join(ErrStoreImage, err)
+		}
+
+		if exists {
+			return result, nil
+		}
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return Result{}, errors.Join(ErrStoreImage, err)
+	}
+
+	if err := c.Storage.Put(ctx, result.Key, file, metadata); err != nil {
+		return Result{}, errors.Join(ErrStoreImage, err)
+	}
+
+	return result, nil
+}
+
+// quarantineImage keeps a corrupt image aside for inspection, it always returns the validation error
+func (c *Client) quarantineImage(ctx context.Context, file io.ReadSeeker, result Result, metadata Metadata, validationErr error) (Result, error) {
+	if c.QuarantinePrefix == "" {
+		result.Key = ""
+		return result, validationErr
+	}
+
+	result.Key = path.Join(c.QuarantinePrefix, result.Key)
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return Result{}, errors.Join(validationErr, ErrStoreImage, err)
+	}
+
+	if err := c.Storage.Put(ctx, result.Key, file, metadata); err != nil {
+		return Result{}, errors.Join(validationErr, ErrStoreImage, err)
+	}
+
+	return result, validationErr
+}
+
+func ContentAddressedKey(dir string, sum string, ext string) string {
+	return path.Join(dir, sum[:2], sum[2:4], sum+ext)
+}
+
+// checkSize judges an image size against the size bounds, a size that is not final yet
+// can only be too large
+func (c *Client) checkSize(size int64, final bool) error {
+	switch {
+	case c.MaxSize > 0 && size > c.MaxSize:
+		return fmt.Errorf("%w: %d bytes exceeds %d bytes", ErrImageTooLarge, size, c.MaxSize)
+	case final && size < c.MinSize:
+		return fmt.Errorf("%w: %d bytes is below %d bytes", ErrImageTooSmall, size, c.MinSize)
 	}
 
 	return nil
 }
+
+// hashingReader hashes and counts every byte read through it, it fails at the end of the body
+// when the size does not match the expected one so storages never commit an incomplete image,
+// and as soon as the body leaves the client size bounds
+type hashingReader struct {
+	reader       io.Reader
+	hash         hash.Hash
+	size         int64
+	expectedSize int64
+	// expectedSHA256 fails the read of a body with another checksum at its end, empty accepts any
+	expectedSHA256 string
+	client         *Client
+}
+
+func (c *Client) newHashingReader(reader io.Reader, expectedSize int64, expectedSHA256 string) *hashingReader {
+	return &hashingReader{
+		reader:         reader,
+		hash:           sha256.New(),
+		expectedSize:   expectedSize,
+		expectedSHA256: expectedSHA256,
+		client:         c,
+	}
+}
+
+func (h *hashingReader) Read(p []byte) (int, error) {
+	// never read more than one byte past the maximum size
+	if maxSize := h.client.MaxSize; maxSize > 0 && int64(len(p)) > maxSize-h.size+1 {
+		p = p[:maxSize-h.size+1]
+	}
+
+	n, err := h.reader.Read(p)
+	h.hash.Write(p[:n])
+	h.size += int64(n)
+
+	if err == io.EOF && h.expectedSize >= 0 && h.size != h.expectedSize {
+		return n, ErrIncompleteImage
+	}
+
+	if sizeErr := h.client.checkSize(h.size, err == io.EOF); sizeErr != nil {
+		return n, sizeErr
+	}
+
+	if err == io.EOF && h.expectedSHA256 != "" && h.sum() != h.expectedSHA256 {
+		return n, ErrChecksumMismatch
+	}
+
+	return n, err
+}
+
+func (h *hashingReader) sum() string {
+	return hex.EncodeToString(h.hash.Sum(nil))
+}
+
+// contextReader fails once ctx is done, so copying a body or a local file stops on cancellation
+// even when the underlying reader never looks at ctx
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.reader.Read(p)
+}
@@ -7,7 +7,10 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
@@ -16,13 +19,13 @@ import (
 func TestClient_DownloadImage(t *testing.T) {
 	ctx := context.Background()
 
-	destinationPath := func(contentType string) string {
-		return "absolute/path/to/image"
+	destinationKey := func(contentType string) string {
+		return "path/to/image.jpg"
 	}
 
 	t.Run("returns error on an invalid request", func(t *testing.T) {
 		client := &Client{}
-		err := client.DownloadImage(ctx, ":) !some_invalid_url! :)", nil)
+		_, err := client.DownloadImage(ctx, DownloadRequest{Url: ":) !some_invalid_url! :)"})
 		assert.ErrorIs(t, err, ErrMakeRequest)
 	})
 
@@ -36,7 +39,7 @@ func TestClient_DownloadImage(t *testing.T) {
 		// mock http response
 		mockHttp.EXPECT().Do(gomock.Any()).Return(nil, errors.New("error"))
 
-		err := client.DownloadImage(ctx, "https://fachr.in/static/image/fachrin-memoji.jpg", nil)
+		_, err := client.DownloadImage(ctx, DownloadRequest{Url: "https://fachr.in/static/image/fachrin-memoji.jpg"})
 		assert.ErrorIs(t, err, ErrFetchResponse)
 	})
 
@@ -53,7 +56,7 @@ func TestClient_DownloadImage(t *testing.T) {
 			Body:       io.NopCloser(bytes.NewBuffer(nil)),
 		}, nil)
 
-		err := client.DownloadImage(ctx, "https://fachr.in/static/image/fachrin-memoji.jpg", nil)
+		_, err := client.DownloadImage(ctx, DownloadRequest{Url: "https://fachr.in/static/image/fachrin-memoji.jpg"})
 		assert.ErrorIs(t, err, ErrImageNotFound)
 	})
 
@@ -70,21 +73,20 @@ func TestClient_DownloadImage(t *testing.T) {
 			Body:       io.NopCloser(bytes.NewBuffer(nil)),
 		}, nil)
 
-		err := client.DownloadImage(ctx, "https://fachr.in/static/image/fachrin-memoji.jpg", nil)
+		_, err := client.DownloadImage(ctx, DownloadRequest{Url: "https://fachr.in/static/image/fachrin-memoji.jpg"})
 		assert.ErrorIs(t, err, ErrFailedImage)
 	})
 
-	t.Run("returns error when couldn't create file to store image", func(t *testing.T) {
+	t.Run("returns error when couldn't store image", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
 
 		mockHttp := NewMockhttpClient(ctrl)
+		mockStorage := NewMockStorage(ctrl)
 
 		client := Client{
 			HTTPClient: mockHttp,
-			CreateFileFn: func(name string) (*os.File, error) {
-				return nil, errors.New("error")
-			},
+			Storage:    mockStorage,
 		}
 
 		// mock http response
@@ -93,59 +95,665 @@ func TestClient_DownloadImage(t *testing.T) {
 			Body:       io.NopCloser(bytes.NewBuffer(nil)),
 		}, nil)
 
-		err := client.DownloadImage(ctx, "https://fachr.in/static/image/fachrin-memoji.jpg", destinationPath)
-		assert.ErrorIs(t, err, ErrOpenImageFile)
+		mockStorage.EXPECT().Put(gomock.Any(), "path/to/image.jpg", gomock.Any(), gomock.Any()).Return(errors.New("error"))
+
+		_, err := client.DownloadImage(ctx, DownloadRequest{Url: "https://fachr.in/static/image/fachrin-memoji.jpg", DestinationKey: destinationKey})
+		assert.ErrorIs(t, err, ErrCopyImage)
 	})
 
-	t.Run("returns error when couldn't copy image", func(t *testing.T) {
+	t.Run("returns key, hash and size when everything is ok", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
 
 		mockHttp := NewMockhttpClient(ctrl)
+		mockStorage := NewMockStorage(ctrl)
 
 		client := Client{
 			HTTPClient: mockHttp,
-			CreateFileFn: func(name string) (*os.File, error) {
-				return &os.File{}, nil
-			},
-			CopyFileFn: func(dst io.Writer, src io.Reader) (written int64, err error) {
-				return 0, errors.New("error")
-			},
+			Storage:    mockStorage,
 		}
 
 		// mock http response
 		mockHttp.EXPECT().Do(gomock.Any()).Return(&http.Response{
-			StatusCode: http.StatusOK,
+			StatusCode:    http.StatusOK,
+			Header:        map[string][]string{"Content-Type": {"image/jpeg"}},
+			Body:          io.NopCloser(bytes.NewBufferString("image")),
+			ContentLength: 5,
+		}, nil)
+
+		mockStorage.EXPECT().Put(gomock.Any(), "path/to/image.jpg", gomock.Any(), Metadata{ContentType: "image/jpeg", Size: 5}).DoAndReturn(
+			func(_ context.Context, _ string, body io.Reader, _ Metadata) error {
+				_, err := io.Copy(io.Discard, body)
+				return err
+			})
+
+		result, err := client.DownloadImage(ctx, DownloadRequest{Url: "https://fachr.in/static/image/fachrin-memoji.jpg", DestinationKey: destinationKey})
+		assert.NoError(t, err)
+		assert.Equal(t, Result{
+			Key:    "path/to/image.jpg",
+			SHA256: "6105d6cc76af400325e94d588ce511be5bfdbb73b437dc51eca43917d7a43e3d",
+			Size:   5,
+		}, result)
+	})
+}
+
+func TestClient_DownloadImage_HostLimiter(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns error when couldn't wait for the host limiter", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockLimiter := NewMockhostLimiter(ctrl)
+		client := Client{HostLimiter: mockLimiter}
+
+		// mock functions
+		mockLimiter.EXPECT().Acquire(gomock.Any(), "a.com").Return(nil, time.Second, context.Canceled)
+
+		result, err := client.DownloadImage(ctx, DownloadRequest{Url: "https://a.com/a.jpg"})
+		assert.ErrorIs(t, err, ErrHostLimit)
+		assert.Equal(t, Result{LimiterWait: time.Second}, result)
+	})
+
+	t.Run("returns limiter wait and releases the host once downloaded", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttp := NewMockhttpClient(ctrl)
+		mockLimiter := NewMockhostLimiter(ctrl)
+
+		client := Client{
+			HTTPClient:  mockHttp,
+			HostLimiter: mockLimiter,
+		}
+
+		released := false
+
+		// mock functions
+		mockLimiter.EXPECT().Acquire(gomock.Any(), "a.com").Return(func() { released = true }, time.Second, nil)
+		mockHttp.EXPECT().Do(gomock.Any()).Return(&http.Response{
+			StatusCode: http.StatusNotFound,
 			Body:       io.NopCloser(bytes.NewBuffer(nil)),
 		}, nil)
 
-		err := client.DownloadImage(ctx, "https://fachr.in/static/image/fachrin-memoji.jpg", destinationPath)
-		assert.ErrorIs(t, err, ErrCopyImage)
+		result, err := client.DownloadImage(ctx, DownloadRequest{Url: "https://a.com:8080/a.jpg"})
+		assert.ErrorIs(t, err, ErrImageNotFound)
+		assert.Equal(t, time.Second, result.LimiterWait)
+		assert.True(t, released)
+	})
+
+	t.Run("returns without waiting for the host limiter when the host slot is acquired already", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttp := NewMockhttpClient(ctrl)
+		mockLimiter := NewMockhostLimiter(ctrl)
+
+		client := Client{
+			HTTPClient:  mockHttp,
+			HostLimiter: mockLimiter,
+		}
+
+		// mock functions
+		mockHttp.EXPECT().Do(gomock.Any()).Return(&http.Response{
+			StatusCode: http.StatusNotFound,
+			Body:       io.NopCloser(bytes.NewBuffer(nil)),
+		}, nil)
+
+		_, err := client.DownloadImage(ctx, DownloadRequest{Url: "https://a.com/a.jpg", HostAcquired: true})
+		assert.ErrorIs(t, err, ErrImageNotFound)
+	})
+
+	t.Run("returns host limit observed from a congested response", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttp := NewMockhttpClient(ctrl)
+		mockLimiter := NewMockhostLimiter(ctrl)
+
+		client := Client{
+			HTTPClient:  &HTTPClient{BaseClient: mockHttp},
+			HostLimiter: mockLimiter,
+		}
+
+		// mock functions
+		mockLimiter.EXPECT().Acquire(gomock.Any(), "a.com").Return(func() {}, time.Duration(0), nil)
+		mockHttp.EXPECT().Do(gomock.Any()).Return(&http.Response{
+			StatusCode: http.StatusServiceUnavailable,
+			Body:       io.NopCloser(bytes.NewBuffer(nil)),
+		}, nil)
+		mockLimiter.EXPECT().Observe("a.com", gomock.Any(), true).Return(2)
+
+		result, err := client.DownloadImage(ctx, DownloadRequest{Url: "https://a.com/a.jpg"})
+		assert.Error(t, err)
+		assert.True(t, result.Congested)
+		assert.Equal(t, 2, result.HostLimit)
 	})
+}
 
-	t.Run("returns no error when everything is ok", func(t *testing.T) {
+func TestClient_DownloadImage_Atomic(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns error and stores nothing on a body shorter than its content length", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
 
 		mockHttp := NewMockhttpClient(ctrl)
+		root := t.TempDir()
 
 		client := Client{
 			HTTPClient: mockHttp,
-			CreateFileFn: func(name string) (*os.File, error) {
-				return &os.File{}, nil
-			},
-			CopyFileFn: func(dst io.Writer, src io.Reader) (written int64, err error) {
-				return 0, nil
+			Storage:    &LocalStorage{RootPath: root},
+		}
+
+		// mock http response
+		mockHttp.EXPECT().Do(gomock.Any()).Return(&http.Response{
+			StatusCode:    http.StatusOK,
+			Body:          io.NopCloser(bytes.NewBufferString("ima")),
+			ContentLength: 5,
+		}, nil)
+
+		result, err := client.DownloadImage(ctx, DownloadRequest{
+			Url:            "https://a.com/a.jpg",
+			DestinationKey: func(contentType string) string { return "a.jpg" },
+		})
+		assert.ErrorIs(t, err, ErrIncompleteImage)
+		assert.Equal(t, Result{Size: 3}, result)
+
+		entries, _ := os.ReadDir(root)
+		assert.Empty(t, entries)
+	})
+}
+
+func TestClient_DownloadImage_ContentAddressed(t *testing.T) {
+	ctx := context.Background()
+	key := "61/05/6105d6cc76af400325e94d588ce511be5bfdbb73b437dc51eca43917d7a43e3d.jpg"
+
+	destinationKey := func(contentType string) string {
+		return "a_01h.jpg"
+	}
+
+	newResponse := func(body string) *http.Response {
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			Body:          io.NopCloser(bytes.NewBufferString(body)),
+			ContentLength: -1,
+		}
+	}
+
+	t.Run("returns error when couldn't create temp file to spool image", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttp := NewMockhttpClient(ctrl)
+
+		client := Client{
+			HTTPClient: mockHttp,
+			CreateTempFileFn: func(dir, pattern string) (*os.File, error) {
+				return nil, errors.New("error")
 			},
+			ContentAddressed: true,
 		}
 
 		// mock http response
+		mockHttp.EXPECT().Do(gomock.Any()).Return(newResponse("image"), nil)
+
+		_, err := client.DownloadImage(ctx, DownloadRequest{Url: "https://a.com/a.jpg", DestinationKey: destinationKey})
+		assert.ErrorIs(t, err, ErrOpenImageFile)
+	})
+
+	t.Run("returns error when couldn't check existing content", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttp := NewMockhttpClient(ctrl)
+		mockStorage := NewMockStorage(ctrl)
+
+		client := Client{
+			HTTPClient:       mockHttp,
+			Storage:          mockStorage,
+			CreateTempFileFn: os.CreateTemp,
+			ContentAddressed: true,
+		}
+
+		// mock functions
+		mockHttp.EXPECT().Do(gomock.Any()).Return(newResponse("image"), nil)
+		mockStorage.EXPECT().Exists(gomock.Any(), key).Return(false, errors.New("error"))
+
+		_, err := client.DownloadImage(ctx, DownloadRequest{Url: "https://a.com/a.jpg", DestinationKey: destinationKey})
+		assert.ErrorIs(t, err, ErrStoreImage)
+	})
+
+	t.Run("returns existing content without storing it again", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttp := NewMockhttpClient(ctrl)
+		mockStorage := NewMockStorage(ctrl)
+
+		client := Client{
+			HTTPClient:       mockHttp,
+			Storage:          mockStorage,
+			CreateTempFileFn: os.CreateTemp,
+			ContentAddressed: true,
+		}
+
+		// mock functions
+		mockHttp.EXPECT().Do(gomock.Any()).Return(newResponse("image"), nil)
+		mockStorage.EXPECT().Exists(gomock.Any(), key).Return(true, nil)
+
+		result, err := client.DownloadImage(ctx, DownloadRequest{Url: "https://a.com/a.jpg", DestinationKey: destinationKey})
+		assert.NoError(t, err)
+		assert.Equal(t, key, result.Key)
+	})
+
+	t.Run("stores new content under its hash", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttp := NewMockhttpClient(ctrl)
+		mockStorage := NewMockStorage(ctrl)
+
+		client := Client{
+			HTTPClient:       mockHttp,
+			Storage:          mockStorage,
+			CreateTempFileFn: os.CreateTemp,
+			ContentAddressed: true,
+		}
+
+		var stored []byte
+
+		// mock functions
+		mockHttp.EXPECT().Do(gomock.Any()).Return(newResponse("image"), nil)
+		mockStorage.EXPECT().Exists(gomock.Any(), key).Return(false, nil)
+		mockStorage.EXPECT().Put(gomock.Any(), key, gomock.Any(), Metadata{Size: 5}).DoAndReturn(
+			func(_ context.Context, _ string, body io.Reader, _ Metadata) (err error) {
+				stored, err = io.ReadAll(body)
+				return err
+			})
+
+		result, err := client.DownloadImage(ctx, DownloadRequest{Url: "https://a.com/a.jpg", DestinationKey: destinationKey})
+		assert.NoError(t, err)
+		assert.Equal(t, Result{
+			Key:    key,
+			SHA256: "6105d6cc76af400325e94d588ce511be5bfdbb73b437dc51eca43917d7a43e3d",
+			Size:   5,
+		}, result)
+		assert.Equal(t, "image", string(stored))
+	})
+}
+
+func TestClient_DownloadImage_Validator(t *testing.T) {
+	ctx := context.Background()
+
+	destinationKey := func(contentType string) string {
+		return "a_01h.png"
+	}
+
+	newResponse := func() *http.Response {
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        map[string][]string{"Content-Type": {"image/png"}},
+			Body:          io.NopCloser(bytes.NewBufferString("image")),
+			ContentLength: 5,
+		}
+	}
+
+	t.Run("returns error and stores nothing on an image out of the accepted dimensions", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttp := NewMockhttpClient(ctrl)
+		mockValidator := NewMockimageValidator(ctrl)
+
+		client := Client{
+			HTTPClient:       mockHttp,
+			Storage:          NewMockStorage(ctrl),
+			CreateTempFileFn: os.CreateTemp,
+			Validator:        mockValidator,
+		}
+
+		// mock functions
+		mockHttp.EXPECT().Do(gomock.Any()).Return(newResponse(), nil)
+		mockValidator.EXPECT().Validate(gomock.Any(), "image/png").Return(ImageConfig{Format: "png", Width: 1, Height: 1}, ErrImageDimensions)
+
+		result, err := client.DownloadImage(ctx, DownloadRequest{Url: "https://a.com/a.png", DestinationKey: destinationKey})
+		assert.ErrorIs(t, err, ErrImageDimensions)
+		assert.Equal(t, "", result.Key)
+		assert.Equal(t, 1, result.Width)
+	})
+
+	t.Run("returns error and stores a corrupt image under the quarantine prefix", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttp := NewMockhttpClient(ctrl)
+		mockStorage := NewMockStorage(ctrl)
+		mockValidator := NewMockimageValidator(ctrl)
+
+		client := Client{
+			HTTPClient:       mockHttp,
+			Storage:          mockStorage,
+			CreateTempFileFn: os.CreateTemp,
+			Validator:        mockValidator,
+			QuarantinePrefix: "quarantine",
+		}
+
+		var stored []byte
+
+		// mock functions
+		mockHttp.EXPECT().Do(gomock.Any()).Return(newResponse(), nil)
+		mockValidator.EXPECT().Validate(gomock.Any(), "image/png").Return(ImageConfig{}, ErrCorruptImage)
+		mockStorage.EXPECT().Put(gomock.Any(), "quarantine/a_01h.png", gomock.Any(), Metadata{ContentType: "image/png", Size: 5}).DoAndReturn(
+			func(_ context.Context, _ string, body io.Reader, _ Metadata) (err error) {
+				stored, err = io.ReadAll(body)
+				return err
+			})
+
+		result, err := client.DownloadImage(ctx, DownloadRequest{Url: "https://a.com/a.png", DestinationKey: destinationKey})
+		assert.ErrorIs(t, err, ErrCorruptImage)
+		assert.Equal(t, "quarantine/a_01h.png", result.Key)
+		assert.Equal(t, "image", string(stored))
+	})
+
+	t.Run("returns key of a valid image once stored", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttp := NewMockhttpClient(ctrl)
+		mockStorage := NewMockStorage(ctrl)
+		mockValidator := NewMockimageValidator(ctrl)
+
+		client := Client{
+			HTTPClient:       mockHttp,
+			Storage:          mockStorage,
+			CreateTempFileFn: os.CreateTemp,
+			Validator:        mockValidator,
+		}
+
+		// mock functions
+		mockHttp.EXPECT().Do(gomock.Any()).Return(newResponse(), nil)
+		mockValidator.EXPECT().Validate(gomock.Any(), "image/png").Return(ImageConfig{Format: "png", Width: 4, Height: 3}, nil)
+		mockStorage.EXPECT().Put(gomock.Any(), "a_01h.png", gomock.Any(), Metadata{ContentType: "image/png", Size: 5}).Return(nil)
+
+		result, err := client.DownloadImage(ctx, DownloadRequest{Url: "https://a.com/a.png", DestinationKey: destinationKey})
+		assert.NoError(t, err)
+		assert.Equal(t, "a_01h.png", result.Key)
+		assert.Equal(t, "png", result.Format)
+	})
+}
+
+func TestClient_DownloadImage_Size(t *testing.T) {
+	ctx := context.Background()
+
+	destinationKey := func(contentType string) string {
+		return "a.jpg"
+	}
+
+	newResponse := func(body string, contentLength int64) *http.Response {
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			Body:          io.NopCloser(bytes.NewBufferString(body)),
+			ContentLength: contentLength,
+		}
+	}
+
+	t.Run("returns error without downloading an image whose content length is too large", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttp := NewMockhttpClient(ctrl)
+		client := Client{HTTPClient: mockHttp, Storage: NewMockStorage(ctrl), MaxSize: 4}
+
+		// mock http response
+		mockHttp.EXPECT().Do(gomock.Any()).Return(newResponse("image", 5), nil)
+
+		result, err := client.DownloadImage(ctx, DownloadRequest{Url: "https://a.com/a.jpg", DestinationKey: destinationKey})
+		assert.ErrorIs(t, err, ErrImageTooLarge)
+		assert.Equal(t, int64(5), result.Size)
+	})
+
+	t.Run("returns error without downloading an image whose content length is too small", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttp := NewMockhttpClient(ctrl)
+		client := Client{HTTPClient: mockHttp, Storage: NewMockStorage(ctrl), MinSize: 6}
+
+		// mock http response
+		mockHttp.EXPECT().Do(gomock.Any()).Return(newResponse("image", 5), nil)
+
+		_, err := client.DownloadImage(ctx, DownloadRequest{Url: "https://a.com/a.jpg", DestinationKey: destinationKey})
+		assert.ErrorIs(t, err, ErrImageTooSmall)
+	})
+
+	t.Run("returns error and stores nothing once a streamed image grows too large", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttp := NewMockhttpClient(ctrl)
+		root := t.TempDir()
+		client := Client{HTTPClient: mockHttp, Storage: &LocalStorage{RootPath: root}, MaxSize: 4}
+
+		// mock http response
+		mockHttp.EXPECT().Do(gomock.Any()).Return(newResponse("image image image", -1), nil)
+
+		result, err := client.DownloadImage(ctx, DownloadRequest{Url: "https://a.com/a.jpg", DestinationKey: destinationKey})
+		assert.ErrorIs(t, err, ErrImageTooLarge)
+		assert.Equal(t, int64(5), result.Size)
+
+		entries, _ := os.ReadDir(root)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("returns error and stores nothing once a streamed image ends too small", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttp := NewMockhttpClient(ctrl)
+		root := t.TempDir()
+		client := Client{HTTPClient: mockHttp, Storage: &LocalStorage{RootPath: root}, MinSize: 43}
+
+		// mock http response
+		mockHttp.EXPECT().Do(gomock.Any()).Return(newResponse("GIF89a", -1), nil)
+
+		result, err := client.DownloadImage(ctx, DownloadRequest{Url: "https://a.com/a.jpg", DestinationKey: destinationKey})
+		assert.ErrorIs(t, err, ErrImageTooSmall)
+		assert.Equal(t, int64(6), result.Size)
+
+		entries, _ := os.ReadDir(root)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("returns key of an image within the size bounds", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttp := NewMockhttpClient(ctrl)
+		client := Client{HTTPClient: mockHttp, Storage: &LocalStorage{RootPath: t.TempDir()}, MinSize: 5, MaxSize: 5}
+
+		// mock http response
+		mockHttp.EXPECT().Do(gomock.Any()).Return(newResponse("image", -1), nil)
+
+		result, err := client.DownloadImage(ctx, DownloadRequest{Url: "https://a.com/a.jpg", DestinationKey: destinationKey})
+		assert.NoError(t, err)
+		assert.Equal(t, "a.jpg", result.Key)
+	})
+}
+
+func TestClient_DownloadImage_Checksum(t *testing.T) {
+	ctx := context.Background()
+	sum := "6105d6cc76af400325e94d588ce511be5bfdbb73b437dc51eca43917d7a43e3d"
+
+	newResponse := func() *http.Response {
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			Body:          io.NopCloser(bytes.NewBufferString("image")),
+			ContentLength: 5,
+		}
+	}
+
+	t.Run("returns stored image matching its expected checksum whatever its case", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttp := NewMockhttpClient(ctrl)
+		root := t.TempDir()
+		client := Client{HTTPClient: mockHttp, Storage: &LocalStorage{RootPath: root}}
+
+		// mock http response
+		mockHttp.EXPECT().Do(gomock.Any()).Return(newResponse(), nil)
+
+		result, err := client.DownloadImage(ctx, DownloadRequest{
+			Url:            "https://a.com/a.jpg",
+			DestinationKey: func(string) string { return "a.jpg" },
+			SHA256:         strings.ToUpper(sum),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, sum, result.SHA256)
+		assert.FileExists(t, filepath.Join(root, "a.jpg"))
+	})
+
+	t.Run("returns error and stores nothing on a checksum mismatch", func(t *testing.T) {
+		for _, contentAddressed := range []bool{false, true} {
+			ctrl := gomock.NewController(t)
+			mockHttp := NewMockhttpClient(ctrl)
+			root := t.TempDir()
+
+			client := Client{
+				HTTPClient:       mockHttp,
+				Storage:          &LocalStorage{RootPath: root},
+				CreateTempFileFn: os.CreateTemp,
+				ContentAddressed: contentAddressed,
+			}
+
+			// mock http response
+			mockHttp.EXPECT().Do(gomock.Any()).Return(newResponse(), nil)
+
+			_, err := client.DownloadImage(ctx, DownloadRequest{
+				Url:            "https://a.com/a.jpg",
+				DestinationKey: func(string) string { return "a.jpg" },
+				SHA256:         strings.Repeat("0", 64),
+			})
+			assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+			entries, _ := os.ReadDir(root)
+			assert.Empty(t, entries)
+			ctrl.Finish()
+		}
+	})
+}
+
+func TestClient_DownloadImage_Cache(t *testing.T) {
+	ctx := context.Background()
+	url := "https://a.com/a.jpg"
+
+	destinationKey := func(contentType string) string {
+		return "a.jpg"
+	}
+
+	cached := CacheEntry{
+		Url:          url,
+		ETag:         `"v1"`,
+		LastModified: "Mon, 02 Jan 2006 15:04:05 GMT",
+		Key:          "a_01h.jpg",
+		SHA256:       "6105d6cc76af400325e94d588ce511be5bfdbb73b437dc51eca43917d7a43e3d",
+		Size:         5,
+		ContentType:  "image/jpeg",
+	}
+
+	t.Run("returns the stored image when the server answers not modified", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttp := NewMockhttpClient(ctrl)
+		mockStorage := NewMockStorage(ctrl)
+		mockCache := NewMockCacheStore(ctrl)
+		client := Client{HTTPClient: mockHttp, Storage: mockStorage, Cache: mockCache}
+
+		// mock functions
+		mockCache.EXPECT().Get(url).Return(cached, true, nil)
+		mockStorage.EXPECT().Exists(gomock.Any(), cached.Key).Return(true, nil)
+		mockHttp.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, cached.ETag, req.Header.Get("If-None-Match"))
+			assert.Equal(t, cached.LastModified, req.Header.Get("If-Modified-Since"))
+
+			return &http.Response{StatusCode: http.StatusNotModified, Body: io.NopCloser(bytes.NewReader(nil))}, nil
+		})
+
+		result, err := client.DownloadImage(ctx, DownloadRequest{Url: url, DestinationKey: destinationKey})
+		assert.NoError(t, err)
+		assert.Equal(t, Result{
+			Key:         cached.Key,
+			SHA256:      cached.SHA256,
+			Size:        cached.Size,
+			ContentType: cached.ContentType,
+			Unchanged:   true,
+		}, result)
+	})
+
+	t.Run("downloads in full without conditional headers once the stored image is gone", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttp := NewMockhttpClient(ctrl)
+		mockStorage := NewMockStorage(ctrl)
+		mockCache := NewMockCacheStore(ctrl)
+		client := Client{HTTPClient: mockHttp, Storage: mockStorage, Cache: mockCache}
+
+		// mock functions
+		mockCache.EXPECT().Get(url).Return(cached, true, nil)
+		mockStorage.EXPECT().Exists(gomock.Any(), cached.Key).Return(false, nil)
+		mockHttp.EXPECT().Do(gomock.Any()).DoAndReturn(func(req *http.Request) (*http.Response, error) {
+			assert.Empty(t, req.Header.Get("If-None-Match"))
+			assert.Empty(t, req.Header.Get("If-Modified-Since"))
+
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString("image")), ContentLength: -1}, nil
+		})
+		mockStorage.EXPECT().Put(gomock.Any(), "a.jpg", gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ string, body io.Reader, _ Metadata) error {
+				_, err := io.ReadAll(body)
+				return err
+			})
+
+		result, err := client.DownloadImage(ctx, DownloadRequest{Url: url, DestinationKey: destinationKey})
+		assert.NoError(t, err)
+		assert.False(t, result.Unchanged)
+	})
+
+	t.Run("caches validators of a downloaded image", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttp := NewMockhttpClient(ctrl)
+		mockStorage := NewMockStorage(ctrl)
+		mockCache := NewMockCacheStore(ctrl)
+		client := Client{HTTPClient: mockHttp, Storage: mockStorage, Cache: mockCache}
+
+		header := http.Header{}
+		header.Set("ETag", cached.ETag)
+		header.Set("Last-Modified", cached.LastModified)
+		header.Set("Content-Type", "image/jpeg")
+
+		// mock functions
+		mockCache.EXPECT().Get(url).Return(CacheEntry{}, false, nil)
 		mockHttp.EXPECT().Do(gomock.Any()).Return(&http.Response{
-			StatusCode: http.StatusOK,
-			Body:       io.NopCloser(bytes.NewBuffer(nil)),
+			StatusCode:    http.StatusOK,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewBufferString("image")),
+			ContentLength: 5,
 		}, nil)
+		mockStorage.EXPECT().Put(gomock.Any(), "a.jpg", gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ string, body io.Reader, _ Metadata) error {
+				_, err := io.ReadAll(body)
+				return err
+			})
+
+		expected := cached
+		expected.Key = "a.jpg"
+		mockCache.EXPECT().Put(expected).Return(nil)
 
-		err := client.DownloadImage(ctx, "https://fachr.in/static/image/fachrin-memoji.jpg", destinationPath)
+		_, err := client.DownloadImage(ctx, DownloadRequest{Url: url, DestinationKey: destinationKey})
 		assert.NoError(t, err)
 	})
 }
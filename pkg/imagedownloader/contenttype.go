@@ -0,0 +1,83 @@
+package imagedownloader
+
+import (
+	"errors"
+	"mime"
+	"strings"
+)
+
+const (
+	wildcardSubtype = "*"
+)
+
+// ContentTypeRegistry maps media types to file extensions, matching content types regardless of their case
+// and parameters, resolving aliases and falling back to wildcard rules such as image/*
+type ContentTypeRegistry struct {
+	extensions map[string]string
+	aliases    map[string]string
+}
+
+// NewContentTypeRegistry builds a registry from media types, wildcards included, mapped to extensions
+// and aliases mapped to the media type they stand for
+func NewContentTypeRegistry(extensions map[string]string, aliases map[string]string) *ContentTypeRegistry {
+	registry := &ContentTypeRegistry{
+		extensions: make(map[string]string, len(extensions)),
+		aliases:    make(map[string]string, len(aliases)),
+	}
+
+	for mediaType, ext := range extensions {
+		registry.extensions[ParseMediaType(mediaType)] = ext
+	}
+
+	for alias, mediaType := range aliases {
+		registry.aliases[ParseMediaType(alias)] = ParseMediaType(mediaType)
+	}
+
+	return registry
+}
+
+// Lookup returns the normalized media type of a content type header and its extension, ok is false when
+// the media type is not registered
+func (r *ContentTypeRegistry) Lookup(contentType string) (mediaType string, ext string, ok bool) {
+	mediaType = ParseMediaType(contentType)
+	if r == nil || mediaType == "" {
+		return mediaType, "", false
+	}
+
+	if canonical, isAlias := r.aliases[mediaType]; isAlias {
+		mediaType = canonical
+	}
+
+	if ext, ok := r.extensions[mediaType]; ok {
+		return mediaType, ext, true
+	}
+
+	// the most specific wildcard wins
+	mainType, _, _ := strings.Cut(mediaType, "/")
+
+	for _, wildcard := range []string{mainType + "/" + wildcardSubtype, wildcardSubtype + "/" + wildcardSubtype} {
+		if ext, ok := r.extensions[wildcard]; ok {
+			return mediaType, ext, true
+		}
+	}
+
+	return mediaType, "", false
+}
+
+// ParseMediaType returns the lower cased media type of a content type without its parameters,
+// or an empty string when it is malformed
+func ParseMediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	// the media type itself is fine when only its parameters are malformed
+	if err != nil && !errors.Is(err, mime.ErrInvalidMediaParameter) {
+		return ""
+	}
+
+	// mime accepts a bare type without a subtype
+	if mainType, subtype, ok := strings.Cut(mediaType, "/"); !ok || mainType == "" || subtype == "" {
+		return ""
+	}
+
+	return mediaType
+}
@@ -0,0 +1,56 @@
+package imagedownloader
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentTypeRegistry_Lookup(t *testing.T) {
+	registry := NewContentTypeRegistry(
+		map[string]string{"image/jpeg": ".jpg", "Image/PNG": ".png", "image/*": ".img"},
+		map[string]string{"image/jpg": "image/jpeg", "image/pjpeg": "IMAGE/JPEG"},
+	)
+
+	t.Run("returns extension of a media type regardless of its case and parameters", func(t *testing.T) {
+		testCases := map[string]string{
+			"image/jpeg":                 ".jpg",
+			"Image/JPEG":                 ".jpg",
+			"image/jpeg; charset=binary": ".jpg",
+			"image/png;":                 ".png",
+			" image/png ; q=0.9":         ".png",
+		}
+
+		for contentType, ext := range testCases {
+			_, actualExt, ok := registry.Lookup(contentType)
+			assert.True(t, ok, contentType)
+			assert.Equal(t, ext, actualExt, contentType)
+		}
+	})
+
+	t.Run("returns extension of the media type an alias stands for", func(t *testing.T) {
+		mediaType, ext, ok := registry.Lookup("image/pjpeg")
+		assert.True(t, ok)
+		assert.Equal(t, "image/jpeg", mediaType)
+		assert.Equal(t, ".jpg", ext)
+	})
+
+	t.Run("returns fallback extension of a wildcard rule", func(t *testing.T) {
+		mediaType, ext, ok := registry.Lookup("image/x-portable-pixmap")
+		assert.True(t, ok)
+		assert.Equal(t, "image/x-portable-pixmap", mediaType)
+		assert.Equal(t, ".img", ext)
+	})
+
+	t.Run("returns nothing on unregistered or malformed content types", func(t *testing.T) {
+		for _, contentType := range []string{"text/html", "", "image", "/png"} {
+			_, _, ok := registry.Lookup(contentType)
+			assert.False(t, ok, contentType)
+		}
+	})
+
+	t.Run("returns nothing on a nil registry", func(t *testing.T) {
+		_, _, ok := (*ContentTypeRegistry)(nil).Lookup("image/jpeg")
+		assert.False(t, ok)
+	})
+}
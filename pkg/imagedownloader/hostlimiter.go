@@ -0,0 +1,226 @@
+package imagedownloader
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+type HostLimit struct {
+	// Rate is the number of requests per second a host receives, 0 means unlimited
+	Rate float64
+	// Burst is the number of requests a host may receive at once before Rate kicks in
+	Burst int
+	// MaxInFlight caps concurrent downloads from a host, 0 means unlimited
+	MaxInFlight int
+}
+
+// HostLimiter throttles requests with a token bucket and an in-flight cap per host
+type HostLimiter struct {
+	Default   HostLimit
+	Overrides map[string]HostLimit
+	// Adaptive adapts the in-flight cap of every host to its latency and congestion, capped by its
+	// MaxInFlight when set, nil keeps MaxInFlight as is
+	Adaptive *AdaptiveOption
+
+	mutex sync.Mutex
+	hosts map[string]*hostState
+}
+
+type hostState struct {
+	limit    HostLimit
+	tokens   float64
+	last     time.Time
+	inFlight int
+	adaptive *AdaptiveLimit
+	// changed is closed and replaced once a download is released or the in-flight cap changes
+	changed chan struct{}
+}
+
+// Acquire blocks until host may receive another request and returns how long it waited,
+// release must be called once the download from host is done
+func (h *HostLimiter) Acquire(ctx context.Context, host string) (release func(), waited time.Duration, err error) {
+	start := time.Now()
+	state := h.state(host)
+
+	if err := h.acquireInFlight(ctx, state); err != nil {
+		return nil, time.Since(start), err
+	}
+
+	release = func() { h.releaseInFlight(state) }
+
+	if delay := h.reserve(state); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			release()
+			return nil, time.Since(start), ctx.Err()
+		}
+	}
+
+	return release, time.Since(start), nil
+}
+
+// TryAcquire takes a slot of host when it may receive a request right away, otherwise it returns how long until
+// its rate lets a request through, 0 when the host is at its in-flight cap until one of its downloads is released
+func (h *HostLimiter) TryAcquire(host string) (release func(), retryIn time.Duration, ok bool) {
+	state := h.state(host)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if maxInFlight := state.maxInFlight(); maxInFlight > 0 && state.inFlight >= maxInFlight {
+		return nil, 0, false
+	}
+
+	if state.limit.Rate > 0 {
+		state.refill()
+
+		// unlike Acquire no token is taken ahead of time
+		if state.tokens < 1 {
+			return nil, time.Duration((1 - state.tokens) / state.limit.Rate * float64(time.Second)), false
+		}
+
+		state.tokens--
+	}
+
+	state.inFlight++
+	return func() { h.releaseInFlight(state) }, 0, true
+}
+
+func (h *HostLimiter) state(host string) *hostState {
+	host = strings.ToLower(host)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.hosts == nil {
+		h.hosts = make(map[string]*hostState)
+	}
+
+	if state, ok := h.hosts[host]; ok {
+		return state
+	}
+
+	limit, ok := h.Overrides[host]
+	if !ok {
+		limit = h.Default
+	}
+
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+
+	state := &hostState{
+		limit:   limit,
+		tokens:  float64(limit.Burst),
+		last:    time.Now(),
+		changed: make(chan struct{}),
+	}
+
+	if h.Adaptive != nil {
+		option := *h.Adaptive
+		if limit.MaxInFlight > 0 && limit.MaxInFlight < option.Max {
+			option.Max = limit.MaxInFlight
+		}
+		state.adaptive = NewAdaptiveLimit(option)
+	}
+
+	h.hosts[host] = state
+	return state
+}
+
+// Observe adapts the in-flight cap of host to the outcome of a download and returns the cap,
+// 0 when the cap is not adaptive
+func (h *HostLimiter) Observe(host string, latency time.Duration, congested bool) int {
+	state := h.state(host)
+	if state.adaptive == nil {
+		return 0
+	}
+
+	limit, changed := state.adaptive.Observe(latency, congested)
+	if changed {
+		h.mutex.Lock()
+		state.notify()
+		h.mutex.Unlock()
+	}
+
+	return limit
+}
+
+func (h *HostLimiter) acquireInFlight(ctx context.Context, state *hostState) error {
+	for {
+		h.mutex.Lock()
+
+		if maxInFlight := state.maxInFlight(); maxInFlight <= 0 || state.inFlight < maxInFlight {
+			state.inFlight++
+			h.mutex.Unlock()
+
+			return nil
+		}
+
+		changed := state.changed
+		h.mutex.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (h *HostLimiter) releaseInFlight(state *hostState) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	state.inFlight--
+	state.notify()
+}
+
+// maxInFlight is the adaptive cap of the host when there is one, MaxInFlight otherwise
+func (s *hostState) maxInFlight() int {
+	if s.adaptive != nil {
+		return s.adaptive.Limit()
+	}
+
+	return s.limit.MaxInFlight
+}
+
+func (s *hostState) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// reserve takes a token from the host bucket and returns how long to wait until the token is due
+func (h *HostLimiter) reserve(state *hostState) time.Duration {
+	if state.limit.Rate <= 0 {
+		return 0
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	state.refill()
+
+	state.tokens--
+	if state.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-state.tokens / state.limit.Rate * float64(time.Second))
+}
+
+func (s *hostState) refill() {
+	now := time.Now()
+	s.tokens += now.Sub(s.last).Seconds() * s.limit.Rate
+	s.last = now
+
+	if burst := float64(s.limit.Burst); s.tokens > burst {
+		s.tokens = burst
+	}
+}
@@ -0,0 +1,193 @@
+package imagedownloader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostLimiter_Acquire(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns immediately without limits", func(t *testing.T) {
+		limiter := &HostLimiter{}
+
+		for i := 0; i < 100; i++ {
+			release, waited, err := limiter.Acquire(ctx, "a.com")
+			assert.NoError(t, err)
+			assert.Less(t, waited, 10*time.Millisecond)
+			release()
+		}
+	})
+
+	t.Run("returns after waiting for a token once the burst is spent", func(t *testing.T) {
+		limiter := &HostLimiter{Default: HostLimit{Rate: 20, Burst: 2}}
+
+		for i := 0; i < 2; i++ {
+			release, waited, err := limiter.Acquire(ctx, "a.com")
+			assert.NoError(t, err)
+			assert.Less(t, waited, 10*time.Millisecond)
+			release()
+		}
+
+		release, waited, err := limiter.Acquire(ctx, "a.com")
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, waited, 30*time.Millisecond)
+		release()
+	})
+
+	t.Run("returns without waiting on a host that has its own bucket", func(t *testing.T) {
+		limiter := &HostLimiter{Default: HostLimit{Rate: 1, Burst: 1}}
+
+		release, _, err := limiter.Acquire(ctx, "a.com")
+		assert.NoError(t, err)
+		release()
+
+		release, waited, err := limiter.Acquire(ctx, "b.com")
+		assert.NoError(t, err)
+		assert.Less(t, waited, 10*time.Millisecond)
+		release()
+	})
+
+	t.Run("returns after an in-flight download of the host is released", func(t *testing.T) {
+		limiter := &HostLimiter{
+			Default:   HostLimit{MaxInFlight: 10},
+			Overrides: map[string]HostLimit{"a.com": {MaxInFlight: 1}},
+		}
+
+		release, _, err := limiter.Acquire(ctx, "A.com")
+		assert.NoError(t, err)
+
+		go func() {
+			time.Sleep(30 * time.Millisecond)
+			release()
+		}()
+
+		release, waited, err := limiter.Acquire(ctx, "a.com")
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, waited, 20*time.Millisecond)
+		release()
+	})
+
+	t.Run("returns error when context is done while waiting", func(t *testing.T) {
+		limiter := &HostLimiter{Default: HostLimit{MaxInFlight: 1}}
+
+		_, _, err := limiter.Acquire(ctx, "a.com")
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		_, _, err = limiter.Acquire(ctx, "a.com")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("returns error and frees the in-flight slot when context is done while waiting for a token", func(t *testing.T) {
+		limiter := &HostLimiter{Default: HostLimit{Rate: 0.1, Burst: 1, MaxInFlight: 1}}
+
+		release, _, err := limiter.Acquire(ctx, "a.com")
+		assert.NoError(t, err)
+		release()
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		_, _, err = limiter.Acquire(timeoutCtx, "a.com")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, 0, limiter.state("a.com").inFlight)
+	})
+}
+
+func TestHostLimiter_TryAcquire(t *testing.T) {
+	t.Run("returns no slot of a host at its in-flight cap until a download is released", func(t *testing.T) {
+		limiter := &HostLimiter{Overrides: map[string]HostLimit{"a.com": {MaxInFlight: 1}}}
+
+		release, _, ok := limiter.TryAcquire("a.com")
+		assert.True(t, ok)
+
+		_, retryIn, ok := limiter.TryAcquire("a.com")
+		assert.False(t, ok)
+		assert.Zero(t, retryIn)
+
+		_, _, ok = limiter.TryAcquire("b.com")
+		assert.True(t, ok)
+
+		release()
+
+		_, _, ok = limiter.TryAcquire("a.com")
+		assert.True(t, ok)
+	})
+
+	t.Run("returns no slot of a host out of tokens along with when its next token is due", func(t *testing.T) {
+		limiter := &HostLimiter{Default: HostLimit{Rate: 10, Burst: 1}}
+
+		release, _, ok := limiter.TryAcquire("a.com")
+		assert.True(t, ok)
+		release()
+
+		_, retryIn, ok := limiter.TryAcquire("a.com")
+		assert.False(t, ok)
+		assert.Greater(t, retryIn, 50*time.Millisecond)
+		assert.LessOrEqual(t, retryIn, 100*time.Millisecond)
+
+		// a host skipped doesn't spend a token
+		time.Sleep(retryIn)
+
+		_, _, ok = limiter.TryAcquire("a.com")
+		assert.True(t, ok)
+	})
+}
+
+func TestHostLimiter_Observe(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns 0 without an adaptive cap", func(t *testing.T) {
+		limiter := &HostLimiter{Default: HostLimit{MaxInFlight: 4}}
+
+		assert.Equal(t, 0, limiter.Observe("a.com", time.Millisecond, true))
+	})
+
+	t.Run("returns halved cap capped by max in flight on congestion", func(t *testing.T) {
+		limiter := &HostLimiter{
+			Default:  HostLimit{MaxInFlight: 8},
+			Adaptive: &AdaptiveOption{Initial: 16, Max: 64},
+		}
+
+		assert.Equal(t, 4, limiter.Observe("a.com", time.Millisecond, true))
+		assert.Equal(t, 8, limiter.Observe("b.com", time.Millisecond, false))
+	})
+
+	t.Run("returns after a download waiting on a lowered cap is let through by a raised one", func(t *testing.T) {
+		limiter := &HostLimiter{Adaptive: &AdaptiveOption{Initial: 2, Max: 2}}
+
+		for i := 0; i < 2; i++ {
+			_, _, err := limiter.Acquire(ctx, "a.com")
+			assert.NoError(t, err)
+		}
+
+		assert.Equal(t, 1, limiter.Observe("a.com", time.Millisecond, true))
+
+		acquired := make(chan struct{})
+
+		go func() {
+			release, _, err := limiter.Acquire(ctx, "a.com")
+			assert.NoError(t, err)
+			release()
+			close(acquired)
+		}()
+
+		// a healthy download raises the cap back to 2 but both slots are still held
+		assert.Equal(t, 2, limiter.Observe("a.com", time.Millisecond, false))
+
+		select {
+		case <-acquired:
+			t.Fatal("acquired while both slots are held")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		limiter.releaseInFlight(limiter.state("a.com"))
+		<-acquired
+	})
+}
@@ -1,58 +1,262 @@
 package imagedownloader
 
 import (
+	"context"
 	"errors"
+	"io"
 	"math"
 	"math/rand"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
+const (
+	retryAfterHeaderKey = "Retry-After"
+)
+
 var (
 	ErrSkippedContentType = errors.New("skip image due to not listed in accepted content type")
 )
 
+var (
+	DefaultRetryableStatusCodes = []int{
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+)
+
 type RetryOption struct {
 	BaseDelay   time.Duration
 	MaxDelay    time.Duration
 	MaxAttempts int
+	// RetryableStatusCodes lists response statuses worth another attempt
+	RetryableStatusCodes []int
+	// RetryableErrorFn reports whether a transport error is worth another attempt, nil retries every error
+	RetryableErrorFn func(err error) bool
 }
 
 type HTTPClient struct {
-	BaseClient                         httpClient
-	RetryOption                        RetryOption
-	AcceptedImageContentTypeExtensions map[string]string
+	BaseClient  httpClient
+	RetryOption RetryOption
+	// ContentTypes lists the accepted image content types, nil accepts none
+	ContentTypes *ContentTypeRegistry
+	// SniffPolicy decides how the detected image format is reconciled with the content type header,
+	// empty behaves as SniffPolicyHeader
+	SniffPolicy string
+	// Breaker fails requests to a host that keeps failing fast instead of retrying them, nil always sends them
+	Breaker hostBreaker
 }
 
 func (h *HTTPClient) Do(req *http.Request) (*http.Response, error) {
-	resp, err := h.do(req, 0)
+	resp, err := h.do(req)
 	if err != nil {
 		return resp, err
 	}
 
+	// a response without an image body is judged by its status code instead
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return resp, nil
+	}
+
 	contentType := resp.Header.Get(contentTypeHeaderKey)
 
-	if _, ok := h.AcceptedImageContentTypeExtensions[contentType]; !ok {
-		return resp, errors.Join(ErrSkippedContentType, err)
+	if h.SniffPolicy == "" || h.SniffPolicy == SniffPolicyHeader {
+		mediaType, _, ok := h.ContentTypes.Lookup(contentType)
+		if !ok {
+			return resp, errors.Join(ErrSkippedContentType, err)
+		}
+
+		traceFromContext(req.Context()).recordContentType(contentType, "", mediaType)
+		return resp, nil
 	}
 
-	return resp, nil
+	head, err := sniffBody(resp)
+	if err != nil {
+		return resp, err
+	}
+
+	detectedContentType := DetectContentType(head)
+	mediaType, err := h.reconcile(contentType, detectedContentType)
+	traceFromContext(req.Context()).recordContentType(contentType, detectedContentType, mediaType)
+
+	return resp, err
+}
+
+// Fetch sends req with the same retries and host breaker as an image download but returns the response whatever
+// its content type, e.g. for a page images are extracted from
+func (h *HTTPClient) Fetch(req *http.Request) (*http.Response, error) {
+	return h.do(req)
 }
 
-func (h *HTTPClient) do(req *http.Request, retryCount int) (*http.Response, error) {
-	delay := rand.Float64() * math.Pow(2.0, float64(retryCount)) * float64(h.RetryOption.BaseDelay)
-	delayDuration := time.Duration(delay)
+// reconcile judges the content type header against the detected image format under the sniff policy
+// and returns the media type the image is stored under
+func (h *HTTPClient) reconcile(contentType string, detectedContentType string) (string, error) {
+	mediaType, ext, accepted := h.ContentTypes.Lookup(contentType)
+	_, detectedExt, detectedAccepted := h.ContentTypes.Lookup(detectedContentType)
 
-	if retryCount != 0 {
-		time.Sleep(delayDuration)
+	switch {
+	// a body claiming to be an image, e.g. an html error page served as image/jpeg
+	case accepted && detectedContentType == "" && detectableContentTypes[mediaType]:
+		return "", ErrContentTypeMismatch
+	// an accepted format that can't be detected, e.g. through a wildcard, is taken at its word
+	case accepted && detectedContentType == "" && h.SniffPolicy != SniffPolicyStrict:
+		return mediaType, nil
+	// neither the header nor the body is an image worth downloading
+	case !detectedAccepted:
+		return "", ErrSkippedContentType
+	// aliases of the same format share the same extension
+	case h.SniffPolicy == SniffPolicyStrict && (!accepted || ext != detectedExt):
+		return "", ErrContentTypeMismatch
 	}
 
-	resp, err := h.BaseClient.Do(req)
-	retryable := err != nil && delayDuration <= h.RetryOption.MaxDelay && retryCount+1 <= h.RetryOption.MaxAttempts
+	return detectedContentType, nil
+}
+
+func (h *HTTPClient) do(req *http.Request) (*http.Response, error) {
+	trace := traceFromContext(req.Context())
+
+	for retryCount := 0; ; retryCount++ {
+		done, err := h.allow(req)
+		if err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		resp, err := h.BaseClient.Do(req)
+		done(breakerOutcomeOf(req, resp, err))
+
+		if resp != nil {
+			trace.recordAttempt(resp.StatusCode, time.Since(start), congestedStatusCode(resp.StatusCode))
+		} else {
+			trace.recordAttempt(0, time.Since(start), isTimeout(req.Context(), err))
+		}
+
+		delay, retryable := h.retryDelay(req, resp, err, retryCount)
+		if !retryable {
+			return resp, err
+		}
+
+		// release the connection of a response that is going to be retried
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		// a canceled request stops waiting for its next attempt right away
+		timer := time.NewTimer(delay)
 
-	if retryable {
-		return h.do(req, retryCount+1)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
 	}
+}
 
-	return resp, err
+// allow asks the breaker whether the host of req may receive another attempt
+func (h *HTTPClient) allow(req *http.Request) (func(breakerOutcome), error) {
+	if h.Breaker == nil {
+		return func(breakerOutcome) {}, nil
+	}
+
+	return h.Breaker.Allow(req.URL.Hostname())
+}
+
+// breakerOutcomeOf counts transport errors and 5xx responses as failures of the host
+func breakerOutcomeOf(req *http.Request, resp *http.Response, err error) breakerOutcome {
+	switch {
+	case req.Context().Err() != nil:
+		return breakerIgnored
+	case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+		return breakerFailure
+	default:
+		return breakerSuccess
+	}
+}
+
+func (h *HTTPClient) retryDelay(req *http.Request, resp *http.Response, err error, retryCount int) (time.Duration, bool) {
+	if retryCount+1 > h.RetryOption.MaxAttempts || req.Context().Err() != nil {
+		return 0, false
+	}
+
+	if err != nil && h.RetryOption.RetryableErrorFn != nil && !h.RetryOption.RetryableErrorFn(err) {
+		return 0, false
+	}
+
+	if err == nil && !h.retryableStatusCode(resp.StatusCode) {
+		return 0, false
+	}
+
+	delay := time.Duration(rand.Float64() * math.Pow(2.0, float64(retryCount)) * float64(h.RetryOption.BaseDelay))
+
+	// the server knows best when it is ready again
+	if resp != nil {
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get(retryAfterHeaderKey), time.Now()); ok {
+			delay = retryAfter
+		}
+	}
+
+	if delay > h.RetryOption.MaxDelay {
+		delay = h.RetryOption.MaxDelay
+	}
+
+	return delay, true
+}
+
+func (h *HTTPClient) retryableStatusCode(statusCode int) bool {
+	for _, retryableStatusCode := range h.RetryOption.RetryableStatusCodes {
+		if statusCode == retryableStatusCode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// congestedStatusCode tells a response asks for less traffic, either explicitly or by failing under load
+func congestedStatusCode(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+// isTimeout tells err is a timeout of the transport rather than the request being canceled on purpose
+func isTimeout(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout() || errors.Is(err, context.DeadlineExceeded)
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as an http date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	if delay := date.Sub(now); delay > 0 {
+		return delay, true
+	}
+
+	return 0, true
 }
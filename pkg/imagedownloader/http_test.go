@@ -1,7 +1,10 @@
 package imagedownloader
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"io"
 	"net/http"
 	"testing"
 	"time"
@@ -20,9 +23,9 @@ func TestHTTPClient_Do(t *testing.T) {
 		mockHttpClient := NewMockhttpClient(ctrl)
 
 		client := &HTTPClient{
-			BaseClient:                         mockHttpClient,
-			RetryOption:                        RetryOption{},
-			AcceptedImageContentTypeExtensions: nil,
+			BaseClient:   mockHttpClient,
+			RetryOption:  RetryOption{},
+			ContentTypes: nil,
 		}
 
 		// mock functions
@@ -46,7 +49,7 @@ func TestHTTPClient_Do(t *testing.T) {
 				MaxDelay:    time.Duration(3) * time.Second,
 				MaxAttempts: 3,
 			},
-			AcceptedImageContentTypeExtensions: nil,
+			ContentTypes: nil,
 		}
 
 		// mock functions
@@ -70,7 +73,7 @@ func TestHTTPClient_Do(t *testing.T) {
 				MaxDelay:    time.Duration(3) * time.Second,
 				MaxAttempts: 3,
 			},
-			AcceptedImageContentTypeExtensions: nil,
+			ContentTypes: nil,
 		}
 
 		// mock functions
@@ -98,7 +101,7 @@ func TestHTTPClient_Do(t *testing.T) {
 				MaxDelay:    time.Duration(3) * time.Second,
 				MaxAttempts: 3,
 			},
-			AcceptedImageContentTypeExtensions: CommonImageContentTypeExtensions,
+			ContentTypes: NewContentTypeRegistry(CommonImageContentTypeExtensions, CommonImageContentTypeAliases),
 		}
 
 		// mock functions
@@ -112,4 +115,388 @@ func TestHTTPClient_Do(t *testing.T) {
 		assert.NoError(t, err)
 		assert.NotNil(t, resp)
 	})
+
+	t.Run("returns the last response after retrying retryable status codes", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttpClient := NewMockhttpClient(ctrl)
+
+		client := &HTTPClient{
+			BaseClient: mockHttpClient,
+			RetryOption: RetryOption{
+				BaseDelay:            time.Millisecond,
+				MaxDelay:             time.Duration(10) * time.Millisecond,
+				MaxAttempts:          2,
+				RetryableStatusCodes: DefaultRetryableStatusCodes,
+			},
+			ContentTypes: NewContentTypeRegistry(CommonImageContentTypeExtensions, CommonImageContentTypeAliases),
+		}
+
+		// mock functions
+		mockHttpClient.EXPECT().Do(gomock.Any()).Return(&http.Response{
+			StatusCode: http.StatusServiceUnavailable,
+			Body:       io.NopCloser(bytes.NewBuffer(nil)),
+		}, nil).Times(3)
+
+		resp, err := client.Do(baseReq)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	})
+
+	t.Run("returns a successful response after a throttled one, honoring retry after capped by max delay", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttpClient := NewMockhttpClient(ctrl)
+
+		client := &HTTPClient{
+			BaseClient: mockHttpClient,
+			RetryOption: RetryOption{
+				BaseDelay:            time.Millisecond,
+				MaxDelay:             time.Duration(20) * time.Millisecond,
+				MaxAttempts:          3,
+				RetryableStatusCodes: DefaultRetryableStatusCodes,
+			},
+			ContentTypes: NewContentTypeRegistry(CommonImageContentTypeExtensions, CommonImageContentTypeAliases),
+		}
+
+		// mock functions
+		gomock.InOrder(
+			mockHttpClient.EXPECT().Do(gomock.Any()).Return(&http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Header:     map[string][]string{"Retry-After": {"3600"}},
+				Body:       io.NopCloser(bytes.NewBuffer(nil)),
+			}, nil),
+			mockHttpClient.EXPECT().Do(gomock.Any()).Return(&http.Response{
+				StatusCode: http.StatusOK,
+				Header:     map[string][]string{"Content-Type": {"image/jpeg"}},
+			}, nil),
+		)
+
+		ctx, trace := withTrace(context.Background())
+		start := time.Now()
+
+		resp, err := client.Do(baseReq.WithContext(ctx))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.GreaterOrEqual(t, time.Since(start), time.Duration(20)*time.Millisecond)
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Equal(t, 2, trace.attempts)
+		assert.Equal(t, http.StatusOK, trace.statusCode)
+		assert.True(t, trace.congested)
+		assert.Equal(t, "image/jpeg", trace.mediaType)
+	})
+
+	t.Run("returns context error without waiting out the retry delay once canceled", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttpClient := NewMockhttpClient(ctrl)
+
+		client := &HTTPClient{
+			BaseClient: mockHttpClient,
+			RetryOption: RetryOption{
+				BaseDelay:            time.Hour,
+				MaxDelay:             time.Hour,
+				MaxAttempts:          3,
+				RetryableStatusCodes: DefaultRetryableStatusCodes,
+			},
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// mock functions
+		mockHttpClient.EXPECT().Do(gomock.Any()).DoAndReturn(func(*http.Request) (*http.Response, error) {
+			time.AfterFunc(time.Duration(10)*time.Millisecond, cancel)
+
+			return &http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Header:     map[string][]string{"Retry-After": {"3600"}},
+				Body:       io.NopCloser(bytes.NewBuffer(nil)),
+			}, nil
+		})
+
+		start := time.Now()
+
+		resp, err := client.Do(baseReq.WithContext(ctx))
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Nil(t, resp)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("returns response without retry on a non retryable status code", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttpClient := NewMockhttpClient(ctrl)
+
+		client := &HTTPClient{
+			BaseClient: mockHttpClient,
+			RetryOption: RetryOption{
+				BaseDelay:            time.Millisecond,
+				MaxDelay:             time.Duration(10) * time.Millisecond,
+				MaxAttempts:          3,
+				RetryableStatusCodes: DefaultRetryableStatusCodes,
+			},
+		}
+
+		// mock functions
+		mockHttpClient.EXPECT().Do(gomock.Any()).Return(&http.Response{
+			StatusCode: http.StatusNotFound,
+			Header:     map[string][]string{"Content-Type": {"text/html"}},
+		}, nil)
+
+		resp, err := client.Do(baseReq)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("returns error without retry on a non retryable error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttpClient := NewMockhttpClient(ctrl)
+		errPermanent := errors.New("permanent")
+
+		client := &HTTPClient{
+			BaseClient: mockHttpClient,
+			RetryOption: RetryOption{
+				BaseDelay:   time.Millisecond,
+				MaxDelay:    time.Duration(10) * time.Millisecond,
+				MaxAttempts: 3,
+				RetryableErrorFn: func(err error) bool {
+					return !errors.Is(err, errPermanent)
+				},
+			},
+		}
+
+		// mock functions
+		mockHttpClient.EXPECT().Do(gomock.Any()).Return(nil, errPermanent)
+
+		_, err := client.Do(baseReq)
+		assert.ErrorIs(t, err, errPermanent)
+	})
+}
+
+func TestHTTPClient_Do_Sniff(t *testing.T) {
+	png := "\x89PNG\r\n\x1A\n\x00\x00\x00\x0DIHDR"
+	html := "<!doctype html><html><body>not found</body></html>"
+
+	newClient := func(ctrl *gomock.Controller, policy string, contentType string, body string) *HTTPClient {
+		mockHttpClient := NewMockhttpClient(ctrl)
+
+		// mock functions
+		mockHttpClient.EXPECT().Do(gomock.Any()).Return(&http.Response{
+			StatusCode: http.StatusOK,
+			Header:     map[string][]string{"Content-Type": {contentType}},
+			Body:       io.NopCloser(bytes.NewBufferString(body)),
+		}, nil)
+
+		return &HTTPClient{
+			BaseClient:   mockHttpClient,
+			ContentTypes: NewContentTypeRegistry(CommonImageContentTypeExtensions, CommonImageContentTypeAliases),
+			SniffPolicy:  policy,
+		}
+	}
+
+	newRequest := func() (*http.Request, *downloadTrace) {
+		ctx, trace := withTrace(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://a.com/a.jpg", nil)
+		return req, trace
+	}
+
+	t.Run("returns detected image served under a generic content type with its body intact", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		req, trace := newRequest()
+
+		resp, err := newClient(ctrl, SniffPolicyDetect, "application/octet-stream", png).Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, "image/png", trace.detectedContentType)
+		assert.Equal(t, "image/png", trace.resolvedContentType("application/octet-stream"))
+
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, png, string(body))
+	})
+
+	t.Run("returns mismatch on a non image body served as an image", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		req, _ := newRequest()
+
+		_, err := newClient(ctrl, SniffPolicyDetect, "image/jpeg", html).Do(req)
+		assert.ErrorIs(t, err, ErrContentTypeMismatch)
+	})
+
+	t.Run("returns skipped on a non image body served as a non image", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		req, _ := newRequest()
+
+		_, err := newClient(ctrl, SniffPolicyDetect, "text/html", html).Do(req)
+		assert.ErrorIs(t, err, ErrSkippedContentType)
+	})
+
+	t.Run("returns detected format served as another image type", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		req, trace := newRequest()
+
+		_, err := newClient(ctrl, SniffPolicyDetect, "image/jpeg", png).Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, "image/png", trace.resolvedContentType("image/jpeg"))
+	})
+
+	t.Run("returns mismatch on strict policy when header and format disagree", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		req, _ := newRequest()
+
+		_, err := newClient(ctrl, SniffPolicyStrict, "image/jpeg", png).Do(req)
+		assert.ErrorIs(t, err, ErrContentTypeMismatch)
+	})
+
+	t.Run("returns no error on strict policy when header is an alias of the format", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		req, _ := newRequest()
+
+		_, err := newClient(ctrl, SniffPolicyStrict, "image/vnd.microsoft.icon", "\x00\x00\x01\x00\x01\x00").Do(req)
+		assert.NoError(t, err)
+	})
+
+	t.Run("returns normalized media type of a header with parameters on header policy", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		req, trace := newRequest()
+
+		_, err := newClient(ctrl, SniffPolicyHeader, "Image/JPG; charset=binary", html).Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, "image/jpeg", trace.resolvedContentType("Image/JPG; charset=binary"))
+	})
+
+	t.Run("returns header media type of an undetectable format accepted by a wildcard", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		req, trace := newRequest()
+		client := newClient(ctrl, SniffPolicyDetect, "image/x-portable-pixmap", "P6\n1 1\n255\n")
+		client.ContentTypes = NewContentTypeRegistry(map[string]string{"image/*": ".img"}, nil)
+
+		_, err := client.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, "image/x-portable-pixmap", trace.resolvedContentType("image/x-portable-pixmap"))
+	})
+
+	t.Run("returns no error on header policy whatever the body is", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		req, trace := newRequest()
+
+		_, err := newClient(ctrl, SniffPolicyHeader, "image/jpeg", html).Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, "image/jpeg", trace.resolvedContentType("image/jpeg"))
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2023, time.September, 1, 10, 0, 0, 0, time.UTC)
+
+	t.Run("returns delay given in seconds", func(t *testing.T) {
+		delay, ok := parseRetryAfter("120", now)
+		assert.True(t, ok)
+		assert.Equal(t, time.Duration(120)*time.Second, delay)
+	})
+
+	t.Run("returns delay until the given http date", func(t *testing.T) {
+		delay, ok := parseRetryAfter("Fri, 01 Sep 2023 10:00:30 GMT", now)
+		assert.True(t, ok)
+		assert.Equal(t, time.Duration(30)*time.Second, delay)
+
+		delay, ok = parseRetryAfter("Fri, 01 Sep 2023 09:00:00 GMT", now)
+		assert.True(t, ok)
+		assert.Equal(t, time.Duration(0), delay)
+	})
+
+	t.Run("returns nothing on a missing or invalid value", func(t *testing.T) {
+		for _, value := range []string{"", "-1", "soon"} {
+			_, ok := parseRetryAfter(value, now)
+			assert.False(t, ok)
+		}
+	})
+}
+
+func TestHTTPClient_Do_Breaker(t *testing.T) {
+	baseReq, _ := http.NewRequest(http.MethodGet, "https://google.com/image.jpg", nil)
+
+	t.Run("returns circuit open error without exhausting retries once the host circuit opens", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttpClient := NewMockhttpClient(ctrl)
+
+		client := &HTTPClient{
+			BaseClient: mockHttpClient,
+			RetryOption: RetryOption{
+				MaxAttempts: 10,
+			},
+			Breaker: &HostBreaker{Option: BreakerOption{FailureRatio: 0.5, MinRequests: 2, OpenTimeout: time.Minute}},
+		}
+
+		// mock functions
+		mockHttpClient.EXPECT().Do(gomock.Any()).Return(nil, errors.New("error")).Times(2)
+
+		resp, err := client.Do(baseReq)
+		assert.ErrorIs(t, err, ErrHostCircuitOpen)
+		assert.Nil(t, resp)
+
+		_, err = client.Do(baseReq)
+		assert.ErrorIs(t, err, ErrHostCircuitOpen)
+	})
+}
+
+func TestHTTPClient_Fetch(t *testing.T) {
+	baseReq, _ := http.NewRequest(http.MethodGet, "https://google.com/gallery.html", nil)
+
+	t.Run("returns a retried response whatever its content type", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockHttpClient := NewMockhttpClient(ctrl)
+
+		client := &HTTPClient{
+			BaseClient: mockHttpClient,
+			RetryOption: RetryOption{
+				MaxAttempts:          2,
+				RetryableStatusCodes: DefaultRetryableStatusCodes,
+			},
+			ContentTypes: NewContentTypeRegistry(CommonImageContentTypeExtensions, nil),
+		}
+
+		page := &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{contentTypeHeaderKey: []string{"text/html"}},
+			Body:       io.NopCloser(bytes.NewReader([]byte("<html></html>"))),
+		}
+
+		// mock functions
+		gomock.InOrder(
+			mockHttpClient.EXPECT().Do(gomock.Any()).Return(&http.Response{StatusCode: http.StatusServiceUnavailable, Body: io.NopCloser(bytes.NewReader(nil))}, nil),
+			mockHttpClient.EXPECT().Do(gomock.Any()).Return(page, nil),
+		)
+
+		resp, err := client.Fetch(baseReq)
+		assert.NoError(t, err)
+		assert.Equal(t, page, resp)
+	})
 }
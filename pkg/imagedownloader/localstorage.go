@@ -0,0 +1,100 @@
+package imagedownloader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ErrInvalidStorageKey = errors.New("storage key must be a relative path inside the storage root")
+)
+
+// LocalStorage stores images on the local disk, a key is a slash separated path relative to RootPath
+type LocalStorage struct {
+	RootPath string
+	// Sync flushes every image to the disk before it is renamed into place
+	Sync bool
+}
+
+// Put writes the body into a temp file next to the final one and renames it into place once the body
+// is completely read, so a failed or interrupted download never leaves a partial image at the key
+func (l *LocalStorage) Put(ctx context.Context, key string, body io.Reader, _ Metadata) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(name), ".download-*")
+	if err != nil {
+		return err
+	}
+
+	// the temp file is gone after a successful rename, so removal only cleans up failures
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if _, err := io.Copy(file, &contextReader{ctx: ctx, reader: body}); err != nil {
+		return err
+	}
+
+	if l.Sync {
+		if err := file.Sync(); err != nil {
+			return err
+		}
+	}
+
+	// temp files are private by default, give it the permission of a regularly created file
+	if err := file.Chmod(0644); err != nil {
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), name)
+}
+
+func (l *LocalStorage) Exists(_ context.Context, key string) (bool, error) {
+	name, err := l.path(key)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (l *LocalStorage) Delete(_ context.Context, key string) error {
+	name, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+func (l *LocalStorage) path(key string) (string, error) {
+	name := filepath.FromSlash(key)
+	if !filepath.IsLocal(name) {
+		return "", ErrInvalidStorageKey
+	}
+
+	return filepath.Join(l.RootPath, name), nil
+}
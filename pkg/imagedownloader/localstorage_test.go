@@ -0,0 +1,100 @@
+package imagedownloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalStorage(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns error on a key escaping the storage root", func(t *testing.T) {
+		storage := &LocalStorage{RootPath: t.TempDir()}
+
+		err := storage.Put(ctx, "../image.jpg", bytes.NewBufferString("image"), Metadata{})
+		assert.ErrorIs(t, err, ErrInvalidStorageKey)
+
+		_, err = storage.Exists(ctx, "/etc/passwd")
+		assert.ErrorIs(t, err, ErrInvalidStorageKey)
+	})
+
+	t.Run("stores, finds and deletes an image by its key", func(t *testing.T) {
+		root := t.TempDir()
+		storage := &LocalStorage{RootPath: root}
+
+		exists, err := storage.Exists(ctx, "a/b/image.jpg")
+		assert.NoError(t, err)
+		assert.False(t, exists)
+
+		assert.NoError(t, storage.Put(ctx, "a/b/image.jpg", bytes.NewBufferString("image"), Metadata{Size: 5}))
+
+		b, err := os.ReadFile(filepath.Join(root, "a", "b", "image.jpg"))
+		assert.NoError(t, err)
+		assert.Equal(t, "image", string(b))
+
+		exists, err = storage.Exists(ctx, "a/b/image.jpg")
+		assert.NoError(t, err)
+		assert.True(t, exists)
+
+		assert.NoError(t, storage.Delete(ctx, "a/b/image.jpg"))
+		assert.NoError(t, storage.Delete(ctx, "a/b/image.jpg"))
+
+		exists, err = storage.Exists(ctx, "a/b/image.jpg")
+		assert.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("returns error and leaves nothing behind on a failed body", func(t *testing.T) {
+		root := t.TempDir()
+		storage := &LocalStorage{RootPath: root, Sync: true}
+
+		body := io.MultiReader(bytes.NewBufferString("partial"), iotest.ErrReader(errors.New("error")))
+		assert.Error(t, storage.Put(ctx, "image.jpg", body, Metadata{Size: -1}))
+
+		entries, _ := os.ReadDir(root)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("returns context error and leaves nothing behind once canceled", func(t *testing.T) {
+		root := t.TempDir()
+		storage := &LocalStorage{RootPath: root}
+
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		err := storage.Put(ctx, "image.jpg", bytes.NewBufferString("image"), Metadata{Size: 5})
+		assert.ErrorIs(t, err, context.Canceled)
+
+		entries, _ := os.ReadDir(root)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("replaces an existing image only once the body is complete", func(t *testing.T) {
+		root := t.TempDir()
+		storage := &LocalStorage{RootPath: root, Sync: true}
+
+		assert.NoError(t, storage.Put(ctx, "image.jpg", bytes.NewBufferString("image"), Metadata{Size: 5}))
+
+		body := io.MultiReader(bytes.NewBufferString("partial"), iotest.ErrReader(errors.New("error")))
+		assert.Error(t, storage.Put(ctx, "image.jpg", body, Metadata{Size: -1}))
+
+		b, err := os.ReadFile(filepath.Join(root, "image.jpg"))
+		assert.NoError(t, err)
+		assert.Equal(t, "image", string(b))
+
+		info, err := os.Stat(filepath.Join(root, "image.jpg"))
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+		entries, _ := os.ReadDir(root)
+		assert.Len(t, entries, 1)
+	})
+}
@@ -0,0 +1,243 @@
+package imagedownloader
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3Service            = "s3"
+	s3Algorithm          = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload    = "UNSIGNED-PAYLOAD"
+	s3DateFormat         = "20060102"
+	s3DateTimeFormat     = "20060102T150405Z"
+	s3ContentHashHeader  = "X-Amz-Content-Sha256"
+	s3DateHeader         = "X-Amz-Date"
+	s3AuthorizationKey   = "Authorization"
+	s3UnexpectedResponse = "unexpected s3 response status: %d"
+)
+
+var (
+	ErrS3Request = errors.New("could not complete s3 request")
+)
+
+// S3Storage stores images as objects of an S3 compatible bucket addressed in path style,
+// i.e. <endpoint>/<bucket>/<key>, so it also works against MinIO and alike
+type S3Storage struct {
+	HTTPClient      httpClient
+	Endpoint        string
+	Bucket          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	NowFn           func() time.Time
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, body io.Reader, metadata Metadata) error {
+	// s3 needs the object length up front, so an unknown sized body is spooled to disk first
+	if metadata.Size < 0 {
+		file, err := os.CreateTemp("", ".s3-upload-*")
+		if err != nil {
+			return err
+		}
+
+		defer os.Remove(file.Name())
+		defer file.Close()
+
+		if metadata.Size, err = io.Copy(file, &contextReader{ctx: ctx, reader: body}); err != nil {
+			return err
+		}
+
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		body = file
+	}
+
+	// a non-nil body of zero length would otherwise be sent chunked
+	if metadata.Size == 0 {
+		body = http.NoBody
+	}
+
+	req, err := s.newRequest(ctx, http.MethodPut, key, body)
+	if err != nil {
+		return err
+	}
+
+	req.ContentLength = metadata.Size
+	if metadata.ContentType != "" {
+		req.Header.Set(contentTypeHeaderKey, metadata.ContentType)
+	}
+
+	_, err = s.do(req, http.StatusOK)
+	return err
+}
+
+func (s *S3Storage) Exists(ctx context.Context, key string) (bool, error) {
+	req, err := s.newRequest(ctx, http.MethodHead, key, nil)
+	if err != nil {
+		return false, err
+	}
+
+	status, err := s.do(req, http.StatusOK, http.StatusNotFound)
+	return status == http.StatusOK, err
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.do(req, http.StatusOK, http.StatusNoContent)
+	return err
+}
+
+func (s *S3Storage) newRequest(ctx context.Context, method string, key string, body io.Reader) (*http.Request, error) {
+	url := fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(s.Endpoint, "/"), s.Bucket, s3URIEncode(key, false))
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, errors.Join(ErrS3Request, err)
+	}
+
+	return req, nil
+}
+
+func (s *S3Storage) do(req *http.Request, expectedStatuses ...int) (int, error) {
+	req.Header.Set(s3ContentHashHeader, s3UnsignedPayload)
+	s.sign(req, s.now())
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return 0, errors.Join(ErrS3Request, err)
+	}
+
+	// drain the body so the connection can be reused
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	for _, status := range expectedStatuses {
+		if resp.StatusCode == status {
+			return resp.StatusCode, nil
+		}
+	}
+
+	return resp.StatusCode, errors.Join(ErrS3Request, fmt.Errorf(s3UnexpectedResponse, resp.StatusCode))
+}
+
+// sign adds an AWS signature version 4 authorization header covering the host and every header set on req
+func (s *S3Storage) sign(req *http.Request, now time.Time) {
+	now = now.UTC()
+	date := now.Format(s3DateFormat)
+	req.Header.Set(s3DateHeader, now.Format(s3DateTimeFormat))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		if name == s3AuthorizationKey {
+			continue
+		}
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3URIEncode(req.URL.Path, false),
+		s3CanonicalQuery(req),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get(s3ContentHashHeader),
+	}, "\n")
+
+	scope := strings.Join([]string{date, s.Region, s3Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		now.Format(s3DateTimeFormat),
+		scope,
+		hex.EncodeToString(sha256Sum([]byte(canonicalRequest))),
+	}, "\n")
+
+	signingKey := hmacSum([]byte("AWS4"+s.SecretAccessKey), []byte(date))
+	signingKey = hmacSum(signingKey, []byte(s.Region))
+	signingKey = hmacSum(signingKey, []byte(s3Service))
+	signingKey = hmacSum(signingKey, []byte("aws4_request"))
+	signature := hex.EncodeToString(hmacSum(signingKey, []byte(stringToSign)))
+
+	req.Header.Set(s3AuthorizationKey, fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func (s *S3Storage) now() time.Time {
+	if s.NowFn == nil {
+		return time.Now()
+	}
+
+	return s.NowFn()
+}
+
+func s3CanonicalQuery(req *http.Request) string {
+	query := req.URL.Query()
+	pairs := make([]string, 0, len(query))
+
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, s3URIEncode(name, true)+"="+s3URIEncode(value, true))
+		}
+	}
+
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// s3URIEncode encodes every byte except the unreserved characters of RFC 3986, optionally keeping slashes
+func s3URIEncode(value string, encodeSlash bool) string {
+	var builder strings.Builder
+
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			builder.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			builder.WriteByte(b)
+		default:
+			builder.WriteString(fmt.Sprintf("%%%02X", b))
+		}
+	}
+
+	return builder.String()
+}
+
+func sha256Sum(b []byte) []byte {
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
+
+func hmacSum(key []byte, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,173 @@
+package imagedownloader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+)
+
+const (
+	// sniffLength is how many leading body bytes are inspected to detect an image format
+	sniffLength = 512
+)
+
+const (
+	// SniffPolicyHeader trusts the content type header and never looks at the body
+	SniffPolicyHeader = "header"
+	// SniffPolicyDetect trusts the detected format, a body that is no image is a mismatch unless its header isn't one either
+	SniffPolicyDetect = "detect"
+	// SniffPolicyStrict requires the detected format to agree with the content type header
+	SniffPolicyStrict = "strict"
+)
+
+var (
+	ErrContentTypeMismatch = errors.New("image content does not match its content type")
+)
+
+type signature struct {
+	offset      int
+	magic       []byte
+	contentType string
+}
+
+var (
+	imageSignatures = []signature{
+		{0, []byte("\xFF\xD8\xFF"), "image/jpeg"},
+		{0, []byte("\x89PNG\r\n\x1A\n"), "image/png"},
+		{0, []byte("GIF87a"), "image/gif"},
+		{0, []byte("GIF89a"), "image/gif"},
+		{8, []byte("WEBP"), "image/webp"},
+		{0, []byte("BM"), "image/bmp"},
+		{0, []byte("II*\x00"), "image/tiff"},
+		{0, []byte("MM\x00*"), "image/tiff"},
+		{0, []byte("\x00\x00\x01\x00"), "image/x-icon"},
+		{0, []byte("\x00\x00\x00\x0CjP  \r\n\x87\n"), "image/jp2"},
+		{0, []byte("\xFF\x4F\xFF\x51"), "image/jp2"},
+		{0, []byte("#?RADIANCE"), "image/vnd.radiance"},
+		{0, []byte("#?RGBE"), "image/vnd.radiance"},
+	}
+
+	// detectableContentTypes lists the media types DetectContentType recognizes, aliases included
+	detectableContentTypes = map[string]bool{
+		"image/jpeg":               true,
+		"image/png":                true,
+		"image/gif":                true,
+		"image/webp":               true,
+		"image/bmp":                true,
+		"image/x-ms-bmp":           true,
+		"image/tiff":               true,
+		"image/x-icon":             true,
+		"image/vnd.microsoft.icon": true,
+		"image/jp2":                true,
+		"image/vnd.radiance":       true,
+		"image/avif":               true,
+		"image/svg+xml":            true,
+	}
+)
+
+// DetectContentType returns the image content type matching the leading bytes of a body, or an empty string
+// when they belong to no known image format
+func DetectContentType(head []byte) string {
+	for _, sig := range imageSignatures {
+		if len(head) < sig.offset+len(sig.magic) || !bytes.Equal(head[sig.offset:sig.offset+len(sig.magic)], sig.magic) {
+			continue
+		}
+
+		// webp lives in a riff container shared with audio and video formats
+		if sig.contentType == "image/webp" && !bytes.HasPrefix(head, []byte("RIFF")) {
+			continue
+		}
+
+		return sig.contentType
+	}
+
+	if isAVIF(head) {
+		return "image/avif"
+	}
+
+	if isSVG(head) {
+		return "image/svg+xml"
+	}
+
+	return ""
+}
+
+// isAVIF looks for an avif brand in the leading iso media ftyp box
+func isAVIF(head []byte) bool {
+	if len(head) < 16 || !bytes.Equal(head[4:8], []byte("ftyp")) {
+		return false
+	}
+
+	size := int(binary.BigEndian.Uint32(head[:4]))
+	if size > len(head) {
+		size = len(head)
+	}
+
+	// the major brand is followed by a minor version and the compatible brands
+	for offset := 8; offset+4 <= size; offset += 4 {
+		if offset == 12 {
+			continue
+		}
+
+		if brand := string(head[offset : offset+4]); brand == "avif" || brand == "avis" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isSVG accepts a markup body whose first element, after any xml declaration, comment or doctype, is an svg
+func isSVG(head []byte) bool {
+	head = bytes.TrimPrefix(head, []byte("\xEF\xBB\xBF"))
+
+	for {
+		head = bytes.TrimLeft(head, " \t\r\n")
+
+		switch {
+		case bytes.HasPrefix(head, []byte("<?")):
+			head = skipPast(head, "?>")
+		case bytes.HasPrefix(head, []byte("<!--")):
+			head = skipPast(head, "-->")
+		case bytes.HasPrefix(head, []byte("<!")):
+			head = skipPast(head, ">")
+		default:
+			return len(head) > 4 && bytes.EqualFold(head[:4], []byte("<svg")) &&
+				bytes.ContainsAny(head[4:5], " \t\r\n/>")
+		}
+
+		if head == nil {
+			return false
+		}
+	}
+}
+
+func skipPast(head []byte, end string) []byte {
+	i := bytes.Index(head, []byte(end))
+	if i < 0 {
+		return nil
+	}
+
+	return head[i+len(end):]
+}
+
+// sniffBody peeks at the leading bytes of a response body without consuming them
+func sniffBody(resp *http.Response) ([]byte, error) {
+	reader := bufio.NewReaderSize(resp.Body, sniffLength)
+
+	head, err := reader.Peek(sniffLength)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	resp.Body = &sniffedBody{Reader: reader, Closer: resp.Body}
+	return head, nil
+}
+
+type sniffedBody struct {
+	io.Reader
+	io.Closer
+}
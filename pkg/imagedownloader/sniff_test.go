@@ -0,0 +1,48 @@
+package imagedownloader
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectContentType(t *testing.T) {
+	t.Run("returns content type of known image formats", func(t *testing.T) {
+		testCases := map[string]string{
+			"\xFF\xD8\xFF\xE0\x00\x10JFIF":                                              "image/jpeg",
+			"\x89PNG\r\n\x1A\n\x00\x00\x00\x0DIHDR":                                     "image/png",
+			"GIF89a\x01\x00\x01\x00":                                                    "image/gif",
+			"RIFF\x24\x00\x00\x00WEBPVP8 ":                                              "image/webp",
+			"BM\x36\x00\x00\x00":                                                        "image/bmp",
+			"II*\x00\x08\x00\x00\x00":                                                   "image/tiff",
+			"MM\x00*\x00\x00\x00\x08":                                                   "image/tiff",
+			"\x00\x00\x01\x00\x01\x00\x10\x10":                                          "image/x-icon",
+			"\x00\x00\x00\x0CjP  \r\n\x87\n\x00\x00\x00\x14ftypjp2 ":                    "image/jp2",
+			"#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n":                                      "image/vnd.radiance",
+			"\x00\x00\x00\x1CftypavifT\x00\x00\x00avifmif1miaf":                         "image/avif",
+			"\x00\x00\x00\x1Cftypmif1\x00\x00\x00\x00mif1avifmiaf":                      "image/avif",
+			"<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>":                          "image/svg+xml",
+			"\xEF\xBB\xBF<?xml version=\"1.0\"?>\n<!-- logo -->\n<!DOCTYPE svg>\n<SVG>": "image/svg+xml",
+		}
+
+		for head, contentType := range testCases {
+			assert.Equal(t, contentType, DetectContentType([]byte(head)), head)
+		}
+	})
+
+	t.Run("returns nothing on unknown formats", func(t *testing.T) {
+		testCases := []string{
+			"",
+			"<!doctype html><html><body>not found</body></html>",
+			"<svgfoo>",
+			"<?xml version=\"1.0\"?><rss></rss>",
+			"RIFF\x24\x00\x00\x00WAVEfmt ",
+			"\x00\x00\x00\x1Cftypisom\x00\x00\x02\x00isomiso2mp41",
+			"{\"error\": \"not found\"}",
+		}
+
+		for _, head := range testCases {
+			assert.Empty(t, DetectContentType([]byte(head)), head)
+		}
+	})
+}
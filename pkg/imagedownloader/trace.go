@@ -0,0 +1,63 @@
+package imagedownloader
+
+import (
+	"context"
+	"time"
+)
+
+type traceKey struct{}
+
+// downloadTrace collects what happened to the request of a single image across its retries
+type downloadTrace struct {
+	attempts   int
+	statusCode int
+	// latency is how long the last attempt waited for its response headers
+	latency time.Duration
+	// congested tells an attempt timed out or was answered with a 429 or a 5xx
+	congested bool
+
+	contentType         string
+	detectedContentType string
+	// mediaType is the normalized media type the image is stored under
+	mediaType string
+}
+
+func withTrace(ctx context.Context) (context.Context, *downloadTrace) {
+	trace := &downloadTrace{}
+	return context.WithValue(ctx, traceKey{}, trace), trace
+}
+
+func traceFromContext(ctx context.Context) *downloadTrace {
+	trace, _ := ctx.Value(traceKey{}).(*downloadTrace)
+	return trace
+}
+
+func (d *downloadTrace) recordAttempt(statusCode int, latency time.Duration, congested bool) {
+	if d == nil {
+		return
+	}
+
+	d.attempts++
+	d.statusCode = statusCode
+	d.latency = latency
+	d.congested = d.congested || congested
+}
+
+func (d *downloadTrace) recordContentType(contentType string, detectedContentType string, mediaType string) {
+	if d == nil {
+		return
+	}
+
+	d.contentType = contentType
+	d.detectedContentType = detectedContentType
+	d.mediaType = mediaType
+}
+
+// resolvedContentType is the media type the image is stored under, the content type header when none was resolved
+func (d *downloadTrace) resolvedContentType(contentType string) string {
+	if d == nil || d.mediaType == "" {
+		return contentType
+	}
+
+	return d.mediaType
+}
@@ -1,13 +1,48 @@
 package imagedownloader
 
 import (
+	"context"
+	"io"
 	"net/http"
+	"time"
 )
 
 type httpClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
+type imageValidator interface {
+	Validate(reader io.ReadSeeker, contentType string) (ImageConfig, error)
+}
+
+type hostLimiter interface {
+	Acquire(ctx context.Context, host string) (release func(), waited time.Duration, err error)
+	Observe(host string, latency time.Duration, congested bool) int
+}
+
+type hostBreaker interface {
+	Allow(host string) (done func(outcome breakerOutcome), err error)
+}
+
+// Storage persists downloaded images under slash separated keys
+type Storage interface {
+	Put(ctx context.Context, key string, body io.Reader, metadata Metadata) error
+	Exists(ctx context.Context, key string) (bool, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// CacheStore keeps cache entries across runs so unchanged images are not downloaded again
+type CacheStore interface {
+	Get(url string) (CacheEntry, bool, error)
+	Put(entry CacheEntry) error
+}
+
+type Metadata struct {
+	ContentType string
+	// Size is the body length in bytes, or -1 when unknown
+	Size int64
+}
+
 var (
 	CommonImageContentTypeExtensions = map[string]string{
 		"image/jpeg":               ".jpg",
@@ -22,5 +57,15 @@ var (
 		"image/tiff":               ".tiff",
 		"image/vnd.radiance":       ".hdr",
 		"image/jp2":                ".jp2",
+		"image/avif":               ".avif",
+	}
+
+	CommonImageContentTypeAliases = map[string]string{
+		"image/jpg":           "image/jpeg",
+		"image/pjpeg":         "image/jpeg",
+		"image/x-png":         "image/png",
+		"image/x-windows-bmp": "image/bmp",
+		"image/x-tiff":        "image/tiff",
+		"image/x-jp2":         "image/jp2",
 	}
 )
@@ -1,12 +1,15 @@
 // Code generated by MockGen. DO NOT EDIT.
-// Source: client.go
+// Source: types.go
 
 // Package imagedownloader is a generated GoMock package.
 package imagedownloader
 
 import (
+	context "context"
+	io "io"
 	http "net/http"
 	reflect "reflect"
+	time "time"
 
 	gomock "go.uber.org/mock/gomock"
 )
@@ -48,3 +51,251 @@ func (mr *MockhttpClientMockRecorder) Do(req interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Do", reflect.TypeOf((*MockhttpClient)(nil).Do), req)
 }
+
+// MockimageValidator is a mock of imageValidator interface.
+type MockimageValidator struct {
+	ctrl     *gomock.Controller
+	recorder *MockimageValidatorMockRecorder
+}
+
+// MockimageValidatorMockRecorder is the mock recorder for MockimageValidator.
+type MockimageValidatorMockRecorder struct {
+	mock *MockimageValidator
+}
+
+// NewMockimageValidator creates a new mock instance.
+func NewMockimageValidator(ctrl *gomock.Controller) *MockimageValidator {
+	mock := &MockimageValidator{ctrl: ctrl}
+	mock.recorder = &MockimageValidatorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockimageValidator) EXPECT() *MockimageValidatorMockRecorder {
+	return m.recorder
+}
+
+// Validate mocks base method.
+func (m *MockimageValidator) Validate(reader io.ReadSeeker, contentType string) (ImageConfig, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Validate", reader, contentType)
+	ret0, _ := ret[0].(ImageConfig)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Validate indicates an expected call of Validate.
+func (mr *MockimageValidatorMockRecorder) Validate(reader, contentType interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Validate", reflect.TypeOf((*MockimageValidator)(nil).Validate), reader, contentType)
+}
+
+// MockhostLimiter is a mock of hostLimiter interface.
+type MockhostLimiter struct {
+	ctrl     *gomock.Controller
+	recorder *MockhostLimiterMockRecorder
+}
+
+// MockhostLimiterMockRecorder is the mock recorder for MockhostLimiter.
+type MockhostLimiterMockRecorder struct {
+	mock *MockhostLimiter
+}
+
+// NewMockhostLimiter creates a new mock instance.
+func NewMockhostLimiter(ctrl *gomock.Controller) *MockhostLimiter {
+	mock := &MockhostLimiter{ctrl: ctrl}
+	mock.recorder = &MockhostLimiterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockhostLimiter) EXPECT() *MockhostLimiterMockRecorder {
+	return m.recorder
+}
+
+// Acquire mocks base method.
+func (m *MockhostLimiter) Acquire(ctx context.Context, host string) (func(), time.Duration, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Acquire", ctx, host)
+	ret0, _ := ret[0].(func())
+	ret1, _ := ret[1].(time.Duration)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Acquire indicates an expected call of Acquire.
+func (mr *MockhostLimiterMockRecorder) Acquire(ctx, host interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Acquire", reflect.TypeOf((*MockhostLimiter)(nil).Acquire), ctx, host)
+}
+
+// Observe mocks base method.
+func (m *MockhostLimiter) Observe(host string, latency time.Duration, congested bool) int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Observe", host, latency, congested)
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// Observe indicates an expected call of Observe.
+func (mr *MockhostLimiterMockRecorder) Observe(host, latency, congested interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Observe", reflect.TypeOf((*MockhostLimiter)(nil).Observe), host, latency, congested)
+}
+
+// MockhostBreaker is a mock of hostBreaker interface.
+type MockhostBreaker struct {
+	ctrl     *gomock.Controller
+	recorder *MockhostBreakerMockRecorder
+}
+
+// MockhostBreakerMockRecorder is the mock recorder for MockhostBreaker.
+type MockhostBreakerMockRecorder struct {
+	mock *MockhostBreaker
+}
+
+// NewMockhostBreaker creates a new mock instance.
+func NewMockhostBreaker(ctrl *gomock.Controller) *MockhostBreaker {
+	mock := &MockhostBreaker{ctrl: ctrl}
+	mock.recorder = &MockhostBreakerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockhostBreaker) EXPECT() *MockhostBreakerMockRecorder {
+	return m.recorder
+}
+
+// Allow mocks base method.
+func (m *MockhostBreaker) Allow(host string) (func(breakerOutcome), error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Allow", host)
+	ret0, _ := ret[0].(func(breakerOutcome))
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Allow indicates an expected call of Allow.
+func (mr *MockhostBreakerMockRecorder) Allow(host interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Allow", reflect.TypeOf((*MockhostBreaker)(nil).Allow), host)
+}
+
+// MockStorage is a mock of Storage interface.
+type MockStorage struct {
+	ctrl     *gomock.Controller
+	recorder *MockStorageMockRecorder
+}
+
+// MockStorageMockRecorder is the mock recorder for MockStorage.
+type MockStorageMockRecorder struct {
+	mock *MockStorage
+}
+
+// NewMockStorage creates a new mock instance.
+func NewMockStorage(ctrl *gomock.Controller) *MockStorage {
+	mock := &MockStorage{ctrl: ctrl}
+	mock.recorder = &MockStorageMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockStorage) EXPECT() *MockStorageMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockStorage) Delete(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockStorageMockRecorder) Delete(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockStorage)(nil).Delete), ctx, key)
+}
+
+// Exists mocks base method.
+func (m *MockStorage) Exists(ctx context.Context, key string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Exists", ctx, key)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Exists indicates an expected call of Exists.
+func (mr *MockStorageMockRecorder) Exists(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exists", reflect.TypeOf((*MockStorage)(nil).Exists), ctx, key)
+}
+
+// Put mocks base method.
+func (m *MockStorage) Put(ctx context.Context, key string, body io.Reader, metadata Metadata) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Put", ctx, key, body, metadata)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Put indicates an expected call of Put.
+func (mr *MockStorageMockRecorder) Put(ctx, key, body, metadata interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockStorage)(nil).Put), ctx, key, body, metadata)
+}
+
+// MockCacheStore is a mock of CacheStore interface.
+type MockCacheStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockCacheStoreMockRecorder
+}
+
+// MockCacheStoreMockRecorder is the mock recorder for MockCacheStore.
+type MockCacheStoreMockRecorder struct {
+	mock *MockCacheStore
+}
+
+// NewMockCacheStore creates a new mock instance.
+func NewMockCacheStore(ctrl *gomock.Controller) *MockCacheStore {
+	mock := &MockCacheStore{ctrl: ctrl}
+	mock.recorder = &MockCacheStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCacheStore) EXPECT() *MockCacheStoreMockRecorder {
+	return m.recorder
+}
+
+// Get mocks base method.
+func (m *MockCacheStore) Get(url string) (CacheEntry, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", url)
+	ret0, _ := ret[0].(CacheEntry)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockCacheStoreMockRecorder) Get(url interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockCacheStore)(nil).Get), url)
+}
+
+// Put mocks base method.
+func (m *MockCacheStore) Put(entry CacheEntry) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Put", entry)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Put indicates an expected call of Put.
+func (mr *MockCacheStoreMockRecorder) Put(entry interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockCacheStore)(nil).Put), entry)
+}
@@ -0,0 +1,98 @@
+package imagedownloader
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+var (
+	ErrCorruptImage    = errors.New("could not decode a corrupt image")
+	ErrImageDimensions = errors.New("image dimensions are out of the accepted range")
+)
+
+var (
+	// decodableContentTypes lists the image formats go decoders are registered for, other formats are never validated
+	decodableContentTypes = map[string]bool{
+		"image/jpeg":     true,
+		"image/png":      true,
+		"image/gif":      true,
+		"image/bmp":      true,
+		"image/x-ms-bmp": true,
+		"image/tiff":     true,
+		"image/webp":     true,
+	}
+)
+
+type ImageConfig struct {
+	Format string
+	Width  int
+	Height int
+}
+
+// ImageValidator decodes downloaded images to catch corrupt ones and the ones out of the accepted dimensions,
+// a zero dimension limit means unlimited
+type ImageValidator struct {
+	// DecodeFully decodes every pixel instead of the header only, catching truncated images at the cost of memory
+	DecodeFully bool
+
+	MinWidth  int
+	MinHeight int
+	MaxWidth  int
+	MaxHeight int
+}
+
+func (v *ImageValidator) Validate(reader io.ReadSeeker, contentType string) (ImageConfig, error) {
+	if !decodableContentTypes[contentType] {
+		return ImageConfig{}, nil
+	}
+
+	cfg, format, err := image.DecodeConfig(reader)
+	if err != nil {
+		return ImageConfig{}, errors.Join(ErrCorruptImage, err)
+	}
+
+	imageConfig := ImageConfig{
+		Format: format,
+		Width:  cfg.Width,
+		Height: cfg.Height,
+	}
+
+	// check dimensions first so a gigantic image is never decoded in full
+	if err := v.validateDimensions(imageConfig); err != nil {
+		return imageConfig, err
+	}
+
+	if !v.DecodeFully {
+		return imageConfig, nil
+	}
+
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		return imageConfig, err
+	}
+
+	if _, _, err := image.Decode(reader); err != nil {
+		return imageConfig, errors.Join(ErrCorruptImage, err)
+	}
+
+	return imageConfig, nil
+}
+
+func (v *ImageValidator) validateDimensions(cfg ImageConfig) error {
+	switch {
+	case cfg.Width < v.MinWidth || cfg.Height < v.MinHeight:
+		return fmt.Errorf("%w: %dx%d is smaller than %dx%d", ErrImageDimensions, cfg.Width, cfg.Height, v.MinWidth, v.MinHeight)
+	case v.MaxWidth > 0 && cfg.Width > v.MaxWidth, v.MaxHeight > 0 && cfg.Height > v.MaxHeight:
+		return fmt.Errorf("%w: %dx%d is larger than %dx%d", ErrImageDimensions, cfg.Width, cfg.Height, v.MaxWidth, v.MaxHeight)
+	}
+
+	return nil
+}
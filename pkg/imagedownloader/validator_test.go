@@ -0,0 +1,67 @@
+package imagedownloader
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newPNG(t *testing.T, width int, height int) []byte {
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))))
+	return buf.Bytes()
+}
+
+func TestImageValidator_Validate(t *testing.T) {
+	t.Run("returns format and dimensions of a valid image", func(t *testing.T) {
+		validator := &ImageValidator{DecodeFully: true}
+
+		cfg, err := validator.Validate(bytes.NewReader(newPNG(t, 4, 3)), "image/png")
+		assert.NoError(t, err)
+		assert.Equal(t, ImageConfig{Format: "png", Width: 4, Height: 3}, cfg)
+	})
+
+	t.Run("returns nothing on a format without a decoder", func(t *testing.T) {
+		validator := &ImageValidator{DecodeFully: true}
+
+		cfg, err := validator.Validate(bytes.NewReader([]byte("<svg></svg>")), "image/svg+xml")
+		assert.NoError(t, err)
+		assert.Equal(t, ImageConfig{}, cfg)
+	})
+
+	t.Run("returns error on a body that is no image", func(t *testing.T) {
+		validator := &ImageValidator{}
+
+		_, err := validator.Validate(bytes.NewReader([]byte("<html></html>")), "image/jpeg")
+		assert.ErrorIs(t, err, ErrCorruptImage)
+	})
+
+	t.Run("returns error on a truncated image only when decoding fully", func(t *testing.T) {
+		truncated := newPNG(t, 64, 64)
+		truncated = truncated[:len(truncated)-20]
+
+		_, err := (&ImageValidator{}).Validate(bytes.NewReader(truncated), "image/png")
+		assert.NoError(t, err)
+
+		cfg, err := (&ImageValidator{DecodeFully: true}).Validate(bytes.NewReader(truncated), "image/png")
+		assert.ErrorIs(t, err, ErrCorruptImage)
+		assert.Equal(t, ImageConfig{Format: "png", Width: 64, Height: 64}, cfg)
+	})
+
+	t.Run("returns error on an image out of the accepted dimensions", func(t *testing.T) {
+		validator := &ImageValidator{MinWidth: 2, MinHeight: 2, MaxWidth: 10, MaxHeight: 10}
+
+		_, err := validator.Validate(bytes.NewReader(newPNG(t, 1, 1)), "image/png")
+		assert.ErrorIs(t, err, ErrImageDimensions)
+
+		cfg, err := validator.Validate(bytes.NewReader(newPNG(t, 11, 5)), "image/png")
+		assert.ErrorIs(t, err, ErrImageDimensions)
+		assert.Equal(t, 11, cfg.Width)
+
+		_, err = validator.Validate(bytes.NewReader(newPNG(t, 10, 10)), "image/png")
+		assert.NoError(t, err)
+	})
+}